@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gorant/posts"
+)
+
+const cliUsage = `Usage:
+  gorant                              start the server
+  gorant tags list                    list tags with how many posts use them
+  gorant tags rename FROM TO          rename a tag
+  gorant tags merge FROM INTO         move FROM's posts to INTO and make FROM a synonym of it
+  gorant tags synonyms                list synonyms
+  gorant tags synonym add SYNONYM TAG make SYNONYM stand for TAG when tags are entered
+  gorant tags synonym remove SYNONYM  remove a synonym
+  gorant tags prune                   delete tags no post uses
+`
+
+// runCommand runs the subcommand gorant was started with instead of the server, and returns the exit code.
+func runCommand(args []string) int {
+	var err error
+	switch {
+	case len(args) == 2 && args[0] == "tags" && args[1] == "list":
+		var tags []posts.Tag
+		if tags, err = posts.ListAllTags(); err == nil {
+			for _, t := range tags {
+				fmt.Printf("%-30s %d\n", t.Tag, t.Posts)
+			}
+		}
+	case len(args) == 4 && args[0] == "tags" && args[1] == "rename":
+		err = posts.RenameTag(args[2], args[3])
+	case len(args) == 4 && args[0] == "tags" && args[1] == "merge":
+		err = posts.MergeTags(args[2], args[3])
+	case len(args) == 2 && args[0] == "tags" && args[1] == "synonyms":
+		var synonyms []posts.TagSynonym
+		if synonyms, err = posts.ListSynonyms(); err == nil {
+			for _, s := range synonyms {
+				fmt.Printf("%-30s -> %s\n", s.Synonym, s.Tag)
+			}
+		}
+	case len(args) == 5 && args[0] == "tags" && args[1] == "synonym" && args[2] == "add":
+		err = posts.AddSynonym(args[3], args[4])
+	case len(args) == 4 && args[0] == "tags" && args[1] == "synonym" && args[2] == "remove":
+		err = posts.RemoveSynonym(args[3])
+	case len(args) == 2 && args[0] == "tags" && args[1] == "prune":
+		// DeleteOrphanTags prints the count itself
+		_, err = posts.DeleteOrphanTags()
+	default:
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	return 0
+}
@@ -10,6 +10,14 @@ import (
 
 var DB *sqlx.DB
 
+// defaultMoods is the scale a new database starts with, as rows for the moods table
+const defaultMoods = `('angry', 'Angry', -3, '#dc2626', '😡', false),
+						('upset', 'Upset', -2, '#ea580c', '😫', false),
+						('sad', 'Sad', -1, '#2563eb', '☹️', false),
+						('neutral', 'Neutral', 0, '#6b7280', '😐', true),
+						('happy', 'Happy', 1, '#16a34a', '🙂', false),
+						('elated', 'Elated', 2, '#eab308', '😄', false)`
+
 func Reset() error {
 	var err error
 	// Postgres
@@ -38,6 +46,11 @@ func Reset() error {
 		fmt.Println("Error dropping table: posts_likes")
 		return err
 	}
+	_, err = DB.Exec(`DROP TABLE IF EXISTS posts_reactions CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: posts_reactions")
+		return err
+	}
 
 	_, err = DB.Exec(`DROP TABLE IF EXISTS tags CASCADE;`)
 	if err != nil {
@@ -51,18 +64,148 @@ func Reset() error {
 		return err
 	}
 
+	_, err = DB.Exec(`DROP TABLE IF EXISTS revisions CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: revisions")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS attachments CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: attachments")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS notifications CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: notifications")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS job_schedules CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: job_schedules")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS jobs CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: jobs")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS mentions CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: mentions")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS follows CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: follows")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS tags_follows CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: tags_follows")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS user_relations CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: user_relations")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS bookmark_collections CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: bookmark_collections")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS bookmarks CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: bookmarks")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS posts_subscriptions CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: posts_subscriptions")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS conversations CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: conversations")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS messages CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: messages")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS moods CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: moods")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS mood_changes CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: mood_changes")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS tag_synonyms CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: tag_synonyms")
+		return err
+	}
+
+	_, err = DB.Exec(`DROP TABLE IF EXISTS filter_presets CASCADE;`)
+	if err != nil {
+		fmt.Println("Error dropping table: filter_presets")
+		return err
+	}
+
 	// Users
 
-	_, err = DB.Exec(`CREATE TABLE users (user_id VARCHAR(255) PRIMARY KEY, email VARCHAR(100) NOT NULL, preferred_name VARCHAR(255) DEFAULT '', contact_me INT DEFAULT 1, avatar VARCHAR(255) DEFAULT 'default', sort_comments VARCHAR(15) DEFAULT 'upvote;desc');`)
+	_, err = DB.Exec(`CREATE TABLE users (user_id VARCHAR(255) PRIMARY KEY, email VARCHAR(100) NOT NULL, preferred_name VARCHAR(255) DEFAULT '', contact_me INT DEFAULT 1, avatar VARCHAR(255) DEFAULT 'default', sort_comments VARCHAR(15) DEFAULT 'upvote;desc', role VARCHAR(15) DEFAULT 'user', handle VARCHAR(30) UNIQUE, hide_activity INT DEFAULT 0, auto_subscribe INT DEFAULT 1, digest VARCHAR(10) DEFAULT 'weekly', last_digest_at TEXT);`)
 	if err != nil {
 		fmt.Println("Error creating table: users")
 		return err
 	}
 	fmt.Println("Created table: users")
 
+	// Moods
+	// The scale posts are tagged with, loaded once by the moods package. Intensity orders it, neutral sits at 0.
+	_, err = DB.Exec(`CREATE TABLE moods (mood_key VARCHAR(30) PRIMARY KEY, label VARCHAR(50) NOT NULL, intensity INT UNIQUE NOT NULL, color VARCHAR(20) NOT NULL, icon VARCHAR(20) NOT NULL, is_default BOOLEAN NOT NULL DEFAULT false);`)
+	if err != nil {
+		fmt.Println("Error creating table: moods")
+		return err
+	}
+	fmt.Println("Created table: moods")
+
+	_, err = DB.Exec(`CREATE UNIQUE INDEX idx_moods_default ON moods (is_default) WHERE is_default;`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_moods_default")
+		return err
+	}
+	fmt.Println("Created index: idx_moods_default")
+
+	_, err = DB.Exec(`INSERT INTO moods (mood_key, label, intensity, color, icon, is_default) VALUES ` + defaultMoods)
+	if err != nil {
+		fmt.Println("Error seeding table: moods")
+		return err
+	}
+
 	// Posts
 
-	_, err = DB.Exec(`CREATE TABLE posts (post_id VARCHAR(255) PRIMARY KEY, post_title VARCHAR(255) NOT NULL, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, description VARCHAR(255) DEFAULT '', protected INT DEFAULT 0, created_at TEXT, mood VARCHAR(15) DEFAULT 'neutral');`)
+	_, err = DB.Exec(`CREATE TABLE posts (post_id VARCHAR(255) PRIMARY KEY, post_title VARCHAR(255) NOT NULL, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, description VARCHAR(255) DEFAULT '', protected INT DEFAULT 0, created_at TEXT, mood VARCHAR(30) NOT NULL DEFAULT 'neutral' REFERENCES moods(mood_key) ON UPDATE CASCADE, deleted_at TEXT, deleted_by VARCHAR(255));`)
 	if err != nil {
 		fmt.Println("Error creating table: posts")
 		return err
@@ -71,7 +214,7 @@ func Reset() error {
 
 	// Comments
 
-	_, err = DB.Exec("CREATE TABLE comments (comment_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, content TEXT, created_at TEXT, post_id VARCHAR(255), FOREIGN KEY(post_id) REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE);")
+	_, err = DB.Exec("CREATE TABLE comments (comment_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, content TEXT, created_at TEXT, post_id VARCHAR(255), edited_at TEXT, deleted_at TEXT, deleted_by VARCHAR(255), FOREIGN KEY(post_id) REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE);")
 	if err != nil {
 		fmt.Println("Error creating table: comments")
 		return err
@@ -85,21 +228,22 @@ func Reset() error {
 	}
 	fmt.Println("Created index: comments")
 
-	// Posts Likes
-
-	_, err = DB.Exec(`CREATE TABLE posts_likes (like_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, post_id VARCHAR(255) REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, score INT);`)
+	// Posts Reactions
+	// A reader reacts to a post with a mood from the scale, one reaction per reader that they can change.
+	// These used to be likes, see Migrate.
+	_, err = DB.Exec(`CREATE TABLE posts_reactions (reaction_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, post_id VARCHAR(255) NOT NULL REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, reaction VARCHAR(30) NOT NULL REFERENCES moods(mood_key) ON UPDATE CASCADE, created_at TEXT);`)
 	if err != nil {
-		fmt.Println("Error creating table: posts_likes")
+		fmt.Println("Error creating table: posts_reactions")
 		return err
 	}
-	fmt.Println("Created table: posts_likes")
+	fmt.Println("Created table: posts_reactions")
 
-	_, err = DB.Exec(`CREATE INDEX idx_posts_likes_post_id ON posts_likes (post_id);`)
+	_, err = DB.Exec(`CREATE UNIQUE INDEX idx_posts_reactions_post_user ON posts_reactions (post_id, user_id);`)
 	if err != nil {
-		fmt.Println("Error creating index: idx_posts_likes_post_id")
+		fmt.Println("Error creating index: idx_posts_reactions_post_user")
 		return err
 	}
-	fmt.Println("Created index: idx_posts_likes_post_id")
+	fmt.Println("Created index: idx_posts_reactions_post_user")
 
 	// Comments Votes
 	_, err = DB.Exec(`CREATE TABLE comments_votes (vote_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, comment_id INT REFERENCES comments(comment_id) ON DELETE CASCADE ON UPDATE CASCADE, score INT);`)
@@ -117,7 +261,8 @@ func Reset() error {
 	fmt.Println("Created index: idx_comments_votes_comment_id")
 
 	// Tags
-	_, err = DB.Exec(`CREATE TABLE tags (tag_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, tag VARCHAR(30) UNIQUE NOT NULL);`)
+	// The description is shown on the tag's page, moderators write it.
+	_, err = DB.Exec(`CREATE TABLE tags (tag_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, tag VARCHAR(30) UNIQUE NOT NULL, description TEXT NOT NULL DEFAULT '');`)
 	if err != nil {
 		fmt.Println("Error creating table: tags")
 		return err
@@ -132,7 +277,263 @@ func Reset() error {
 	}
 	fmt.Println("Created table: posts_tags")
 
-	_, err = DB.Exec("INSERT INTO users (user_id, email, preferred_name) VALUES ('anonymous@rantkit.com', 'anonymous@rantkit.com', 'anonymous')")
+	// Revisions
+	// Stores the previous value of a post title, post description or comment each time it is overwritten.
+	_, err = DB.Exec(`CREATE TABLE revisions (revision_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, post_id VARCHAR(255) REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, comment_id INT REFERENCES comments(comment_id) ON DELETE CASCADE ON UPDATE CASCADE, field VARCHAR(15) NOT NULL, content TEXT, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, created_at TEXT);`)
+	if err != nil {
+		fmt.Println("Error creating table: revisions")
+		return err
+	}
+	fmt.Println("Created table: revisions")
+
+	_, err = DB.Exec(`CREATE INDEX idx_revisions_post_id ON revisions (post_id);`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_revisions_post_id")
+		return err
+	}
+	fmt.Println("Created index: idx_revisions_post_id")
+
+	// Attachments
+	// Images on posts and comments. The files themselves live in the uploads BlobStore under blob_hash.
+	_, err = DB.Exec(`CREATE TABLE attachments (attachment_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, post_id VARCHAR(255) NOT NULL REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, comment_id INT REFERENCES comments(comment_id) ON DELETE CASCADE ON UPDATE CASCADE, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, blob_hash VARCHAR(64) NOT NULL, width INT, height INT, created_at TEXT);`)
+	if err != nil {
+		fmt.Println("Error creating table: attachments")
+		return err
+	}
+	fmt.Println("Created table: attachments")
+
+	_, err = DB.Exec(`CREATE INDEX idx_attachments_post_id ON attachments (post_id);`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_attachments_post_id")
+		return err
+	}
+	fmt.Println("Created index: idx_attachments_post_id")
+
+	// Notifications
+	// One row per event a user should hear about. type is one of the types registered in the notifications package.
+	_, err = DB.Exec(`CREATE TABLE notifications (notification_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, actor_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, type VARCHAR(30) NOT NULL, post_id VARCHAR(255) REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, comment_id INT REFERENCES comments(comment_id) ON DELETE CASCADE ON UPDATE CASCADE, count INT DEFAULT 1, created_at TEXT, read_at TEXT);`)
+	if err != nil {
+		fmt.Println("Error creating table: notifications")
+		return err
+	}
+	fmt.Println("Created table: notifications")
+
+	_, err = DB.Exec(`CREATE INDEX idx_notifications_user_id ON notifications (user_id, read_at);`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_notifications_user_id")
+		return err
+	}
+	fmt.Println("Created index: idx_notifications_user_id")
+
+	_, err = DB.Exec(`CREATE TABLE job_schedules (name VARCHAR(100) PRIMARY KEY, kind VARCHAR(100) NOT NULL, interval_seconds INT NOT NULL, next_run_at TIMESTAMPTZ NOT NULL, last_run_at TIMESTAMPTZ);`)
+	if err != nil {
+		fmt.Println("Error creating table: job_schedules")
+		return err
+	}
+	fmt.Println("Created table: job_schedules")
+
+	// Unlike the rest of the schema the queue uses TIMESTAMPTZ, it sorts and compares run_at against now() on every poll
+	_, err = DB.Exec(`CREATE TABLE jobs (job_id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, kind VARCHAR(100) NOT NULL, payload JSONB NOT NULL, status VARCHAR(10) NOT NULL, attempts INT DEFAULT 0, max_attempts INT NOT NULL, run_at TIMESTAMPTZ NOT NULL, locked_at TIMESTAMPTZ, last_error TEXT, created_at TIMESTAMPTZ NOT NULL, updated_at TIMESTAMPTZ NOT NULL, finished_at TIMESTAMPTZ);`)
+	if err != nil {
+		fmt.Println("Error creating table: jobs")
+		return err
+	}
+	fmt.Println("Created table: jobs")
+
+	_, err = DB.Exec(`CREATE INDEX idx_jobs_run_at ON jobs (run_at) WHERE status = 'queued';`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_jobs_run_at")
+		return err
+	}
+	fmt.Println("Created index: idx_jobs_run_at")
+
+	_, err = DB.Exec(`CREATE TABLE mentions (mention_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, comment_id INT REFERENCES comments(comment_id) ON DELETE CASCADE ON UPDATE CASCADE, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, created_at TEXT, UNIQUE (comment_id, user_id));`)
+	if err != nil {
+		fmt.Println("Error creating table: mentions")
+		return err
+	}
+	fmt.Println("Created table: mentions")
+
+	_, err = DB.Exec(`CREATE INDEX idx_mentions_user_id ON mentions (user_id);`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_mentions_user_id")
+		return err
+	}
+	fmt.Println("Created index: idx_mentions_user_id")
+
+	_, err = DB.Exec(`CREATE TABLE follows (follow_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, follower_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, followee_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, created_at TEXT, UNIQUE (follower_id, followee_id));`)
+	if err != nil {
+		fmt.Println("Error creating table: follows")
+		return err
+	}
+	fmt.Println("Created table: follows")
+
+	_, err = DB.Exec(`CREATE INDEX idx_follows_followee_id ON follows (followee_id);`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_follows_followee_id")
+		return err
+	}
+	fmt.Println("Created index: idx_follows_followee_id")
+
+	_, err = DB.Exec(`CREATE TABLE tags_follows (tags_follow_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, tag_id INT REFERENCES tags(tag_id) ON DELETE CASCADE ON UPDATE CASCADE, created_at TEXT, UNIQUE (user_id, tag_id));`)
+	if err != nil {
+		fmt.Println("Error creating table: tags_follows")
+		return err
+	}
+	fmt.Println("Created table: tags_follows")
+
+	// Mutes and blocks, one row per pair. A block includes everything a mute does
+	_, err = DB.Exec(`CREATE TABLE user_relations (relation_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, target_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, kind VARCHAR(10) NOT NULL, created_at TEXT, UNIQUE (user_id, target_id));`)
+	if err != nil {
+		fmt.Println("Error creating table: user_relations")
+		return err
+	}
+	fmt.Println("Created table: user_relations")
+
+	_, err = DB.Exec(`CREATE INDEX idx_user_relations_target_id ON user_relations (target_id);`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_user_relations_target_id")
+		return err
+	}
+	fmt.Println("Created index: idx_user_relations_target_id")
+
+	// Bookmark Collections
+	// Private, only ever listed for their owner
+	_, err = DB.Exec(`CREATE TABLE bookmark_collections (collection_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, name VARCHAR(50) NOT NULL, created_at TEXT, UNIQUE (user_id, name));`)
+	if err != nil {
+		fmt.Println("Error creating table: bookmark_collections")
+		return err
+	}
+	fmt.Println("Created table: bookmark_collections")
+
+	// Bookmarks
+	// post_id and comment_id have no foreign keys, so a bookmark outlives a hard delete and is shown greyed out with its saved title.
+	// Soft deletes remove bookmarks in the app instead.
+	_, err = DB.Exec(`CREATE TABLE bookmarks (bookmark_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, post_id VARCHAR(255) NOT NULL, comment_id INT, collection_id INT REFERENCES bookmark_collections(collection_id) ON DELETE SET NULL, title TEXT, excerpt TEXT, created_at TEXT);`)
+	if err != nil {
+		fmt.Println("Error creating table: bookmarks")
+		return err
+	}
+	fmt.Println("Created table: bookmarks")
+
+	_, err = DB.Exec(`CREATE INDEX idx_bookmarks_post_id ON bookmarks (post_id);`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_bookmarks_post_id")
+		return err
+	}
+	fmt.Println("Created index: idx_bookmarks_post_id")
+
+	_, err = DB.Exec(`CREATE UNIQUE INDEX idx_bookmarks_user_post ON bookmarks (user_id, post_id) WHERE comment_id IS NULL;`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_bookmarks_user_post")
+		return err
+	}
+	fmt.Println("Created index: idx_bookmarks_user_post")
+
+	_, err = DB.Exec(`CREATE UNIQUE INDEX idx_bookmarks_user_comment ON bookmarks (user_id, comment_id) WHERE comment_id IS NOT NULL;`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_bookmarks_user_comment")
+		return err
+	}
+	fmt.Println("Created index: idx_bookmarks_user_comment")
+
+	// Posts Subscriptions
+	// subscribed=false is kept, so someone who unsubscribed isn't signed up again by their next comment
+	_, err = DB.Exec(`CREATE TABLE posts_subscriptions (subscription_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, post_id VARCHAR(255) REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, subscribed BOOLEAN NOT NULL DEFAULT true, created_at TEXT, UNIQUE (user_id, post_id));`)
+	if err != nil {
+		fmt.Println("Error creating table: posts_subscriptions")
+		return err
+	}
+	fmt.Println("Created table: posts_subscriptions")
+
+	_, err = DB.Exec(`CREATE INDEX idx_posts_subscriptions_post_id ON posts_subscriptions (post_id);`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_posts_subscriptions_post_id")
+		return err
+	}
+	fmt.Println("Created index: idx_posts_subscriptions_post_id")
+
+	// Conversations
+	// One per pair of users for direct messages, user_a is always the smaller user_id so the pair is unique
+	_, err = DB.Exec(`CREATE TABLE conversations (conversation_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_a VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, user_b VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, created_at TEXT, last_message_at TEXT, UNIQUE (user_a, user_b), CHECK (user_a < user_b));`)
+	if err != nil {
+		fmt.Println("Error creating table: conversations")
+		return err
+	}
+	fmt.Println("Created table: conversations")
+
+	_, err = DB.Exec(`CREATE INDEX idx_conversations_user_b ON conversations (user_b);`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_conversations_user_b")
+		return err
+	}
+	fmt.Println("Created index: idx_conversations_user_b")
+
+	// Messages
+	_, err = DB.Exec(`CREATE TABLE messages (message_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, conversation_id INT NOT NULL REFERENCES conversations(conversation_id) ON DELETE CASCADE, sender_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, content TEXT NOT NULL, created_at TEXT, read_at TEXT);`)
+	if err != nil {
+		fmt.Println("Error creating table: messages")
+		return err
+	}
+	fmt.Println("Created table: messages")
+
+	_, err = DB.Exec(`CREATE INDEX idx_messages_conversation_id ON messages (conversation_id, message_id);`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_messages_conversation_id")
+		return err
+	}
+	fmt.Println("Created index: idx_messages_conversation_id")
+
+	_, err = DB.Exec(`CREATE INDEX idx_messages_sender_id ON messages (sender_id);`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_messages_sender_id")
+		return err
+	}
+	fmt.Println("Created index: idx_messages_sender_id")
+
+	// Mood Changes
+	// One row per edit of posts.mood, so the mood a post was created with is the first row's from_mood.
+	_, err = DB.Exec(`CREATE TABLE mood_changes (change_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, post_id VARCHAR(255) NOT NULL REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, from_mood VARCHAR(30) NOT NULL REFERENCES moods(mood_key) ON UPDATE CASCADE, to_mood VARCHAR(30) NOT NULL REFERENCES moods(mood_key) ON UPDATE CASCADE, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, created_at TEXT);`)
+	if err != nil {
+		fmt.Println("Error creating table: mood_changes")
+		return err
+	}
+	fmt.Println("Created table: mood_changes")
+
+	_, err = DB.Exec(`CREATE INDEX idx_mood_changes_post_id ON mood_changes (post_id, change_id);`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_mood_changes_post_id")
+		return err
+	}
+	fmt.Println("Created index: idx_mood_changes_post_id")
+
+	// Tag Synonyms
+	// Alternative spellings of a tag, e.g. wfh for work-from-home. They're swapped for the tag when tags are entered.
+	_, err = DB.Exec(`CREATE TABLE tag_synonyms (synonym VARCHAR(30) PRIMARY KEY, tag_id INT NOT NULL REFERENCES tags(tag_id) ON DELETE CASCADE ON UPDATE CASCADE, created_at TEXT);`)
+	if err != nil {
+		fmt.Println("Error creating table: tag_synonyms")
+		return err
+	}
+	fmt.Println("Created table: tag_synonyms")
+
+	// Saved front page filters, query holds the filter as a URL query string.
+	// A user's default preset is what the front page shows them when they land on it.
+	_, err = DB.Exec(`CREATE TABLE filter_presets (preset_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, name VARCHAR(60) NOT NULL, query TEXT NOT NULL DEFAULT '', is_default BOOLEAN NOT NULL DEFAULT false, created_at TEXT, UNIQUE (user_id, name));`)
+	if err != nil {
+		fmt.Println("Error creating table: filter_presets")
+		return err
+	}
+	fmt.Println("Created table: filter_presets")
+
+	_, err = DB.Exec(`CREATE UNIQUE INDEX idx_filter_presets_default ON filter_presets (user_id) WHERE is_default;`)
+	if err != nil {
+		fmt.Println("Error creating index: idx_filter_presets_default")
+		return err
+	}
+	fmt.Println("Created index: idx_filter_presets_default")
+
+	// Nobody reads the anonymous user's inbox, so it's never emailed
+	_, err = DB.Exec("INSERT INTO users (user_id, email, preferred_name, contact_me) VALUES ('anonymous@rantkit.com', 'anonymous@rantkit.com', 'anonymous', 0)")
 	if err != nil {
 		fmt.Println("Error creating user: anonymous")
 		return err
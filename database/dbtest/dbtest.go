@@ -0,0 +1,69 @@
+package dbtest
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	"gorant/database"
+)
+
+// Open points database.DB at the database in TEST_DATABASE_URL and resets its schema, or skips the test if
+// there is none. Reset drops every table, so never point it at a database with data you want to keep.
+func Open(t testing.TB) {
+	t.Helper()
+
+	Connect(t)
+	if err := database.Reset(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Connect is Open without the reset, for tests that set up a schema of their own. Tests drop tables and even whole
+// schemas, so it refuses a database that doesn't have "test" in its name or is the app's own DB_NAME.
+func Connect(t testing.TB) {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := sqlx.Open("pgx", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	var name string
+	if err := db.Get(&name, "SELECT current_database()"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(name, "test") || name == os.Getenv("DB_NAME") {
+		t.Fatalf("TEST_DATABASE_URL points at %q, tests only run against a database of their own with test in its name", name)
+	}
+
+	database.DB = db
+}
+
+// AddUser inserts a user with the given ID, its handle is the ID too.
+func AddUser(t testing.TB, userID string) {
+	t.Helper()
+
+	_, err := database.DB.Exec("INSERT INTO users (user_id, email, preferred_name, handle) VALUES ($1, $2, $1, $1)", userID, userID+"@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// AddPost inserts a neutral post by userID.
+func AddPost(t testing.TB, postID string, userID string) {
+	t.Helper()
+
+	_, err := database.DB.Exec("INSERT INTO posts (post_id, post_title, user_id, created_at, mood) VALUES ($1, $1, $2, '2024-01-01T00:00:00Z', 'neutral')", postID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
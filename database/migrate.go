@@ -0,0 +1,146 @@
+package database
+
+import "fmt"
+
+// Migrate brings a database created by an older Reset, as far back as the first schema, up to date without losing
+// data. Every step checks whether it's still needed, so it runs on each start. A table or column added to Reset
+// needs a step here too, the migrate test compares the two schemas.
+func Migrate() error {
+	for _, m := range migrations {
+		if _, err := DB.Exec(m.query); err != nil {
+			fmt.Println("Error migrating: " + m.name)
+			return err
+		}
+	}
+
+	return nil
+}
+
+type migration struct {
+	name  string
+	query string
+}
+
+// The order matters: moods come before the posts and reactions that point at them, and new tables after the
+// ones they reference.
+var migrations = []migration{
+	{"users columns", `ALTER TABLE users
+						ADD COLUMN IF NOT EXISTS role VARCHAR(15) DEFAULT 'user',
+						ADD COLUMN IF NOT EXISTS handle VARCHAR(30),
+						ADD COLUMN IF NOT EXISTS hide_activity INT DEFAULT 0,
+						ADD COLUMN IF NOT EXISTS auto_subscribe INT DEFAULT 1,
+						ADD COLUMN IF NOT EXISTS digest VARCHAR(10) DEFAULT 'weekly',
+						ADD COLUMN IF NOT EXISTS last_digest_at TEXT;`},
+	// Existing users get their handles from users.BackfillHandles
+	{"users handle", `DO $$
+						BEGIN
+							IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'users'::regclass AND conname = 'users_handle_key') THEN
+								ALTER TABLE users ADD CONSTRAINT users_handle_key UNIQUE (handle);
+							END IF;
+						END $$;`},
+	// The anonymous user was seeded with emails on, which sent replies and digests to a real address
+	{"users anonymous", `UPDATE users SET contact_me=0 WHERE user_id='anonymous@rantkit.com' AND contact_me<>0;`},
+
+	{"moods", `CREATE TABLE IF NOT EXISTS moods (mood_key VARCHAR(30) PRIMARY KEY, label VARCHAR(50) NOT NULL, intensity INT UNIQUE NOT NULL, color VARCHAR(20) NOT NULL, icon VARCHAR(20) NOT NULL, is_default BOOLEAN NOT NULL DEFAULT false);`},
+	{"idx_moods_default", `CREATE UNIQUE INDEX IF NOT EXISTS idx_moods_default ON moods (is_default) WHERE is_default;`},
+	// Only an empty scale is seeded, moderators may have changed it since
+	{"moods seed", `INSERT INTO moods (mood_key, label, intensity, color, icon, is_default)
+					SELECT * FROM (VALUES ` + defaultMoods + `) AS seeds
+					WHERE NOT EXISTS (SELECT 1 FROM moods);`},
+
+	{"posts columns", `ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_at TEXT, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(255);`},
+	// Moods used to be free text, checked loosely: anything that isn't on the scale becomes the default mood
+	{"posts mood", `DO $$
+						BEGIN
+							IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'posts'::regclass AND conname = 'posts_mood_fkey') THEN
+								UPDATE posts SET mood = LOWER(TRIM(mood)) WHERE LOWER(TRIM(mood)) IN (SELECT mood_key FROM moods);
+								UPDATE posts SET mood = (SELECT mood_key FROM moods WHERE is_default)
+								WHERE mood IS NULL OR mood NOT IN (SELECT mood_key FROM moods);
+
+								ALTER TABLE posts ALTER COLUMN mood TYPE VARCHAR(30),
+									ALTER COLUMN mood SET NOT NULL,
+									ADD CONSTRAINT posts_mood_fkey FOREIGN KEY (mood) REFERENCES moods(mood_key) ON UPDATE CASCADE;
+							END IF;
+						END $$;`},
+	{"posts mood default", `ALTER TABLE posts ALTER COLUMN mood SET DEFAULT 'neutral';`},
+
+	{"comments columns", `ALTER TABLE comments ADD COLUMN IF NOT EXISTS edited_at TEXT, ADD COLUMN IF NOT EXISTS deleted_at TEXT, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(255);`},
+	{"tags columns", `ALTER TABLE tags ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';`},
+
+	// Likes became mood reactions: every like turns into the mildest positive mood (the neutral default if the
+	// scale has none), and duplicate likes by one user are dropped.
+	{"posts_likes", `DO $$
+						BEGIN
+							IF to_regclass('posts_likes') IS NOT NULL AND to_regclass('posts_reactions') IS NULL THEN
+								ALTER TABLE posts_likes RENAME TO posts_reactions;
+								ALTER TABLE posts_reactions RENAME COLUMN like_id TO reaction_id;
+								ALTER TABLE posts_reactions RENAME CONSTRAINT posts_likes_pkey TO posts_reactions_pkey;
+								ALTER TABLE posts_reactions RENAME CONSTRAINT posts_likes_user_id_fkey TO posts_reactions_user_id_fkey;
+								ALTER TABLE posts_reactions RENAME CONSTRAINT posts_likes_post_id_fkey TO posts_reactions_post_id_fkey;
+								ALTER TABLE posts_reactions ADD COLUMN reaction VARCHAR(30) REFERENCES moods(mood_key) ON UPDATE CASCADE, ADD COLUMN created_at TEXT;
+
+								DELETE FROM posts_reactions WHERE user_id IS NULL OR post_id IS NULL;
+								DELETE FROM posts_reactions AS a USING posts_reactions AS b
+								WHERE a.post_id = b.post_id AND a.user_id = b.user_id AND a.reaction_id > b.reaction_id;
+								UPDATE posts_reactions SET reaction = COALESCE(
+									(SELECT mood_key FROM moods WHERE intensity > 0 ORDER BY intensity LIMIT 1),
+									(SELECT mood_key FROM moods WHERE is_default)
+								);
+
+								ALTER TABLE posts_reactions DROP COLUMN score,
+									ALTER COLUMN reaction SET NOT NULL,
+									ALTER COLUMN user_id SET NOT NULL,
+									ALTER COLUMN post_id SET NOT NULL;
+								DROP INDEX IF EXISTS idx_posts_likes_post_id;
+							END IF;
+						END $$;`},
+	{"posts_reactions", `CREATE TABLE IF NOT EXISTS posts_reactions (reaction_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, post_id VARCHAR(255) NOT NULL REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, reaction VARCHAR(30) NOT NULL REFERENCES moods(mood_key) ON UPDATE CASCADE, created_at TEXT);`},
+	{"idx_posts_reactions_post_user", `CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_reactions_post_user ON posts_reactions (post_id, user_id);`},
+
+	{"revisions", `CREATE TABLE IF NOT EXISTS revisions (revision_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, post_id VARCHAR(255) REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, comment_id INT REFERENCES comments(comment_id) ON DELETE CASCADE ON UPDATE CASCADE, field VARCHAR(15) NOT NULL, content TEXT, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, created_at TEXT);`},
+	{"idx_revisions_post_id", `CREATE INDEX IF NOT EXISTS idx_revisions_post_id ON revisions (post_id);`},
+
+	{"attachments", `CREATE TABLE IF NOT EXISTS attachments (attachment_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, post_id VARCHAR(255) NOT NULL REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, comment_id INT REFERENCES comments(comment_id) ON DELETE CASCADE ON UPDATE CASCADE, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, blob_hash VARCHAR(64) NOT NULL, width INT, height INT, created_at TEXT);`},
+	{"idx_attachments_post_id", `CREATE INDEX IF NOT EXISTS idx_attachments_post_id ON attachments (post_id);`},
+
+	{"notifications", `CREATE TABLE IF NOT EXISTS notifications (notification_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, actor_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, type VARCHAR(30) NOT NULL, post_id VARCHAR(255) REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, comment_id INT REFERENCES comments(comment_id) ON DELETE CASCADE ON UPDATE CASCADE, count INT DEFAULT 1, created_at TEXT, read_at TEXT);`},
+	{"idx_notifications_user_id", `CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications (user_id, read_at);`},
+	{"notifications columns", `ALTER TABLE notifications ADD COLUMN IF NOT EXISTS count INT DEFAULT 1;`},
+
+	{"job_schedules", `CREATE TABLE IF NOT EXISTS job_schedules (name VARCHAR(100) PRIMARY KEY, kind VARCHAR(100) NOT NULL, interval_seconds INT NOT NULL, next_run_at TIMESTAMPTZ NOT NULL, last_run_at TIMESTAMPTZ);`},
+	{"jobs", `CREATE TABLE IF NOT EXISTS jobs (job_id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, kind VARCHAR(100) NOT NULL, payload JSONB NOT NULL, status VARCHAR(10) NOT NULL, attempts INT DEFAULT 0, max_attempts INT NOT NULL, run_at TIMESTAMPTZ NOT NULL, locked_at TIMESTAMPTZ, last_error TEXT, created_at TIMESTAMPTZ NOT NULL, updated_at TIMESTAMPTZ NOT NULL, finished_at TIMESTAMPTZ);`},
+	{"idx_jobs_run_at", `CREATE INDEX IF NOT EXISTS idx_jobs_run_at ON jobs (run_at) WHERE status = 'queued';`},
+
+	{"mentions", `CREATE TABLE IF NOT EXISTS mentions (mention_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, comment_id INT REFERENCES comments(comment_id) ON DELETE CASCADE ON UPDATE CASCADE, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, created_at TEXT, UNIQUE (comment_id, user_id));`},
+	{"idx_mentions_user_id", `CREATE INDEX IF NOT EXISTS idx_mentions_user_id ON mentions (user_id);`},
+
+	{"follows", `CREATE TABLE IF NOT EXISTS follows (follow_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, follower_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, followee_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, created_at TEXT, UNIQUE (follower_id, followee_id));`},
+	{"idx_follows_followee_id", `CREATE INDEX IF NOT EXISTS idx_follows_followee_id ON follows (followee_id);`},
+	{"tags_follows", `CREATE TABLE IF NOT EXISTS tags_follows (tags_follow_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, tag_id INT REFERENCES tags(tag_id) ON DELETE CASCADE ON UPDATE CASCADE, created_at TEXT, UNIQUE (user_id, tag_id));`},
+
+	{"user_relations", `CREATE TABLE IF NOT EXISTS user_relations (relation_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, target_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, kind VARCHAR(10) NOT NULL, created_at TEXT, UNIQUE (user_id, target_id));`},
+	{"idx_user_relations_target_id", `CREATE INDEX IF NOT EXISTS idx_user_relations_target_id ON user_relations (target_id);`},
+
+	{"bookmark_collections", `CREATE TABLE IF NOT EXISTS bookmark_collections (collection_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, name VARCHAR(50) NOT NULL, created_at TEXT, UNIQUE (user_id, name));`},
+	{"bookmarks", `CREATE TABLE IF NOT EXISTS bookmarks (bookmark_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, post_id VARCHAR(255) NOT NULL, comment_id INT, collection_id INT REFERENCES bookmark_collections(collection_id) ON DELETE SET NULL, title TEXT, excerpt TEXT, created_at TEXT);`},
+	{"idx_bookmarks_post_id", `CREATE INDEX IF NOT EXISTS idx_bookmarks_post_id ON bookmarks (post_id);`},
+	{"idx_bookmarks_user_post", `CREATE UNIQUE INDEX IF NOT EXISTS idx_bookmarks_user_post ON bookmarks (user_id, post_id) WHERE comment_id IS NULL;`},
+	{"idx_bookmarks_user_comment", `CREATE UNIQUE INDEX IF NOT EXISTS idx_bookmarks_user_comment ON bookmarks (user_id, comment_id) WHERE comment_id IS NOT NULL;`},
+
+	{"posts_subscriptions", `CREATE TABLE IF NOT EXISTS posts_subscriptions (subscription_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, post_id VARCHAR(255) REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, subscribed BOOLEAN NOT NULL DEFAULT true, created_at TEXT, UNIQUE (user_id, post_id));`},
+	{"idx_posts_subscriptions_post_id", `CREATE INDEX IF NOT EXISTS idx_posts_subscriptions_post_id ON posts_subscriptions (post_id);`},
+
+	{"conversations", `CREATE TABLE IF NOT EXISTS conversations (conversation_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_a VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, user_b VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, created_at TEXT, last_message_at TEXT, UNIQUE (user_a, user_b), CHECK (user_a < user_b));`},
+	{"idx_conversations_user_b", `CREATE INDEX IF NOT EXISTS idx_conversations_user_b ON conversations (user_b);`},
+	{"messages", `CREATE TABLE IF NOT EXISTS messages (message_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, conversation_id INT NOT NULL REFERENCES conversations(conversation_id) ON DELETE CASCADE, sender_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, content TEXT NOT NULL, created_at TEXT, read_at TEXT);`},
+	{"idx_messages_conversation_id", `CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages (conversation_id, message_id);`},
+	{"idx_messages_sender_id", `CREATE INDEX IF NOT EXISTS idx_messages_sender_id ON messages (sender_id);`},
+
+	{"mood_changes", `CREATE TABLE IF NOT EXISTS mood_changes (change_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, post_id VARCHAR(255) NOT NULL REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, from_mood VARCHAR(30) NOT NULL REFERENCES moods(mood_key) ON UPDATE CASCADE, to_mood VARCHAR(30) NOT NULL REFERENCES moods(mood_key) ON UPDATE CASCADE, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, created_at TEXT);`},
+	{"idx_mood_changes_post_id", `CREATE INDEX IF NOT EXISTS idx_mood_changes_post_id ON mood_changes (post_id, change_id);`},
+
+	{"tag_synonyms", `CREATE TABLE IF NOT EXISTS tag_synonyms (synonym VARCHAR(30) PRIMARY KEY, tag_id INT NOT NULL REFERENCES tags(tag_id) ON DELETE CASCADE ON UPDATE CASCADE, created_at TEXT);`},
+
+	{"filter_presets", `CREATE TABLE IF NOT EXISTS filter_presets (preset_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, name VARCHAR(60) NOT NULL, query TEXT NOT NULL DEFAULT '', is_default BOOLEAN NOT NULL DEFAULT false, created_at TEXT, UNIQUE (user_id, name));`},
+	{"idx_filter_presets_default", `CREATE UNIQUE INDEX IF NOT EXISTS idx_filter_presets_default ON filter_presets (user_id) WHERE is_default;`},
+}
@@ -0,0 +1,129 @@
+package database_test
+
+import (
+	"slices"
+	"testing"
+
+	"gorant/database"
+	"gorant/database/dbtest"
+)
+
+// baselineSchema is what Reset created before any migrations, the oldest databases out there.
+var baselineSchema = []string{
+	`CREATE TABLE users (user_id VARCHAR(255) PRIMARY KEY, email VARCHAR(100) NOT NULL, preferred_name VARCHAR(255) DEFAULT '', contact_me INT DEFAULT 1, avatar VARCHAR(255) DEFAULT 'default', sort_comments VARCHAR(15) DEFAULT 'upvote;desc');`,
+	`CREATE TABLE posts (post_id VARCHAR(255) PRIMARY KEY, post_title VARCHAR(255) NOT NULL, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, description VARCHAR(255) DEFAULT '', protected INT DEFAULT 0, created_at TEXT, mood VARCHAR(15) DEFAULT 'neutral');`,
+	`CREATE TABLE comments (comment_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, content TEXT, created_at TEXT, post_id VARCHAR(255), FOREIGN KEY(post_id) REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE);`,
+	`CREATE INDEX idx_comments_post_id ON comments (post_id);`,
+	`CREATE TABLE posts_likes (like_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE ON UPDATE CASCADE, post_id VARCHAR(255) REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, score INT);`,
+	`CREATE INDEX idx_posts_likes_post_id ON posts_likes (post_id);`,
+	`CREATE TABLE comments_votes (vote_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE SET NULL ON UPDATE CASCADE, comment_id INT REFERENCES comments(comment_id) ON DELETE CASCADE ON UPDATE CASCADE, score INT);`,
+	`CREATE INDEX idx_comments_votes_comment_id ON comments_votes (comment_id);`,
+	`CREATE TABLE tags (tag_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, tag VARCHAR(30) UNIQUE NOT NULL);`,
+	`CREATE TABLE posts_tags (posts_tags_id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY, post_id VARCHAR(255) REFERENCES posts(post_id) ON DELETE CASCADE ON UPDATE CASCADE, tag_id INT REFERENCES tags(tag_id) ON DELETE CASCADE ON UPDATE CASCADE);`,
+	`INSERT INTO users (user_id, email, preferred_name) VALUES ('anonymous@rantkit.com', 'anonymous@rantkit.com', 'anonymous')`,
+}
+
+// schema lists the columns, constraints and indexes of every table, one line each, sorted.
+func schema(t *testing.T) []string {
+	t.Helper()
+
+	// Newer Postgres versions also list NOT NULL as constraints (contype 'n'), the columns show it already
+	var lines []string
+	err := database.DB.Select(&lines, `SELECT table_name || '.' || column_name || ' ' || data_type || COALESCE('(' || character_maximum_length || ')', '') ||
+											CASE WHEN is_nullable = 'NO' THEN ' NOT NULL' ELSE '' END ||
+											COALESCE(' DEFAULT ' || column_default, '') || CASE WHEN is_identity = 'YES' THEN ' IDENTITY' ELSE '' END
+										FROM information_schema.columns
+										WHERE table_schema = current_schema()
+										UNION ALL
+										SELECT conrelid::regclass::TEXT || ' ' || conname || ' ' || pg_get_constraintdef(oid)
+										FROM pg_constraint
+										WHERE connamespace = current_schema()::regnamespace AND contype <> 'n'
+										UNION ALL
+										SELECT indexdef
+										FROM pg_indexes
+										WHERE schemaname = current_schema()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(lines)
+	return lines
+}
+
+func TestMigrateBaseline(t *testing.T) {
+	dbtest.Connect(t)
+
+	// Start from a clean slate, Reset only drops the tables it knows about
+	if err := database.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	want := schema(t)
+
+	// dbtest.Connect made sure this is the test database, never the app's
+	if _, err := database.DB.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public;`); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range append(baselineSchema,
+		`INSERT INTO users (user_id, email) VALUES ('alice', 'alice@example.com'), ('bob', 'bob@example.com')`,
+		`INSERT INTO posts (post_id, post_title, user_id, created_at, mood) VALUES
+			('a', 'a', 'alice', '2024-01-01T00:00:00Z', 'happy'),
+			('b', 'b', 'alice', '2024-01-01T00:00:00Z', 'Angry '),
+			('c', 'c', 'bob', '2024-01-01T00:00:00Z', 'ang'),
+			('d', 'd', 'bob', '2024-01-01T00:00:00Z', NULL)`,
+		`INSERT INTO posts_likes (user_id, post_id, score) VALUES
+			('alice', 'a', 1), ('alice', 'a', 1), ('bob', 'a', 1), ('bob', 'c', 1), (NULL, 'c', 1)`,
+	) {
+		if _, err := database.DB.Exec(q); err != nil {
+			t.Fatalf("%v\n%s", err, q)
+		}
+	}
+
+	// Twice, it runs on every start
+	for i := 0; i < 2; i++ {
+		if err := database.Migrate(); err != nil {
+			t.Fatalf("Migrate run %d: %v", i+1, err)
+		}
+	}
+
+	type reaction struct {
+		UserID   string `db:"user_id"`
+		PostID   string `db:"post_id"`
+		Reaction string `db:"reaction"`
+	}
+	var reactions []reaction
+	if err := database.DB.Select(&reactions, `SELECT user_id, post_id, reaction FROM posts_reactions ORDER BY post_id, user_id`); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(reactions, []reaction{{"alice", "a", "happy"}, {"bob", "a", "happy"}, {"bob", "c", "happy"}}) {
+		t.Errorf("likes became reactions %+v, want one happy reaction per user and post", reactions)
+	}
+
+	var postMoods []string
+	if err := database.DB.Select(&postMoods, `SELECT post_id || '=' || mood FROM posts ORDER BY post_id`); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(postMoods, []string{"a=happy", "b=angry", "c=neutral", "d=neutral"}) {
+		t.Errorf("post moods after migrating = %v", postMoods)
+	}
+
+	var contactMe int
+	if err := database.DB.Get(&contactMe, `SELECT contact_me FROM users WHERE user_id='anonymous@rantkit.com'`); err != nil {
+		t.Fatal(err)
+	}
+	if contactMe != 0 {
+		t.Errorf("anonymous user has contact_me=%d after migrating, want emails off", contactMe)
+	}
+
+	if got := schema(t); !slices.Equal(got, want) {
+		for _, l := range got {
+			if !slices.Contains(want, l) {
+				t.Errorf("migrated schema has %s", l)
+			}
+		}
+		for _, l := range want {
+			if !slices.Contains(got, l) {
+				t.Errorf("migrated schema lacks %s", l)
+			}
+		}
+	}
+}
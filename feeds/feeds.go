@@ -0,0 +1,304 @@
+package feeds
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorant/posts"
+)
+
+// BaseURL is the public address of the site, feed readers need absolute links.
+var BaseURL = "http://localhost:7000"
+
+// MaxItems is how many entries a feed has at most, the newest ones.
+const MaxItems = 50
+
+// Formats a feed can be encoded in, also the extension of its URL
+const (
+	RSS  = "rss"
+	Atom = "atom"
+)
+
+var ErrUnknownFormat = errors.New("error: unknown feed format")
+
+type Feed struct {
+	Title       string
+	Link        string // Path of the page the feed follows, e.g. "/tags/work"
+	Self        string // Path and query of the feed itself
+	Description string
+	Items       []Item
+}
+
+type Item struct {
+	ID         string // Path of the entry's page, unique within the site
+	Title      string
+	Author     string
+	Content    string // HTML
+	Categories []string
+	Published  time.Time
+	Updated    time.Time // When it was last edited, the same as Published if it never was
+}
+
+// FromPosts turns a post list into feed items, up to MaxItems of them. edited has the times posts were last
+// edited at, see posts.LastEdited.
+func FromPosts(list posts.PostCollection, edited map[string]time.Time) []Item {
+	items := make([]Item, 0, min(len(list), MaxItems))
+	for _, p := range list {
+		if len(items) == MaxItems {
+			break
+		}
+
+		published, _ := time.Parse(time.RFC3339, p.CreatedAt.CreatedAtString)
+		updated := published
+		if t, ok := edited[p.ID]; ok && t.After(published) {
+			updated = t
+		}
+
+		var content string
+		if p.Description != "" {
+			content = "<p>" + html.EscapeString(p.Description) + "</p>"
+		}
+
+		items = append(items, Item{
+			ID:         "/posts/" + p.ID,
+			Title:      p.Title,
+			Author:     p.PreferredName,
+			Content:    content,
+			Categories: p.Tags.Tags,
+			Published:  published,
+			Updated:    updated,
+		})
+	}
+
+	return items
+}
+
+// Updated is when the feed last changed: the newest publication or edit of its items, zero for an empty feed.
+func (f Feed) Updated() time.Time {
+	var t time.Time
+	for _, it := range f.Items {
+		t = latest(t, it.Published, it.Updated)
+	}
+
+	return t
+}
+
+func latest(times ...time.Time) time.Time {
+	var t time.Time
+	for _, u := range times {
+		if u.After(t) {
+			t = u
+		}
+	}
+
+	return t
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	DC      string     `xml:"xmlns:dc,attr"` // Dublin Core, RSS has no element for an author without an email
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        string   `xml:"guid"`
+	Author      string   `xml:"dc:creator,omitempty"`
+	Description string   `xml:"description,omitempty"`
+	Categories  []string `xml:"category"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+// RSS encodes the feed as RSS 2.0. RSS has no edit time per item, only the channel's lastBuildDate.
+func (f Feed) RSS() ([]byte, error) {
+	ch := rssChannel{
+		Title:       f.Title,
+		Link:        BaseURL + f.Link,
+		Description: f.Description,
+	}
+	if updated := f.Updated(); !updated.IsZero() {
+		ch.LastBuildDate = updated.Format(time.RFC1123Z)
+	}
+
+	for _, it := range f.Items {
+		ch.Items = append(ch.Items, rssItem{
+			Title:       it.Title,
+			Link:        BaseURL + it.ID,
+			GUID:        BaseURL + it.ID,
+			Author:      it.Author,
+			Description: it.Content,
+			Categories:  it.Categories,
+			PubDate:     it.Published.Format(time.RFC1123Z),
+		})
+	}
+
+	return encode(rss{Version: "2.0", DC: "http://purl.org/dc/elements/1.1/", Channel: ch})
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Author   atomAuthor  `xml:"author"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Author     *atomAuthor    `xml:"author,omitempty"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Categories []atomCategory `xml:"category"`
+	Content    *atomContent   `xml:"content,omitempty"`
+}
+
+// Atom encodes the feed as Atom 1.0. Entries without an author fall back to the feed's, the site.
+func (f Feed) Atom() ([]byte, error) {
+	feed := atomFeed{
+		ID:       BaseURL + f.Link,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		Updated:  f.Updated().UTC().Format(time.RFC3339),
+		Author:   atomAuthor{Name: "Grumplr"},
+		Links:    []atomLink{{Href: BaseURL + f.Link, Rel: "alternate"}},
+	}
+	if f.Self != "" {
+		feed.Links = append(feed.Links, atomLink{Href: BaseURL + f.Self, Rel: "self"})
+	}
+
+	for _, it := range f.Items {
+		e := atomEntry{
+			ID:        BaseURL + it.ID,
+			Title:     it.Title,
+			Link:      atomLink{Href: BaseURL + it.ID, Rel: "alternate"},
+			Published: it.Published.UTC().Format(time.RFC3339),
+			Updated:   latest(it.Published, it.Updated).UTC().Format(time.RFC3339),
+		}
+		if it.Author != "" {
+			e.Author = &atomAuthor{Name: it.Author}
+		}
+		for _, c := range it.Categories {
+			e.Categories = append(e.Categories, atomCategory{Term: c})
+		}
+		if it.Content != "" {
+			e.Content = &atomContent{Type: "html", Body: it.Content}
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+
+	return encode(feed)
+}
+
+func encode(v any) ([]byte, error) {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), out...), nil
+}
+
+// Encode encodes the feed in format and returns it with its content type.
+func (f Feed) Encode(format string) ([]byte, string, error) {
+	switch format {
+	case RSS:
+		out, err := f.RSS()
+		return out, "application/rss+xml; charset=utf-8", err
+	case Atom:
+		out, err := f.Atom()
+		return out, "application/atom+xml; charset=utf-8", err
+	}
+
+	return nil, "", ErrUnknownFormat
+}
+
+// Serve writes the feed in format, or just 304 Not Modified if the reader's copy, going by the ETag or
+// Last-Modified it sent back, is still current.
+func Serve(w http.ResponseWriter, r *http.Request, f Feed, format string) error {
+	if f.Self == "" {
+		f.Self = r.URL.RequestURI()
+	}
+	out, contentType, err := f.Encode(format)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(out)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	updated := f.Updated()
+
+	w.Header().Set("ETag", etag)
+	if !updated.IsZero() {
+		w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if notModified(r, etag, updated) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, err = w.Write(out)
+	return err
+}
+
+// notModified checks the conditional GET headers. If-None-Match wins over If-Modified-Since when both are sent.
+func notModified(r *http.Request, etag string, updated time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || updated.IsZero() {
+		return false
+	}
+
+	// HTTP dates only have whole seconds
+	return !updated.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,167 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gorant/posts"
+)
+
+func TestFromPosts(t *testing.T) {
+	var list posts.PostCollection
+	for i := 0; i < MaxItems+5; i++ {
+		p := posts.ZPost{ID: fmt.Sprint(i), Title: "rant", PreferredName: "jo"}
+		p.CreatedAt.CreatedAtString = time.Date(2024, 1, 1, i, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		p.Tags.Tags = []string{"work"}
+		list = append(list, p)
+	}
+
+	edited := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	items := FromPosts(list, map[string]time.Time{"3": edited})
+	if len(items) != MaxItems {
+		t.Fatalf("FromPosts returned %d items, want %d", len(items), MaxItems)
+	}
+	if items[3].ID != "/posts/3" || items[3].Author != "jo" || items[3].Published.Hour() != 3 || !items[3].Updated.Equal(edited) {
+		t.Errorf("FromPosts item = %+v", items[3])
+	}
+	if !items[4].Updated.Equal(items[4].Published) {
+		t.Errorf("FromPosts unedited item updated %v, published %v", items[4].Updated, items[4].Published)
+	}
+}
+
+func TestRSS(t *testing.T) {
+	newest := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	f := Feed{
+		Title: "Grumplr & co",
+		Link:  "/",
+		Items: []Item{
+			{ID: "/posts/a", Title: "<script>", Author: "jo", Categories: []string{"work", "boss"}, Published: newest.Add(-time.Hour)},
+			{ID: "/posts/b", Title: "b", Published: newest},
+		},
+	}
+
+	out, err := f.RSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Channel struct {
+			Title         string `xml:"title"`
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				Title      string   `xml:"title"`
+				Link       string   `xml:"link"`
+				Categories []string `xml:"category"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(out, &got); err != nil {
+		t.Fatalf("RSS isn't valid XML: %v\n%s", err, out)
+	}
+
+	if got.Channel.Title != f.Title || got.Channel.LastBuildDate != newest.Format(time.RFC1123Z) {
+		t.Errorf("RSS channel = %+v", got.Channel)
+	}
+	if len(got.Channel.Items) != 2 || got.Channel.Items[0].Title != "<script>" || got.Channel.Items[0].Link != BaseURL+"/posts/a" || len(got.Channel.Items[0].Categories) != 2 {
+		t.Errorf("RSS items = %+v", got.Channel.Items)
+	}
+}
+
+func TestAtom(t *testing.T) {
+	published := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	f := Feed{
+		Title: "Comments",
+		Link:  "/posts/a",
+		Self:  "/posts/a/comments/feed.atom",
+		Items: []Item{
+			{ID: "/posts/a#post-1", Title: "jo on a", Author: "jo", Content: "<p>hi &amp; bye</p>", Published: published, Updated: published.Add(time.Hour)},
+			{ID: "/posts/a#post-2", Title: "anonymous", Published: published},
+		},
+	}
+
+	out, err := f.Atom()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Updated string   `xml:"updated"`
+		Links   []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Entries []struct {
+			ID      string `xml:"id"`
+			Updated string `xml:"updated"`
+			Author  struct {
+				Name string `xml:"name"`
+			} `xml:"author"`
+			Content string `xml:"content"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(out, &got); err != nil {
+		t.Fatalf("Atom isn't valid XML: %v\n%s", err, out)
+	}
+
+	if got.Updated != "2024-03-04T06:06:07Z" {
+		t.Errorf("Atom feed updated = %q", got.Updated)
+	}
+	if len(got.Links) != 2 || got.Links[1].Rel != "self" || got.Links[1].Href != BaseURL+f.Self {
+		t.Errorf("Atom links = %+v", got.Links)
+	}
+	if len(got.Entries) != 2 || got.Entries[0].Content != "<p>hi &amp; bye</p>" || got.Entries[0].Author.Name != "jo" || got.Entries[1].Updated != "2024-03-04T05:06:07Z" {
+		t.Errorf("Atom entries = %+v", got.Entries)
+	}
+}
+
+func TestServe(t *testing.T) {
+	updated := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	f := Feed{Title: "Grumplr", Link: "/", Items: []Item{{ID: "/posts/a", Title: "a", Published: updated}}}
+
+	serve := func(header string, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/feeds/posts.atom", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		if err := Serve(w, r, f, Atom); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	first := serve("", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || !strings.HasPrefix(first.Header().Get("Content-Type"), "application/atom+xml") {
+		t.Fatalf("first request: %d, headers %v", first.Code, first.Header())
+	}
+	if first.Header().Get("Last-Modified") != "Mon, 04 Mar 2024 05:06:07 GMT" {
+		t.Errorf("Last-Modified = %q", first.Header().Get("Last-Modified"))
+	}
+
+	for _, tt := range []struct {
+		header, value string
+		want          int
+	}{
+		{"If-None-Match", etag, http.StatusNotModified},
+		{"If-None-Match", `"other", W/` + etag, http.StatusNotModified},
+		{"If-None-Match", `"other"`, http.StatusOK},
+		{"If-Modified-Since", "Mon, 04 Mar 2024 05:06:07 GMT", http.StatusNotModified},
+		{"If-Modified-Since", "Mon, 04 Mar 2024 05:06:06 GMT", http.StatusOK},
+	} {
+		if w := serve(tt.header, tt.value); w.Code != tt.want {
+			t.Errorf("%s: %s = %d, want %d", tt.header, tt.value, w.Code, tt.want)
+		}
+	}
+
+	if err := Serve(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), f, "json"); err != ErrUnknownFormat {
+		t.Errorf("Serve unknown format error = %v", err)
+	}
+}
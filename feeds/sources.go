@@ -0,0 +1,125 @@
+package feeds
+
+import (
+	"errors"
+	"time"
+
+	"gorant/markdown"
+	"gorant/posts"
+	"gorant/users"
+)
+
+// The feeds below are what feed readers see, who aren't logged in: nobody is muted and hidden activity stays hidden.
+
+var ErrNotFound = errors.New("error: feed not found")
+
+// Front follows the front page, narrowed down by a filter the way filter presets and shared links are.
+func Front(filter posts.Filter) (Feed, error) {
+	f := Feed{Title: "Grumplr", Link: "/", Description: "The latest rants on Grumplr"}
+	if !filter.IsZero() {
+		f.Title = "Grumplr - Filtered rants"
+		f.Link = "/?" + filter.Values().Encode()
+	}
+
+	list, err := posts.ListLatestPosts(filter, MaxItems)
+	if err != nil {
+		return f, err
+	}
+
+	f.Items, err = postItems(list)
+	return f, err
+}
+
+func Tag(name string) (Feed, error) {
+	tag, err := posts.GetTag(name)
+	if errors.Is(err, posts.ErrTagNotFound) {
+		return Feed{}, ErrNotFound
+	}
+	if err != nil {
+		return Feed{}, err
+	}
+
+	f := Feed{Title: "Grumplr - #" + tag.Tag, Link: "/tags/" + tag.Tag, Description: tag.Description}
+	if f.Description == "" {
+		f.Description = "The latest rants tagged " + tag.Tag
+	}
+
+	list, err := posts.ListLatestPosts(posts.Filter{Tags: []string{tag.Tag}}, MaxItems)
+	if err != nil {
+		return f, err
+	}
+
+	f.Items, err = postItems(list)
+	return f, err
+}
+
+func User(handle string) (Feed, error) {
+	profile, err := users.GetProfile(handle)
+	if err != nil || profile.HideActivity {
+		return Feed{}, ErrNotFound
+	}
+
+	f := Feed{Title: "Grumplr - " + profile.PreferredName, Link: "/users/" + profile.Handle, Description: "The latest rants by " + profile.PreferredName}
+
+	list, err := posts.ListLatestPosts(posts.Filter{Author: profile.Handle}, MaxItems)
+	if err != nil {
+		return f, err
+	}
+
+	f.Items, err = postItems(list)
+	return f, err
+}
+
+// Comments follows the discussion of a post, newest comments first.
+func Comments(postID string) (Feed, error) {
+	post, err := posts.GetPost(postID, "")
+	if errors.Is(err, posts.ErrPostNotFound) {
+		return Feed{}, ErrNotFound
+	}
+	if err != nil {
+		return Feed{}, err
+	}
+
+	f := Feed{Title: "Comments on " + post.Title, Link: "/posts/" + post.ID, Description: post.Description}
+
+	comments, err := posts.ListLatestComments(postID, MaxItems)
+	if err != nil {
+		return f, err
+	}
+
+	for _, c := range comments {
+		published, _ := time.Parse(time.RFC3339, c.CreatedAt)
+		updated := published
+		if c.EditedAt.Valid {
+			if t, err := time.Parse(time.RFC3339, c.EditedAt.String); err == nil {
+				updated = t
+			}
+		}
+
+		f.Items = append(f.Items, Item{
+			ID:        "/posts/" + post.ID + "#post-" + c.CommentID,
+			Title:     c.PreferredName + " on " + post.Title,
+			Author:    c.PreferredName,
+			Content:   markdown.Render(c.Content),
+			Published: published,
+			Updated:   updated,
+		})
+	}
+
+	return f, nil
+}
+
+// postItems turns posts into items with the times they were last edited.
+func postItems(list posts.PostCollection) ([]Item, error) {
+	ids := make([]string, 0, min(len(list), MaxItems))
+	for _, p := range list[:min(len(list), MaxItems)] {
+		ids = append(ids, p.ID)
+	}
+
+	edited, err := posts.LastEdited(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromPosts(list, edited), nil
+}
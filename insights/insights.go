@@ -0,0 +1,299 @@
+package insights
+
+import (
+	"database/sql"
+	"time"
+
+	"gorant/database"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	// Shown when no range is picked
+	defaultDays = 90
+	// Longest range that can be picked, the timeline switches to monthly buckets long before this
+	maxDays = 5 * 366
+	// Tags listed per mood
+	topTags = 3
+	// Tags shown in the average mood by tag chart
+	tagLimit = 15
+)
+
+// Filter picks the posts the insights are computed over: created in [From, To), by UserID if it's set.
+type Filter struct {
+	From   time.Time
+	To     time.Time
+	UserID string
+}
+
+// ParseFilter reads the from and to dates (2006-01-02, both inclusive) of the date range filter. Empty dates
+// default to the last 90 days. It returns a message for the form when the range isn't valid.
+func ParseFilter(from string, to string, now time.Time) (Filter, string) {
+	var f Filter
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	f.To = today.AddDate(0, 0, 1)
+	if to != "" {
+		t, err := time.ParseInLocation(dateLayout, to, time.Local)
+		if err != nil {
+			return f, "Please enter dates as YYYY-MM-DD."
+		}
+		f.To = t.AddDate(0, 0, 1)
+	}
+
+	f.From = f.To.AddDate(0, 0, -defaultDays)
+	if from != "" {
+		t, err := time.ParseInLocation(dateLayout, from, time.Local)
+		if err != nil {
+			return f, "Please enter dates as YYYY-MM-DD."
+		}
+		f.From = t
+	}
+
+	switch {
+	case !f.From.Before(f.To):
+		return f, "The start date needs to be before the end date."
+	case f.To.Sub(f.From) > maxDays*24*time.Hour:
+		return f, "Please pick a range of five years or less."
+	}
+
+	return f, ""
+}
+
+// FromString and ToString format the range back for the date inputs, To being the last day included.
+func (f Filter) FromString() string {
+	return f.From.Format(dateLayout)
+}
+
+func (f Filter) ToString() string {
+	return f.To.AddDate(0, 0, -1).Format(dateLayout)
+}
+
+// Interval is the bucket size of the timeline, as understood by date_trunc.
+func (f Filter) Interval() string {
+	switch d := f.To.Sub(f.From); {
+	case d <= 31*24*time.Hour:
+		return "day"
+	case d <= 366*24*time.Hour:
+		return "week"
+	default:
+		return "month"
+	}
+}
+
+// Bucket is one day, week or month of the timeline. Counts are keyed by mood.
+type Bucket struct {
+	Start  time.Time      `json:"start"`
+	Counts map[string]int `json:"counts"`
+	Total  int            `json:"total"`
+}
+
+type TagMood struct {
+	Tag     string  `json:"tag"`
+	Average float64 `json:"average_intensity"`
+	Posts   int     `json:"posts"`
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Posts int    `json:"posts"`
+}
+
+// Improvement compares the mood of commented posts when their first comment came in with their mood now.
+type Improvement struct {
+	Commented int `json:"commented"`
+	Improved  int `json:"improved"`
+	Worsened  int `json:"worsened"`
+}
+
+// Share returns the percentage of commented posts that improved.
+func (i Improvement) Share() int {
+	if i.Commented == 0 {
+		return 0
+	}
+
+	return i.Improved * 100 / i.Commented
+}
+
+type Insights struct {
+	From        string                `json:"from"`
+	To          string                `json:"to"`
+	Interval    string                `json:"interval"`
+	Posts       int                   `json:"posts"`
+	Totals      map[string]int        `json:"totals"`
+	Timeline    []Bucket              `json:"timeline"`
+	TagMoods    []TagMood             `json:"average_mood_by_tag"`
+	Improvement Improvement           `json:"improvement"`
+	TopTags     map[string][]TagCount `json:"top_tags_by_mood"`
+}
+
+// Every query below filters posts the same way, with $1 and $2 the date range and $3 the user ID or ''
+const where = `posts.deleted_at IS NULL
+				AND posts.created_at::TIMESTAMPTZ >= $1::TIMESTAMPTZ AND posts.created_at::TIMESTAMPTZ < $2::TIMESTAMPTZ
+				AND ($3 = '' OR posts.user_id = $3)`
+
+func (f Filter) args() []any {
+	return []any{f.From.Format(time.RFC3339), f.To.Format(time.RFC3339), f.UserID}
+}
+
+// Get computes every chart of the insights page for the posts f picks.
+func Get(f Filter) (Insights, error) {
+	in := Insights{From: f.FromString(), To: f.ToString(), Interval: f.Interval(), Totals: make(map[string]int)}
+
+	var err error
+	if in.Timeline, err = timeline(f); err != nil {
+		return in, err
+	}
+	for _, b := range in.Timeline {
+		for mood, n := range b.Counts {
+			in.Totals[mood] += n
+		}
+		in.Posts += b.Total
+	}
+
+	if in.TagMoods, err = tagMoods(f); err != nil {
+		return in, err
+	}
+	if in.Improvement, err = improvement(f); err != nil {
+		return in, err
+	}
+	if in.TopTags, err = topTagsByMood(f); err != nil {
+		return in, err
+	}
+
+	return in, nil
+}
+
+// timeline counts posts per mood in each bucket. Buckets without posts are kept, so the chart has no gaps.
+func timeline(f Filter) ([]Bucket, error) {
+	var buckets []Bucket
+
+	rows, err := database.DB.Query(`WITH buckets AS (
+										SELECT generate_series(date_trunc($4::TEXT, $1::TIMESTAMPTZ), $2::TIMESTAMPTZ - INTERVAL '1 second', ('1 ' || $4::TEXT)::INTERVAL) AS bucket
+									), counts AS (
+										SELECT date_trunc($4::TEXT, posts.created_at::TIMESTAMPTZ) AS bucket, posts.mood, COUNT(1) AS n
+										FROM posts
+										WHERE `+where+`
+										GROUP BY 1, 2
+									)
+									SELECT buckets.bucket, counts.mood, COALESCE(counts.n, 0),
+										COALESCE(SUM(counts.n) OVER (PARTITION BY buckets.bucket), 0)::INT AS total
+									FROM buckets
+										LEFT JOIN counts ON counts.bucket = buckets.bucket
+									ORDER BY buckets.bucket`, append(f.args(), f.Interval())...)
+	if err != nil {
+		return buckets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var start time.Time
+		var mood sql.NullString
+		var n, total int
+		if err := rows.Scan(&start, &mood, &n, &total); err != nil {
+			return buckets, err
+		}
+
+		if len(buckets) == 0 || !buckets[len(buckets)-1].Start.Equal(start) {
+			buckets = append(buckets, Bucket{Start: start, Counts: make(map[string]int), Total: total})
+		}
+		if mood.Valid {
+			buckets[len(buckets)-1].Counts[mood.String] = n
+		}
+	}
+
+	return buckets, rows.Err()
+}
+
+// tagMoods averages the intensity of the moods of each tag's posts, for the most used tags.
+func tagMoods(f Filter) ([]TagMood, error) {
+	var list []TagMood
+
+	rows, err := database.DB.Query(`SELECT tags.tag, AVG(moods.intensity)::FLOAT8, COUNT(1)
+									FROM posts
+										INNER JOIN moods ON moods.mood_key = posts.mood
+										INNER JOIN posts_tags ON posts_tags.post_id = posts.post_id
+										INNER JOIN tags ON tags.tag_id = posts_tags.tag_id
+									WHERE `+where+`
+									GROUP BY tags.tag
+									ORDER BY COUNT(1) DESC, tags.tag
+									LIMIT $4`, append(f.args(), tagLimit)...)
+	if err != nil {
+		return list, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TagMood
+		if err := rows.Scan(&t.Tag, &t.Average, &t.Posts); err != nil {
+			return list, err
+		}
+		list = append(list, t)
+	}
+
+	return list, rows.Err()
+}
+
+// improvement finds the mood each commented post had when its first comment arrived: the last change before
+// then, or the mood it was posted with.
+func improvement(f Filter) (Improvement, error) {
+	var i Improvement
+
+	err := database.DB.QueryRow(`WITH first_comments AS (
+										SELECT DISTINCT ON (comments.post_id) comments.post_id, comments.created_at::TIMESTAMPTZ AS at
+										FROM comments
+										WHERE comments.deleted_at IS NULL
+										ORDER BY comments.post_id, comments.created_at::TIMESTAMPTZ
+									), arcs AS (
+										SELECT posts.mood AS mood_now,
+											COALESCE(
+												(SELECT to_mood FROM mood_changes WHERE mood_changes.post_id = posts.post_id AND mood_changes.created_at::TIMESTAMPTZ <= first_comments.at ORDER BY change_id DESC LIMIT 1),
+												(SELECT from_mood FROM mood_changes WHERE mood_changes.post_id = posts.post_id ORDER BY change_id LIMIT 1),
+												posts.mood
+											) AS mood_then
+										FROM posts
+											INNER JOIN first_comments ON first_comments.post_id = posts.post_id
+										WHERE `+where+`
+									)
+									SELECT COUNT(1),
+										COUNT(1) FILTER (WHERE now_moods.intensity > then_moods.intensity),
+										COUNT(1) FILTER (WHERE now_moods.intensity < then_moods.intensity)
+									FROM arcs
+										INNER JOIN moods AS now_moods ON now_moods.mood_key = arcs.mood_now
+										INNER JOIN moods AS then_moods ON then_moods.mood_key = arcs.mood_then`, f.args()...).Scan(&i.Commented, &i.Improved, &i.Worsened)
+
+	return i, err
+}
+
+// topTagsByMood ranks tags within each mood by how many posts use them.
+func topTagsByMood(f Filter) (map[string][]TagCount, error) {
+	top := make(map[string][]TagCount)
+
+	rows, err := database.DB.Query(`SELECT mood, tag, n
+									FROM (
+										SELECT posts.mood, tags.tag, COUNT(1) AS n,
+											ROW_NUMBER() OVER (PARTITION BY posts.mood ORDER BY COUNT(1) DESC, tags.tag) AS rank
+										FROM posts
+											INNER JOIN posts_tags ON posts_tags.post_id = posts.post_id
+											INNER JOIN tags ON tags.tag_id = posts_tags.tag_id
+										WHERE `+where+`
+										GROUP BY posts.mood, tags.tag
+									) AS ranked
+									WHERE rank <= $4
+									ORDER BY mood, rank`, append(f.args(), topTags)...)
+	if err != nil {
+		return top, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mood string
+		var t TagCount
+		if err := rows.Scan(&mood, &t.Tag, &t.Posts); err != nil {
+			return top, err
+		}
+		top[mood] = append(top[mood], t)
+	}
+
+	return top, rows.Err()
+}
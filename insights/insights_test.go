@@ -0,0 +1,37 @@
+package insights
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	now := time.Date(2024, 6, 15, 18, 30, 0, 0, time.Local)
+
+	f, msg := ParseFilter("", "", now)
+	if msg != "" {
+		t.Fatalf("ParseFilter() with no dates = %q", msg)
+	}
+	if f.FromString() != "2024-03-18" || f.ToString() != "2024-06-15" {
+		t.Errorf("default range = %s to %s, want 2024-03-18 to 2024-06-15", f.FromString(), f.ToString())
+	}
+	if f.Interval() != "week" {
+		t.Errorf("Interval() = %q, want week", f.Interval())
+	}
+
+	f, msg = ParseFilter("2024-06-01", "2024-06-01", now)
+	if msg != "" || f.To.Sub(f.From) != 24*time.Hour || f.Interval() != "day" {
+		t.Errorf("single day = %v to %v, %q", f.From, f.To, msg)
+	}
+
+	for _, tt := range []struct{ from, to string }{
+		{"2024-06-02", "2024-06-01"},
+		{"06/01/2024", ""},
+		{"", "yesterday"},
+		{"2010-01-01", "2024-01-01"},
+	} {
+		if _, msg := ParseFilter(tt.from, tt.to, now); msg == "" {
+			t.Errorf("ParseFilter(%q, %q) accepted an invalid range", tt.from, tt.to)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"gorant/jobs"
+	"gorant/notifications"
+	"gorant/posts"
+	"gorant/uploads"
+)
+
+// Kinds for the periodic jobs. Jobs enqueued from a package, like notification emails, keep their kind next to their payload type there.
+const (
+	jobPurgeTrash       = "posts.purge_trash"
+	jobDeleteOrphanTags = "posts.delete_orphan_tags"
+	jobCollectUploads   = "uploads.collect_garbage"
+)
+
+const (
+	defaultJobWorkers   = 2
+	jobPollInterval     = 2 * time.Second
+	shutdownGracePeriod = 30 * time.Second
+	// Uploads younger than this may still be waiting on their post or comment to be created
+	uploadsGarbageGrace = 24 * time.Hour
+)
+
+// registerJobs sets up every job handler and schedule. It has to run before jobs.Start.
+func registerJobs() {
+	jobs.Register(notifications.JobEmailNow, func(ctx context.Context, p notifications.EmailNowJob) error {
+		return notifications.EmailNow(p.NotificationID)
+	})
+
+	jobs.Register(notifications.JobSendDigests, func(ctx context.Context, _ struct{}) error {
+		return notifications.SendDueDigests()
+	})
+
+	jobs.Register(posts.JobNotifySubscribers, func(ctx context.Context, p posts.SubscribersJob) error {
+		return posts.NotifySubscribers(p.PostID, p.CommentID, p.ActorID)
+	})
+
+	// Hard-delete anything left in the trash past the retention window
+	jobs.Register(jobPurgeTrash, func(ctx context.Context, _ struct{}) error {
+		return posts.PurgeTrash()
+	})
+
+	jobs.Register(jobDeleteOrphanTags, func(ctx context.Context, _ struct{}) error {
+		_, err := posts.DeleteOrphanTags()
+		return err
+	})
+
+	// Remove image blobs that nothing points at anymore
+	jobs.Register(jobCollectUploads, func(ctx context.Context, _ struct{}) error {
+		return uploads.CollectGarbage(uploadsGarbageGrace)
+	})
+
+	jobs.Every("send-digests", time.Hour, notifications.JobSendDigests, nil)
+	jobs.Every("purge-trash", time.Hour, jobPurgeTrash, nil)
+	jobs.Every("delete-orphan-tags", 6*time.Hour, jobDeleteOrphanTags, nil)
+	jobs.Every("collect-uploads", time.Hour, jobCollectUploads, nil)
+}
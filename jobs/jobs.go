@@ -0,0 +1,258 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"gorant/database"
+)
+
+// Job states. A job that keeps failing past its MaxAttempts is parked as dead for someone to look at in /admin/jobs.
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusDead    = "dead"
+)
+
+const (
+	defaultMaxAttempts = 5
+	// Running jobs have their lock renewed this often by their worker, see heartbeat
+	heartbeatEvery = time.Minute
+	// A running job whose lock wasn't renewed for this long belongs to a worker that died, and is queued again.
+	// Long jobs are fine, only a missing heartbeat counts.
+	staleAfter = 5 * heartbeatEvery
+	// Finished jobs are kept around for this long so /admin/jobs has some history
+	keepDone = 7 * 24 * time.Hour
+)
+
+type Job struct {
+	JobID       int64          `db:"job_id"`
+	Kind        string         `db:"kind"`
+	Payload     []byte         `db:"payload"`
+	Status      string         `db:"status"`
+	Attempts    int            `db:"attempts"`
+	MaxAttempts int            `db:"max_attempts"`
+	RunAt       time.Time      `db:"run_at"`
+	LastError   sql.NullString `db:"last_error"`
+	CreatedAt   time.Time      `db:"created_at"`
+}
+
+type handler func(ctx context.Context, payload []byte) error
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = make(map[string]handler)
+)
+
+// Register sets the function that runs jobs of the given kind. The payload is decoded from JSON into T,
+// so Enqueue should be passed the same type.
+func Register[T any](kind string, fn func(ctx context.Context, payload T) error) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+
+	handlers[kind] = func(ctx context.Context, raw []byte) error {
+		var p T
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return fmt.Errorf("decoding %s payload: %w", kind, err)
+		}
+		return fn(ctx, p)
+	}
+}
+
+// Enqueue adds a job to run as soon as a worker is free.
+func Enqueue(kind string, payload any) error {
+	return EnqueueAt(kind, payload, time.Now())
+}
+
+// EnqueueAt adds a job that won't run before runAt.
+func EnqueueAt(kind string, payload any, runAt time.Time) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec(`INSERT INTO jobs (kind, payload, status, max_attempts, run_at, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, now(), now())`, kind, b, StatusQueued, defaultMaxAttempts, runAt)
+	return err
+}
+
+// claim takes the next due job. SKIP LOCKED lets several workers (or several app instances) poll the same table
+// without handing the same job out twice.
+func claim() (Job, bool, error) {
+	var j Job
+	err := database.DB.QueryRow(`UPDATE jobs SET status=$1, attempts=attempts+1, locked_at=now(), updated_at=now()
+								WHERE job_id = (
+									SELECT job_id FROM jobs
+									WHERE status=$2 AND run_at <= now()
+									ORDER BY run_at
+									FOR UPDATE SKIP LOCKED
+									LIMIT 1
+								)
+								RETURNING job_id, kind, payload, attempts, max_attempts`, StatusRunning, StatusQueued).Scan(&j.JobID, &j.Kind, &j.Payload, &j.Attempts, &j.MaxAttempts)
+	if err == sql.ErrNoRows {
+		return j, false, nil
+	}
+
+	return j, err == nil, err
+}
+
+// backoff doubles from 10 seconds up to an hour, with some jitter so failed jobs don't all retry at once.
+func backoff(attempts int) time.Duration {
+	d := 10 * time.Second << min(attempts-1, 9)
+	d = min(d, time.Hour)
+
+	return d + rand.N(d/4+1)
+}
+
+func run(ctx context.Context, j Job) {
+	handlersMu.RLock()
+	h, ok := handlers[j.Kind]
+	handlersMu.RUnlock()
+
+	var err error
+	if !ok {
+		err = fmt.Errorf("no handler registered for %q", j.Kind)
+	} else {
+		stop := heartbeat(j.JobID)
+		err = safeRun(ctx, h, j.Payload)
+		stop()
+	}
+
+	if err == nil {
+		if _, err := database.DB.Exec(`UPDATE jobs SET status=$1, locked_at=NULL, finished_at=now(), updated_at=now() WHERE job_id=$2`, StatusDone, j.JobID); err != nil {
+			fmt.Println("Error finishing job: ", err)
+		}
+		return
+	}
+
+	fmt.Printf("Job %d (%s) failed, attempt %d of %d: %v\n", j.JobID, j.Kind, j.Attempts, j.MaxAttempts, err)
+
+	if j.Attempts >= j.MaxAttempts || !ok {
+		_, err = database.DB.Exec(`UPDATE jobs SET status=$1, locked_at=NULL, last_error=$2, finished_at=now(), updated_at=now() WHERE job_id=$3`, StatusDead, err.Error(), j.JobID)
+	} else {
+		_, err = database.DB.Exec(`UPDATE jobs SET status=$1, locked_at=NULL, last_error=$2, run_at=$3, updated_at=now() WHERE job_id=$4`, StatusQueued, err.Error(), time.Now().Add(backoff(j.Attempts)), j.JobID)
+	}
+	if err != nil {
+		fmt.Println("Error rescheduling job: ", err)
+	}
+}
+
+// heartbeat renews the job's lock until stop is called, so maintenance doesn't hand a job that's still running
+// to a second worker.
+func heartbeat(jobID int64) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(heartbeatEvery)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if _, err := database.DB.Exec(`UPDATE jobs SET locked_at=now() WHERE job_id=$1 AND status=$2`, jobID, StatusRunning); err != nil {
+					fmt.Println("Error renewing job lock: ", err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// safeRun turns a panicking handler into a failed attempt instead of a dead worker.
+func safeRun(ctx context.Context, h handler, payload []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return h(ctx, payload)
+}
+
+// Start runs n workers polling for jobs, plus the scheduler, until ctx is cancelled.
+// It returns once every job that was already running has finished, so call it from a goroutine and wait on
+// the returned channel during shutdown.
+func Start(ctx context.Context, n int, poll time.Duration) <-chan struct{} {
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work(ctx, poll)
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		schedule(ctx, poll)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return done
+}
+
+func work(ctx context.Context, poll time.Duration) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		j, ok, err := claim()
+		if err != nil {
+			fmt.Println("Error claiming job: ", err)
+		}
+
+		if ok {
+			// Jobs get a context that outlives shutdown, so a job that's half done isn't cut off.
+			// Shutdown waits for it instead.
+			run(context.WithoutCancel(ctx), j)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(poll):
+		}
+	}
+}
+
+// Maintenance is run by the scheduler: requeue jobs from dead workers and clear out old finished ones.
+func maintenance() error {
+	_, err := database.DB.Exec(`UPDATE jobs SET status=$1, locked_at=NULL, updated_at=now() WHERE status=$2 AND locked_at < $3`, StatusQueued, StatusRunning, time.Now().Add(-staleAfter))
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec(`DELETE FROM jobs WHERE status=$1 AND finished_at < $2`, StatusDone, time.Now().Add(-keepDone))
+	return err
+}
+
+// Retry puts a dead job back in the queue with a fresh set of attempts.
+func Retry(jobID string) error {
+	res, err := database.DB.Exec(`UPDATE jobs SET status=$1, attempts=0, run_at=now(), finished_at=NULL, updated_at=now() WHERE job_id=$2 AND status=$3`, StatusQueued, jobID, StatusDead)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("error: job not found or not dead")
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"gorant/database"
+	"gorant/database/dbtest"
+)
+
+func TestBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		{50, time.Hour},
+	} {
+		for i := 0; i < 100; i++ {
+			// Jitter adds up to a quarter on top
+			if d := backoff(tt.attempts); d < tt.want || d > tt.want+tt.want/4 {
+				t.Fatalf("backoff(%d) = %v, want %v plus up to a quarter", tt.attempts, d, tt.want)
+			}
+		}
+	}
+}
+
+func TestSafeRun(t *testing.T) {
+	err := safeRun(context.Background(), func(ctx context.Context, payload []byte) error { panic("boom") }, nil)
+	if err == nil || err.Error() != "panic: boom" {
+		t.Errorf("safeRun of a panicking handler = %v", err)
+	}
+}
+
+type testPayload struct {
+	N int `json:"n"`
+}
+
+// claimNow makes every queued job due and claims the next one.
+func claimNow(t *testing.T) Job {
+	t.Helper()
+
+	if _, err := database.DB.Exec(`UPDATE jobs SET run_at=now() WHERE status=$1`, StatusQueued); err != nil {
+		t.Fatal(err)
+	}
+	j, ok, err := claim()
+	if err != nil || !ok {
+		t.Fatalf("claim() = %v, %v", ok, err)
+	}
+
+	return j
+}
+
+func getJob(t *testing.T, jobID int64) Job {
+	t.Helper()
+
+	var j Job
+	if err := database.DB.Get(&j, `SELECT job_id, kind, status, attempts, max_attempts, run_at, last_error FROM jobs WHERE job_id=$1`, jobID); err != nil {
+		t.Fatal(err)
+	}
+
+	return j
+}
+
+func TestRunRetriesAndGivesUp(t *testing.T) {
+	dbtest.Open(t)
+
+	var got []int
+	Register("test.flaky", func(ctx context.Context, p testPayload) error {
+		got = append(got, p.N)
+		return errors.New("server down")
+	})
+	if err := Enqueue("test.flaky", testPayload{N: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	j := claimNow(t)
+	run(context.Background(), j)
+
+	j = getJob(t, j.JobID)
+	if j.Status != StatusQueued || j.Attempts != 1 || j.LastError.String != "server down" || !j.RunAt.After(time.Now().Add(5*time.Second)) {
+		t.Fatalf("after a failed attempt the job is %+v, want it queued again with a backoff", j)
+	}
+
+	for i := 1; i < defaultMaxAttempts; i++ {
+		run(context.Background(), claimNow(t))
+	}
+
+	j = getJob(t, j.JobID)
+	if j.Status != StatusDead || j.Attempts != defaultMaxAttempts {
+		t.Fatalf("after %d failed attempts the job is %+v, want it dead", defaultMaxAttempts, j)
+	}
+	if len(got) != defaultMaxAttempts || got[0] != 7 {
+		t.Errorf("handler got payloads %v", got)
+	}
+	if _, ok, _ := claim(); ok {
+		t.Error("claim() handed out a dead job")
+	}
+
+	// Retry starts it over
+	if err := Retry("nope"); err == nil {
+		t.Error("Retry of a missing job succeeded")
+	}
+	if _, err := database.DB.Exec(`UPDATE jobs SET kind='test.ok' WHERE job_id=$1`, j.JobID); err != nil {
+		t.Fatal(err)
+	}
+	Register("test.ok", func(ctx context.Context, p testPayload) error { return nil })
+	if err := Retry(strconv.FormatInt(j.JobID, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	run(context.Background(), claimNow(t))
+	if j = getJob(t, j.JobID); j.Status != StatusDone || j.Attempts != 1 {
+		t.Errorf("after a retry the job is %+v, want it done at the first attempt", j)
+	}
+}
+
+func TestRunUnknownKind(t *testing.T) {
+	dbtest.Open(t)
+
+	if err := Enqueue("test.unknown", testPayload{}); err != nil {
+		t.Fatal(err)
+	}
+	j := claimNow(t)
+	run(context.Background(), j)
+
+	// Retrying wouldn't help, there's nothing to run it
+	if j = getJob(t, j.JobID); j.Status != StatusDead || j.Attempts != 1 {
+		t.Errorf("a job nobody handles is %+v, want it dead after one attempt", j)
+	}
+}
+
+func TestMaintenanceRequeuesStaleJobs(t *testing.T) {
+	dbtest.Open(t)
+
+	for i := 0; i < 2; i++ {
+		if err := Enqueue("test.stale", testPayload{N: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stale, fresh := claimNow(t), claimNow(t)
+
+	// The stale job's worker stopped renewing its lock, the fresh one's started long ago but still beats
+	if _, err := database.DB.Exec(`UPDATE jobs SET locked_at=$1 WHERE job_id=$2`, time.Now().Add(-staleAfter-time.Minute), stale.JobID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.DB.Exec(`UPDATE jobs SET created_at=$1 WHERE job_id=$2`, time.Now().Add(-time.Hour), fresh.JobID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := maintenance(); err != nil {
+		t.Fatal(err)
+	}
+
+	if j := getJob(t, stale.JobID); j.Status != StatusQueued {
+		t.Errorf("stale job is %s, want it queued again", j.Status)
+	}
+	if j := getJob(t, fresh.JobID); j.Status != StatusRunning {
+		t.Errorf("job with a fresh lock is %s, want it still running", j.Status)
+	}
+}
@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorant/database"
+)
+
+type scheduledJob struct {
+	Name     string
+	Interval time.Duration
+	Kind     string
+	Payload  any
+}
+
+var (
+	schedulesMu sync.Mutex
+	schedules   []scheduledJob
+)
+
+// Every enqueues a job of the given kind once per interval. The next run time is kept in job_schedules,
+// so restarts don't reset the clock and with several app instances only one of them enqueues each run.
+func Every(name string, interval time.Duration, kind string, payload any) {
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+
+	schedules = append(schedules, scheduledJob{Name: name, Interval: interval, Kind: kind, Payload: payload})
+}
+
+func schedule(ctx context.Context, poll time.Duration) {
+	schedulesMu.Lock()
+	list := append([]scheduledJob(nil), schedules...)
+	schedulesMu.Unlock()
+
+	for _, s := range list {
+		_, err := database.DB.Exec(`INSERT INTO job_schedules (name, kind, interval_seconds, next_run_at) VALUES ($1, $2, $3, now())
+									ON CONFLICT (name) DO UPDATE SET kind=EXCLUDED.kind, interval_seconds=EXCLUDED.interval_seconds`, s.Name, s.Kind, int(s.Interval.Seconds()))
+		if err != nil {
+			fmt.Println("Error saving job schedule: ", err)
+		}
+	}
+
+	for {
+		if err := maintenance(); err != nil {
+			fmt.Println("Error maintaining jobs: ", err)
+		}
+
+		for _, s := range list {
+			// Whoever moves next_run_at forward gets to enqueue this run
+			res, err := database.DB.Exec(`UPDATE job_schedules SET next_run_at=now() + make_interval(secs => interval_seconds), last_run_at=now()
+										WHERE name=$1 AND next_run_at <= now()`, s.Name)
+			if err != nil {
+				fmt.Println("Error checking job schedule: ", err)
+				continue
+			}
+
+			if n, _ := res.RowsAffected(); n == 1 {
+				if err := Enqueue(s.Kind, s.Payload); err != nil {
+					fmt.Println("Error enqueuing scheduled job: ", err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(max(poll, 30*time.Second)):
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"database/sql"
+	"time"
+
+	"gorant/database"
+)
+
+// KindStats is one row of the queue health table in /admin/jobs.
+type KindStats struct {
+	Kind    string `db:"kind"`
+	Queued  int    `db:"queued"`
+	Running int    `db:"running"`
+	Done    int    `db:"done"`
+	Dead    int    `db:"dead"`
+	// OldestQueued is how long the longest-waiting due job has been waiting, a growing value means workers can't keep up
+	OldestQueued sql.NullTime `db:"oldest_queued"`
+}
+
+type Schedule struct {
+	Name            string       `db:"name"`
+	Kind            string       `db:"kind"`
+	IntervalSeconds int          `db:"interval_seconds"`
+	NextRunAt       time.Time    `db:"next_run_at"`
+	LastRunAt       sql.NullTime `db:"last_run_at"`
+}
+
+func (s Schedule) Interval() time.Duration {
+	return time.Duration(s.IntervalSeconds) * time.Second
+}
+
+func Stats() ([]KindStats, error) {
+	var stats []KindStats
+
+	err := database.DB.Select(&stats, `SELECT kind,
+											COUNT(1) FILTER (WHERE status=$1) AS queued,
+											COUNT(1) FILTER (WHERE status=$2) AS running,
+											COUNT(1) FILTER (WHERE status=$3) AS done,
+											COUNT(1) FILTER (WHERE status=$4) AS dead,
+											MIN(run_at) FILTER (WHERE status=$1 AND run_at <= now()) AS oldest_queued
+										FROM jobs
+										GROUP BY kind
+										ORDER BY kind`, StatusQueued, StatusRunning, StatusDone, StatusDead)
+
+	return stats, err
+}
+
+// Failed lists the most recent dead jobs, and queued ones that have failed at least once and are waiting on a retry.
+func Failed(limit int) ([]Job, error) {
+	var list []Job
+
+	err := database.DB.Select(&list, `SELECT job_id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at
+										FROM jobs
+										WHERE status=$1 OR (status=$2 AND last_error IS NOT NULL)
+										ORDER BY updated_at DESC
+										LIMIT $3`, StatusDead, StatusQueued, limit)
+
+	return list, err
+}
+
+func Schedules() ([]Schedule, error) {
+	var list []Schedule
+	err := database.DB.Select(&list, `SELECT name, kind, interval_seconds, next_run_at, last_run_at FROM job_schedules ORDER BY name`)
+
+	return list, err
+}
@@ -376,7 +376,13 @@ func SyncUserLocalDB(username string) (bool, error) {
 	err := database.DB.QueryRow("SELECT * FROM users WHERE user_id=$1;", username).Scan(&exists)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			_, err := database.DB.Exec("INSERT INTO users (user_id, email, preferred_name) VALUES ($1, $2, $3);", username, username, username)
+			handle, err := users.NewHandle(username)
+			if err != nil {
+				log.Printf("Error picking a handle for new user")
+				return firstLogin, err
+			}
+
+			_, err = database.DB.Exec("INSERT INTO users (user_id, email, preferred_name, handle) VALUES ($1, $2, $3, $4);", username, username, username, handle)
 			if err != nil {
 
 				log.Printf("Error inserting new user into DB")
@@ -419,6 +425,16 @@ func SetSettingsCookie(currentUser *users.User, session *gorillaSessions.Session
 		fmt.Println("No SortComments cookie found!")
 		refetch = true
 	}
+	currentUser.Role, ok = session.Values["Role"].(string)
+	if currentUser.Role == "" || !ok {
+		fmt.Println("No Role cookie found!")
+		refetch = true
+	}
+	currentUser.Handle, ok = session.Values["Handle"].(string)
+	if currentUser.Handle == "" || !ok {
+		fmt.Println("No Handle cookie found!")
+		refetch = true
+	}
 
 	// If cookies are empty, then fetch from DB
 	if refetch {
@@ -433,6 +449,8 @@ func SetSettingsCookie(currentUser *users.User, session *gorillaSessions.Session
 		session.Values["Avatar"] = currentUser.Avatar
 		session.Values["AvatarPath"] = currentUser.AvatarPath
 		session.Values["SortComments"] = currentUser.SortComments
+		session.Values["Role"] = currentUser.Role
+		session.Values["Handle"] = currentUser.Handle
 	}
 
 	return nil
@@ -0,0 +1,153 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/smtp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string            // Optional, sent as multipart/alternative alongside Text
+	Headers map[string]string // Extra headers, e.g. List-Unsubscribe
+}
+
+type Sender interface {
+	Send(m Message) error
+}
+
+// Default is set in main from the SMTP_* env vars. When it's nil, Send does nothing, so a dev setup without
+// a mail server still works.
+var Default Sender
+
+// BaseURL is the public address of the site, used for absolute links in emails.
+var BaseURL = "http://localhost:7000"
+
+func Send(m Message) error {
+	if Default == nil {
+		return nil
+	}
+
+	return Default.Send(m)
+}
+
+// SMTPSender sends through a plain SMTP server, e.g. maildev from docker-compose-mail.yaml on localhost:1025.
+// Auth is only used when Username is set.
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(m Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	return smtp.SendMail(s.Host+":"+s.Port, auth, s.From, []string{m.To}, m.Bytes(s.From))
+}
+
+// MemorySender keeps messages instead of sending them.
+type MemorySender struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (s *MemorySender) Send(m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func (s *MemorySender) Sent() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.sent...)
+}
+
+// Header values come partly from user input (display names in subjects), so line breaks are dropped
+// to rule out header injection.
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
+
+// Bytes renders the message in RFC 5322 format, ready for the SMTP DATA command.
+func (m Message) Bytes(from string) []byte {
+	var b bytes.Buffer
+
+	headers := map[string]string{
+		"From":         from,
+		"To":           m.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", headerValue(m.Subject)),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"Message-ID":   fmt.Sprintf("<%s@%s>", randomID(), domain(from)),
+		"MIME-Version": "1.0",
+	}
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s: %s\r\n", headerValue(k), headerValue(headers[k]))
+	}
+
+	if m.HTML == "" {
+		b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		writeQP(&b, m.Text)
+		return b.Bytes()
+	}
+
+	boundary := "grumplr-" + randomID()
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n", boundary)
+	writeQP(&b, m.Text)
+	fmt.Fprintf(&b, "\r\n--%s\r\nContent-Type: text/html; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n", boundary)
+	writeQP(&b, m.HTML)
+	fmt.Fprintf(&b, "\r\n--%s--\r\n", boundary)
+
+	return b.Bytes()
+}
+
+func writeQP(b *bytes.Buffer, s string) {
+	w := quotedprintable.NewWriter(b)
+	w.Write([]byte(strings.ReplaceAll(s, "\n", "\r\n")))
+	w.Close()
+}
+
+func randomID() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func domain(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return strings.Trim(address[i+1:], "> ")
+	}
+
+	return "localhost"
+}
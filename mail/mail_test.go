@@ -0,0 +1,138 @@
+package mail
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMemorySender(t *testing.T) {
+	s := &MemorySender{}
+	Default = s
+	defer func() { Default = nil }()
+
+	if err := Send(Message{To: "a@example.com", Subject: "Hi", Text: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := s.Sent()
+	if len(sent) != 1 || sent[0].To != "a@example.com" {
+		t.Errorf("Sent() = %+v, want one message to a@example.com", sent)
+	}
+}
+
+func TestSendWithoutSender(t *testing.T) {
+	Default = nil
+	if err := Send(Message{To: "a@example.com"}); err != nil {
+		t.Errorf("Send() with no sender = %v, want nil", err)
+	}
+}
+
+// TestSMTPSender sends through maildev from docker-compose-mail.yaml, e.g. MAILDEV_HOST=localhost go test ./mail
+func TestSMTPSender(t *testing.T) {
+	host := os.Getenv("MAILDEV_HOST")
+	if host == "" {
+		t.Skip("MAILDEV_HOST not set")
+	}
+
+	subject := "Test " + randomID()
+	s := &SMTPSender{Host: host, Port: "1025", From: "noreply@example.com"}
+	if err := s.Send(Message{To: "a@example.com", Subject: subject, Text: "plain", HTML: "<p>html</p>"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// maildev's REST API lists what it received
+	res, err := http.Get("http://" + host + ":1080/email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var received []struct {
+		Subject string `json:"subject"`
+		Text    string `json:"text"`
+		To      []struct {
+			Address string `json:"address"`
+		} `json:"to"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&received); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range received {
+		if m.Subject == subject {
+			if len(m.To) != 1 || m.To[0].Address != "a@example.com" || strings.TrimSpace(m.Text) != "plain" {
+				t.Errorf("maildev received %+v", m)
+			}
+			return
+		}
+	}
+	t.Errorf("maildev didn't receive %q", subject)
+}
+
+func TestMessageBytes(t *testing.T) {
+	m := Message{
+		To:      "a@example.com",
+		Subject: "Bob replied\r\nBcc: everyone@example.com",
+		Text:    "line one\nline two",
+		Headers: map[string]string{"List-Unsubscribe": "<https://example.com/unsubscribe?t=x>"},
+	}
+	out := string(m.Bytes("noreply@example.com"))
+
+	for _, want := range []string{
+		"From: noreply@example.com\r\n",
+		"To: a@example.com\r\n",
+		"List-Unsubscribe: <https://example.com/unsubscribe?t=x>\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"line one\r\nline two",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Bytes() missing %q in:\n%s", want, out)
+		}
+	}
+
+	if strings.Contains(out, "\r\nBcc:") {
+		t.Errorf("Bytes() let a header through the subject:\n%s", out)
+	}
+}
+
+func TestMessageBytesHTML(t *testing.T) {
+	m := Message{To: "a@example.com", Subject: "Hi", Text: "plain", HTML: "<p>html</p>"}
+	out := string(m.Bytes("noreply@example.com"))
+
+	if !strings.Contains(out, "multipart/alternative") || !strings.Contains(out, "text/html") || !strings.Contains(out, "plain") {
+		t.Errorf("Bytes() with HTML isn't multipart/alternative:\n%s", out)
+	}
+}
+
+func TestUnsubscribeToken(t *testing.T) {
+	Secret = []byte("test secret")
+	defer func() { Secret = nil }()
+
+	token := UnsubscribeToken("alice@example.com")
+
+	userID, ok := VerifyUnsubscribeToken(token)
+	if !ok || userID != "alice@example.com" {
+		t.Fatalf("VerifyUnsubscribeToken(%q) = %q, %v, want alice@example.com, true", token, userID, ok)
+	}
+
+	// Swapping the user ID without re-signing must fail
+	_, sig, _ := strings.Cut(token, ".")
+	forged := strings.Split(UnsubscribeToken("bob@example.com"), ".")[0] + "." + sig
+	if _, ok := VerifyUnsubscribeToken(forged); ok {
+		t.Errorf("VerifyUnsubscribeToken accepted a forged token")
+	}
+
+	for _, bad := range []string{"", "nodot", "!!!.!!!", token + "x"} {
+		if _, ok := VerifyUnsubscribeToken(bad); ok {
+			t.Errorf("VerifyUnsubscribeToken(%q) = ok, want rejected", bad)
+		}
+	}
+
+	Secret = []byte("another secret")
+	if _, ok := VerifyUnsubscribeToken(token); ok {
+		t.Errorf("VerifyUnsubscribeToken accepted a token signed with a different secret")
+	}
+}
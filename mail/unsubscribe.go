@@ -0,0 +1,62 @@
+package mail
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// Secret signs unsubscribe links. It's set in main, from MAIL_SECRET or else the session key.
+var Secret []byte
+
+func sign(userID string) []byte {
+	mac := hmac.New(sha256.New, Secret)
+	mac.Write([]byte("unsubscribe:" + userID))
+	return mac.Sum(nil)
+}
+
+// UnsubscribeToken identifies the user without them having to log in. It doesn't expire,
+// since people click unsubscribe on emails that are months old.
+func UnsubscribeToken(userID string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(userID)) + "." + enc.EncodeToString(sign(userID))
+}
+
+// VerifyUnsubscribeToken returns the user ID from a token made by UnsubscribeToken.
+func VerifyUnsubscribeToken(token string) (string, bool) {
+	enc := base64.RawURLEncoding
+
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", false
+	}
+
+	userID, err := enc.DecodeString(id)
+	if err != nil {
+		return "", false
+	}
+
+	mac, err := enc.DecodeString(sig)
+	if err != nil {
+		return "", false
+	}
+
+	if len(Secret) == 0 || !hmac.Equal(mac, sign(string(userID))) {
+		return "", false
+	}
+
+	return string(userID), true
+}
+
+func UnsubscribeURL(userID string) string {
+	return BaseURL + "/unsubscribe?t=" + UnsubscribeToken(userID)
+}
+
+// UnsubscribeHeaders make mail clients show their own unsubscribe button, which POSTs to the same URL (RFC 8058).
+func UnsubscribeHeaders(userID string) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + UnsubscribeURL(userID) + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
@@ -1,17 +1,36 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"gorant/database"
+	"gorant/feeds"
+	"gorant/insights"
+	"gorant/jobs"
+	"gorant/mail"
+	"gorant/messages"
+	"gorant/moods"
+	"gorant/notifications"
 	"gorant/posts"
+	"gorant/sentiment"
 	"gorant/templates"
+	"gorant/uploads"
 	"gorant/users"
 
 	"github.com/a-h/templ"
@@ -40,6 +59,51 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err := database.Migrate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := users.BackfillHandles(anonymousUserID); err != nil {
+		log.Fatal(err)
+	}
+
+	// Maintenance subcommands, e.g. gorant tags merge work workplace
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	uploads.Store, err = uploads.NewLocalStore(envOr("UPLOADS_DIR", "./data/uploads"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Outgoing email is off unless an SMTP server is configured, e.g. maildev from docker-compose-mail.yaml
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		mail.Default = &mail.SMTPSender{
+			Host:     host,
+			Port:     envOr("SMTP_PORT", "25"),
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     envOr("MAIL_FROM", "noreply@localhost"),
+		}
+	}
+	mail.BaseURL = strings.TrimSuffix(envOr("BASE_URL", mail.BaseURL), "/")
+	feeds.BaseURL = mail.BaseURL
+	mail.Secret = []byte(envOr("MAIL_SECRET", os.Getenv("GORILLA_SESSION_KEY")))
+	if len(mail.Secret) == 0 {
+		// Unsubscribe links signed with an empty key would all be rejected
+		log.Fatal("Error: set MAIL_SECRET or GORILLA_SESSION_KEY, unsubscribe links are signed with it")
+	}
+
+	// Mood suggestions use the lexicon built into the sentiment package unless another one is configured
+	if path := os.Getenv("SENTIMENT_LEXICON"); path != "" {
+		sentiment.Default, err = sentiment.LoadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	registerJobs()
+
 	// Init Keycloak client
 	k := newKeycloak()
 	currentUser := &users.User{SortComments: "upvote;desc"}
@@ -54,7 +118,35 @@ func main() {
 	})))
 
 	mux.Handle("GET /{$}", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		p, err := posts.ListPosts()
+		// A shared filter link opens the front page already filtered, a picked preset too. Without either, users
+		// land on their default preset if they have one, "?preset=none" skips it.
+		filter := posts.ParseFilter(r.URL.Query())
+
+		var presets []users.FilterPreset
+		var preset int
+		if currentUser.UserID != "" {
+			var err error
+			presets, err = users.ListPresets(currentUser.UserID)
+			if err != nil {
+				fmt.Println("Error fetching filter presets: ", err)
+			}
+
+			picked := r.URL.Query().Get("preset")
+			for _, p := range presets {
+				if strconv.Itoa(p.PresetID) == picked || (r.URL.RawQuery == "" && p.IsDefault) {
+					filter = posts.ParseFilter(parseQuery(p.Query))
+					preset = p.PresetID
+				}
+			}
+		}
+
+		var p posts.PostCollection
+		var err error
+		if filter.IsZero() {
+			p, err = posts.ListPosts(currentUser.UserID)
+		} else {
+			p, err = posts.ListPostsFilter(filter, currentUser.UserID)
+		}
 		if err != nil {
 			fmt.Println("Error fetching posts", err)
 		}
@@ -64,7 +156,7 @@ func main() {
 			fmt.Println("Error fetching tags", err)
 		}
 		fmt.Println("Tags: ", t)
-		TemplRender(w, r, templates.StarterWelcome(currentUser, p, t))
+		TemplRender(w, r, templates.StarterWelcome(currentUser, p, t, filter, presets, preset))
 	})))
 
 	mux.HandleFunc("POST /anonymous", func(w http.ResponseWriter, r *http.Request) {
@@ -82,42 +174,108 @@ func main() {
 		TemplRender(w, r, templates.Error(currentUser, "Oops something went wrong."))
 	})
 
-	mux.HandleFunc("POST /filter", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("POST /filter", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Requires r.ParseForm() because r.FormValue only grabs first value, not other values of same named checkboxes
 		r.ParseForm()
-		m := r.Form["mood"]
-		t := r.Form["tags"]
+		filter := posts.ParseFilter(r.Form)
 
+		var p posts.PostCollection
+		var err error
 		// For when there's a reset of the form
-		if len(m) == 0 && len(t) == 0 {
-			p, err := posts.ListPosts()
-			if err != nil {
-				fmt.Println("Error fetching posts", err)
-			}
-			TemplRender(w, r, templates.ListPosts(p))
-			return
+		if filter.IsZero() {
+			p, err = posts.ListPosts(currentUser.UserID)
+			w.Header().Set("HX-Push-Url", "/?preset=none")
+		} else {
+			p, err = posts.ListPostsFilter(filter, currentUser.UserID)
+			w.Header().Set("HX-Push-Url", "/?"+filter.Values().Encode())
+		}
+		if err != nil {
+			fmt.Println("Error fetching posts", err)
 		}
-		// s := r.FormValue("sort")
 
-		fmt.Println("Mood: ", m)
-		fmt.Println("Tags: ", t)
-		// fmt.Println("Sort: ", s)
+		TemplRender(w, r, templates.ListPosts(p))
+	})))
 
-		if len(m) == 0 {
-			m = []string{"angry", "upset", "sad", "neutral", "happy", "elated"}
+	mux.Handle("POST /presets", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "You need to login before saving filters."))
+			return
 		}
 
-		p, err := posts.ListPostsFilter(m, t)
+		r.ParseForm()
+		query := posts.ParseFilter(r.Form).Values().Encode()
+		p, err := users.SavePreset(currentUser.UserID, r.FormValue("preset-name"), query, r.FormValue("preset-default") == "true")
 		if err != nil {
-			fmt.Println("Error fetching posts", err)
+			renderPresetError(w, r, err)
+			return
 		}
 
-		TemplRender(w, r, templates.ListPosts(p))
+		renderPresets(w, r, currentUser.UserID, p.PresetID)
+	})))
+
+	mux.Handle("POST /presets/{presetID}/default", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presetID, _ := strconv.Atoi(r.PathValue("presetID"))
+		if err := users.SetDefaultPreset(currentUser.UserID, presetID); err != nil {
+			renderPresetError(w, r, err)
+			return
+		}
+
+		renderPresets(w, r, currentUser.UserID, presetID)
+	})))
+
+	mux.Handle("POST /presets/{presetID}/delete", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presetID, _ := strconv.Atoi(r.PathValue("presetID"))
+		if err := users.DeletePreset(currentUser.UserID, presetID); err != nil {
+			renderPresetError(w, r, err)
+			return
+		}
+
+		renderPresets(w, r, currentUser.UserID, 0)
+	})))
+
+	// Feeds, each as /....rss and /....atom. Feed readers aren't logged in, and a preset's feed carries its filter
+	// in the URL.
+	for _, format := range []string{feeds.RSS, feeds.Atom} {
+		mux.HandleFunc("GET /feeds/posts."+format, func(w http.ResponseWriter, r *http.Request) {
+			f, err := feeds.Front(posts.ParseFilter(r.URL.Query()))
+			serveFeed(w, r, f, format, err)
+		})
+
+		mux.HandleFunc("GET /tags/{tag}/feed."+format, func(w http.ResponseWriter, r *http.Request) {
+			f, err := feeds.Tag(r.PathValue("tag"))
+			serveFeed(w, r, f, format, err)
+		})
+
+		mux.HandleFunc("GET /users/{handle}/feed."+format, func(w http.ResponseWriter, r *http.Request) {
+			f, err := feeds.User(r.PathValue("handle"))
+			serveFeed(w, r, f, format, err)
+		})
+
+		mux.HandleFunc("GET /posts/{postID}/comments/feed."+format, func(w http.ResponseWriter, r *http.Request) {
+			f, err := feeds.Comments(r.PathValue("postID"))
+			serveFeed(w, r, f, format, err)
+		})
+	}
+
+	mux.HandleFunc("POST /preview", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Hx-Request") == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// Comment form posts "message", the comment edit form posts "edit-content"
+		c := r.FormValue("message")
+		if c == "" {
+			c = r.FormValue("edit-content")
+		}
+
+		TemplRender(w, r, templates.MarkdownPreview(c))
 	})
 
 	mux.Handle("GET /posts", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Query().Get("validation") == "error" {
-			p, err := posts.ListPosts()
+			p, err := posts.ListPosts(currentUser.UserID)
 			if err != nil {
 				fmt.Println("Error fetching posts", err)
 			}
@@ -131,12 +289,39 @@ func main() {
 		}
 	})))
 
+	mux.Handle("POST /posts/suggest-mood", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Once a mood has been picked by hand it's left alone
+		if r.FormValue("mood-manual") == "true" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		scale := moods.All()
+		if len(scale) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		text := strings.TrimSpace(r.FormValue("post-title") + ". " + r.FormValue("post-description"))
+		result := sentiment.Score(text)
+		step := result.Step(scale[0].Intensity, moods.Default().Intensity, scale[len(scale)-1].Intensity)
+
+		TemplRender(w, r, templates.MoodPicker(moods.Nearest(step).Key, result.Hits > 0))
+	})))
+
 	mux.Handle("POST /posts/new", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := parseUploadForm(w, r); err != nil {
+			fmt.Println(err)
+			TemplRender(w, r, templates.CreatePostError("Attachments are too large, please upload smaller images."))
+			return
+		}
+
 		title := r.FormValue("post-title")
+		description := strings.TrimSpace(r.FormValue("post-description"))
 		m := r.FormValue("mood")
 		tags := r.FormValue("tags-data")
 
-		exists, ID := posts.VerifyPostID(title)
+		exists, ID := posts.PostIDTaken(title)
 		if exists {
 			TemplRender(w, r, templates.CreatePostError("Post with the same title already exists, please change it."))
 			return
@@ -147,13 +332,37 @@ func main() {
 			TemplRender(w, r, templates.CreatePostError(v["postTitle"]))
 			return
 		}
-		// TODO need to validate mood as well
+		if utf8.RuneCountInString(description) > 255 {
+			TemplRender(w, r, templates.CreatePostError("That's too long! Max length of description is 255 characters."))
+			return
+		}
+		if m == "" {
+			m = moods.Default().Key
+		}
+		if err := posts.ValidateMood(m); err != nil {
+			fmt.Println(err)
+			TemplRender(w, r, templates.CreatePostError("Please pick one of the moods."))
+			return
+		}
+
+		files := formFiles(r, "attachments")
+		if len(files) > 0 && (currentUser.UserID == "" || r.FormValue("anonymous-mode") == "true") {
+			TemplRender(w, r, templates.CreatePostError("Please log in to attach images."))
+			return
+		}
+
+		images, msg := saveAttachments(files)
+		if msg != "" {
+			TemplRender(w, r, templates.CreatePostError(msg))
+			return
+		}
 
 		p := posts.ZPost{
-			ID:     ID,
-			Title:  title,
-			UserID: currentUser.UserID,
-			Mood:   m,
+			ID:          ID,
+			Title:       title,
+			Description: description,
+			UserID:      currentUser.UserID,
+			Mood:        m,
 		}
 
 		var t []string
@@ -180,12 +389,21 @@ func main() {
 			w.Header().Set("HX-Redirect", "/login?r=new")
 			return
 		}
+
+		if err := uploads.Attach(images, ID, "", currentUser.UserID); err != nil {
+			fmt.Println("Error attaching images: ", err)
+		}
 		w.Header().Set("HX-Redirect", "/posts/"+ID)
 	})))
 
 	mux.Handle("GET /posts/{postID}", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		postID := r.PathValue("postID")
 		post, err := posts.GetPost(postID, currentUser.UserID)
+		if errors.Is(err, posts.ErrPostNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			TemplRender(w, r, templates.Error(currentUser, "Couldn't find that post."))
+			return
+		}
 		if err != nil {
 			fmt.Println("Get post error: ", err)
 			TemplRender(w, r, templates.Error(currentUser, "Error!"))
@@ -201,7 +419,12 @@ func main() {
 			return
 		}
 
-		TemplRender(w, r, templates.Post(currentUser, "Posts", post, comments, "", currentUser.SortComments))
+		timeline, err := posts.GetMoodTimeline(postID, currentUser.UserID)
+		if err != nil {
+			fmt.Println("Error fetching mood timeline: ", err)
+		}
+
+		TemplRender(w, r, templates.Post(currentUser, "Posts", post, comments, timeline, "", currentUser.SortComments))
 	})))
 
 	mux.Handle("POST /posts/{postID}", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -239,6 +462,7 @@ func main() {
 
 	mux.Handle("POST /posts/{postID}/new", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		postID := r.PathValue("postID")
+		uploadErr := parseUploadForm(w, r)
 
 		if currentUser.UserID == "" {
 			fmt.Println("Not authenticated")
@@ -278,10 +502,40 @@ func main() {
 			return
 		}
 
+		var images []uploads.Image
+		var msg string
+		if uploadErr != nil {
+			fmt.Println(uploadErr)
+			msg = "Attachments are too large, please upload smaller images."
+		} else {
+			images, msg = saveAttachments(formFiles(r, "attachments"))
+		}
+		if msg != "" {
+			comments, err := posts.ListCommentsFilterSort(postID, currentUser.UserID, currentUser.SortComments, "")
+			if err != nil {
+				fmt.Println("Error fetching posts")
+				TemplRender(w, r, templates.Error(currentUser, "Oops, something went wrong."))
+				return
+			}
+			TemplRender(w, r, templates.PartialPostNewError(currentUser, comments, map[string]string{"attachments": msg}))
+			return
+		}
+
 		var insertedID string
 		insertedID, err := posts.Insert(c)
-		if err != nil {
+		if errors.Is(err, posts.ErrBlocked) {
+			comments, err := posts.ListCommentsFilterSort(postID, currentUser.UserID, currentUser.SortComments, "")
+			if err != nil {
+				fmt.Println("Error fetching posts")
+				TemplRender(w, r, templates.Error(currentUser, "Oops, something went wrong."))
+				return
+			}
+			TemplRender(w, r, templates.PartialPostNewError(currentUser, comments, map[string]string{"form": "You can't reply to this rant."}))
+			return
+		} else if err != nil {
 			fmt.Println("Error inserting: ", err)
+		} else if err := uploads.Attach(images, postID, insertedID, currentUser.UserID); err != nil {
+			fmt.Println("Error attaching images: ", err)
 		}
 
 		comments, err := posts.ListCommentsFilterSort(postID, currentUser.UserID, currentUser.SortComments, "")
@@ -299,6 +553,7 @@ func main() {
 		if err := posts.DeletePost(postID, currentUser.UserID); err != nil {
 			fmt.Println(err)
 			http.Redirect(w, r, "/error", http.StatusSeeOther)
+			return
 		}
 
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -362,8 +617,10 @@ func main() {
 			return
 		}
 
-		if err := posts.EditMood(postID, newMood); err != nil {
+		if err := posts.EditMood(postID, newMood, currentUser.UserID); err != nil {
 			fmt.Println(err)
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "Something went wrong while changing the mood!"))
 			return
 		}
 
@@ -372,7 +629,12 @@ func main() {
 			fmt.Println("Issue with getting post info: ", err)
 		}
 
-		TemplRender(w, r, templates.PartialMoodMapper(currentUser, postID, post.UserID, post.Mood))
+		timeline, err := posts.GetMoodTimeline(postID, currentUser.UserID)
+		if err != nil {
+			fmt.Println("Error fetching mood timeline: ", err)
+		}
+
+		TemplRender(w, r, templates.PartialMoodMapper(currentUser, postID, post.UserID, post.Mood, timeline))
 	})))
 
 	mux.Handle("POST /posts/{postID}/comment/{commentID}/upvote", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -426,6 +688,12 @@ func main() {
 		commentID := r.PathValue("commentID")
 		e := r.FormValue("edit-content")
 
+		if v := posts.Validate(posts.Comment{Content: e}); v != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			TemplRender(w, r, templates.Toast("error", v["content"]))
+			return
+		}
+
 		if err := posts.EditComment(commentID, e, currentUser.UserID); err != nil {
 			fmt.Println(err)
 			return
@@ -483,9 +751,10 @@ func main() {
 		postID := r.PathValue("postID")
 		description := r.FormValue("post-description-input")
 
-		err := posts.EditPostDescription(postID, description)
+		err := posts.EditPostDescription(postID, description, currentUser.UserID)
 		if err != nil {
 			fmt.Println(err)
+			w.WriteHeader(http.StatusForbidden)
 			TemplRender(w, r, templates.Toast("error", "Something went wrong while editing the post!"))
 			return
 		}
@@ -497,104 +766,1125 @@ func main() {
 		TemplRender(w, r, templates.PartialEditDescriptionResponse(currentUser, post))
 	})))
 
-	mux.Handle("POST /posts/{postID}/like", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if currentUser.UserID == "" {
+	mux.Handle("POST /posts/{postID}/title/edit", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		postID := r.PathValue("postID")
+		title := r.FormValue("post-title-input")
+
+		if v := posts.ValidatePost(title); v != nil {
+			fmt.Println(v)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			TemplRender(w, r, templates.Toast("error", v["postTitle"]))
+			return
+		}
+
+		if err := posts.EditPostTitle(postID, title, currentUser.UserID); err != nil {
+			fmt.Println(err)
 			w.WriteHeader(http.StatusForbidden)
-			TemplRender(w, r, templates.Toast("error", "You need to login before liking a post."))
+			TemplRender(w, r, templates.Toast("error", "Something went wrong while editing the title!"))
 			return
 		}
+
+		w.Header().Set("HX-Refresh", "true")
+	})))
+
+	mux.Handle("GET /posts/{postID}/history", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		postID := r.PathValue("postID")
-		score, err := posts.LikePost(postID, currentUser.UserID)
+		post, err := posts.GetPost(postID, currentUser.UserID)
+		if errors.Is(err, posts.ErrPostNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			TemplRender(w, r, templates.Error(currentUser, "Couldn't find that post."))
+			return
+		}
 		if err != nil {
-			fmt.Println(err)
-			http.Redirect(w, r, "/error", http.StatusSeeOther)
+			fmt.Println("Get post error: ", err)
+			TemplRender(w, r, templates.Error(currentUser, "Error!"))
 			return
 		}
 
-		if score == 1 {
-			TemplRender(w, r, templates.PartialLikePost(postID, "1"))
-		} else {
-			TemplRender(w, r, templates.PartialLikePost(postID, "0"))
+		h, err := posts.GetHistory(postID)
+		if err != nil {
+			fmt.Println("Error fetching history: ", err)
+			TemplRender(w, r, templates.Error(currentUser, "Error!"))
+			return
 		}
+
+		TemplRender(w, r, templates.PostHistory(currentUser, post, h))
 	})))
 
-	mux.HandleFunc("GET /admin/reset", func(w http.ResponseWriter, r *http.Request) {
-		if os.Getenv("DEV_ENV") == "TRUE" {
-			err := database.Reset()
-			if err != nil {
-				fmt.Println(err)
-				w.Write([]byte("Reset failed, errored out"))
-				return
-			}
+	mux.Handle("POST /posts/{postID}/history/{revisionID}/restore", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		postID := r.PathValue("postID")
+		revisionID := r.PathValue("revisionID")
 
-			t := time.Now().Format(time.RFC3339)
+		if currentUser.UserID == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
 
-			TemplRender(w, r, templates.Reset("", t))
-		} else {
-			w.Write([]byte("Not allowed!"))
+		if err := posts.RestoreRevision(postID, revisionID, currentUser.UserID, currentUser.IsModerator()); err != nil {
+			fmt.Println("Error restoring revision: ", err)
+			http.Redirect(w, r, "/error", http.StatusSeeOther)
+			return
 		}
-	})
 
-	mux.Handle("GET /settings", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ref := r.URL.Query().Get("r")
-		err := currentUser.GetSettings(currentUser.UserID)
-		if err != nil {
-			fmt.Println("Error fetching settings: ", err)
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		http.Redirect(w, r, "/posts/"+postID+"/history", http.StatusSeeOther)
+	})))
+
+	mux.Handle("POST /posts/{postID}/react/{mood}", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "You need to login before reacting to a post."))
+			return
+		}
+		postID := r.PathValue("postID")
+		mood := r.PathValue("mood")
+		if !moods.Valid(mood) {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "Please pick one of the moods."))
+			return
 		}
 
-		switch ref {
-		case "firstlogin":
-			fmt.Println("in switch")
-			TemplRender(w, r, templates.SettingsFirstLogin(currentUser))
+		if _, err := posts.React(postID, currentUser.UserID, mood); err != nil {
+			fmt.Println(err)
+			http.Redirect(w, r, "/error", http.StatusSeeOther)
 			return
 		}
-		TemplRender(w, r, templates.Settings(currentUser))
+
+		reactions, own, err := posts.GetReactions(postID, currentUser.UserID)
+		if err != nil {
+			fmt.Println(err)
+			http.Redirect(w, r, "/error", http.StatusSeeOther)
+			return
+		}
+
+		TemplRender(w, r, templates.PartialReactions(postID, reactions, own))
 	})))
 
-	mux.Handle("POST /settings/edit", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		f := users.Settings{
-			PreferredName: r.FormValue("preferred-name"),
-			ContactMe:     r.FormValue("contact-me"),
-			Avatar:        r.FormValue("avatar-radio"),
-			SortComments:  r.FormValue("sort-comments"),
+	mux.Handle("POST /posts/{postID}/bookmark", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "You need to login before saving a post."))
+			return
 		}
 
-		if err := users.Validate(f); err != nil {
-			fmt.Println(err)
+		postID := r.PathValue("postID")
+		saved, err := posts.ToggleBookmark(currentUser.UserID, postID, "")
+		if err != nil {
+			fmt.Println("Error saving bookmark: ", err)
 			w.WriteHeader(http.StatusUnprocessableEntity)
 			TemplRender(w, r, templates.Toast("error", "Sorry, an error occurred while saving!"))
 			return
 		}
 
-		if err := users.SaveSettings(currentUser.UserID, f); err != nil {
-			fmt.Println("Error saving: ", err)
-			http.Redirect(w, r, "/error", http.StatusSeeOther)
+		TemplRender(w, r, templates.PartialBookmark(postID, "", saved))
+	})))
+
+	mux.Handle("POST /posts/{postID}/subscribe", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "You need to login before subscribing."))
+			return
 		}
 
-		err := currentUser.GetSettings(currentUser.UserID)
+		postID := r.PathValue("postID")
+		subscribed, err := posts.ToggleSubscription(currentUser.UserID, postID)
 		if err != nil {
-			fmt.Println("Error fetching settings: ", err)
-			http.Redirect(w, r, "/error", http.StatusSeeOther)
+			fmt.Println("Error saving subscription: ", err)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			TemplRender(w, r, templates.Toast("error", "Sorry, an error occurred while saving!"))
+			return
 		}
 
-		session, err := k.store.Get(r, "grumplr_kc_session")
-		if err != nil {
-			fmt.Println("Failed to access grumplr_kc_session", err)
+		TemplRender(w, r, templates.PartialSubscribe(postID, subscribed))
+	})))
+
+	mux.Handle("POST /posts/{postID}/comment/{commentID}/bookmark", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "You need to login before saving a comment."))
+			return
 		}
-		session.Values["PreferredName"] = currentUser.PreferredName
-		session.Values["Avatar"] = currentUser.Avatar
-		session.Values["AvatarPath"] = currentUser.AvatarPath
-		session.Values["SortComments"] = currentUser.SortComments
-		err = session.Save(r, w)
+
+		postID := r.PathValue("postID")
+		commentID := r.PathValue("commentID")
+		saved, err := posts.ToggleBookmark(currentUser.UserID, postID, commentID)
 		if err != nil {
-			fmt.Println("Failed to delete grumplr_kc_session", err)
+			fmt.Println("Error saving bookmark: ", err)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			TemplRender(w, r, templates.Toast("error", "Sorry, an error occurred while saving!"))
+			return
 		}
 
-		TemplRender(w, r, templates.PartialSettingsEditSuccess(*currentUser))
+		TemplRender(w, r, templates.PartialBookmark(postID, commentID, saved))
 	})))
 
-	//--------------------------------------
+	mux.Handle("GET /insights", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, handle, formError := insightsFilter(r, currentUser)
+
+		in, err := insights.Get(f)
+		if err != nil {
+			fmt.Println("Error fetching insights: ", err)
+			TemplRender(w, r, templates.Error(currentUser, "Couldn't load the insights."))
+			return
+		}
+
+		TemplRender(w, r, templates.Insights(currentUser, in, handle, formError))
+	})))
+
+	mux.Handle("GET /insights/export", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, formError := insightsFilter(r, currentUser)
+		if formError != "" {
+			http.Error(w, formError, http.StatusBadRequest)
+			return
+		}
+
+		in, err := insights.Get(f)
+		if err != nil {
+			fmt.Println("Error fetching insights: ", err)
+			http.Error(w, "Couldn't load the insights.", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="insights-%s-%s.json"`, in.From, in.To))
+		if err := json.NewEncoder(w).Encode(in); err != nil {
+			fmt.Println("Error encoding insights: ", err)
+		}
+	})))
+
+	mux.Handle("GET /saved", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		renderSaved(w, r, currentUser, "")
+	})))
+
+	mux.Handle("POST /saved/collections", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		name := strings.TrimSpace(r.FormValue("name"))
+		if msg := posts.ValidateCollection(name); msg != "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			renderSaved(w, r, currentUser, msg)
+			return
+		}
+
+		if err := posts.NewCollection(currentUser.UserID, name); err != nil {
+			fmt.Println("Error creating collection: ", err)
+			http.Redirect(w, r, "/error", http.StatusSeeOther)
+			return
+		}
+
+		http.Redirect(w, r, "/saved", http.StatusSeeOther)
+	})))
+
+	mux.Handle("POST /saved/collections/{collectionID}/delete", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		if err := posts.DeleteCollection(currentUser.UserID, r.PathValue("collectionID")); err != nil {
+			fmt.Println("Error deleting collection: ", err)
+		}
+
+		http.Redirect(w, r, "/saved", http.StatusSeeOther)
+	})))
+
+	mux.Handle("POST /saved/{bookmarkID}/move", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		if err := posts.MoveBookmark(currentUser.UserID, r.PathValue("bookmarkID"), r.FormValue("collection")); err != nil {
+			fmt.Println("Error moving bookmark: ", err)
+		}
+
+		http.Redirect(w, r, savedReferer(r), http.StatusSeeOther)
+	})))
+
+	mux.Handle("POST /saved/{bookmarkID}/delete", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		if err := posts.RemoveBookmark(currentUser.UserID, r.PathValue("bookmarkID")); err != nil {
+			fmt.Println("Error removing bookmark: ", err)
+		}
+
+		http.Redirect(w, r, savedReferer(r), http.StatusSeeOther)
+	})))
+
+	mux.Handle("GET /trash", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		p, err := posts.ListTrashPosts(currentUser.UserID)
+		if err != nil {
+			fmt.Println("Error fetching trashed posts", err)
+		}
+
+		c, err := posts.ListTrashComments(currentUser.UserID)
+		if err != nil {
+			fmt.Println("Error fetching trashed comments", err)
+		}
+
+		TemplRender(w, r, templates.Trash(currentUser, p, c))
+	})))
+
+	mux.Handle("POST /trash/posts/{postID}/restore", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		postID := r.PathValue("postID")
+		if err := posts.RestorePost(postID, currentUser.UserID); err != nil {
+			fmt.Println(err)
+			http.Redirect(w, r, "/error", http.StatusSeeOther)
+			return
+		}
+
+		http.Redirect(w, r, "/posts/"+postID, http.StatusSeeOther)
+	})))
+
+	mux.Handle("POST /trash/comments/{commentID}/restore", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commentID := r.PathValue("commentID")
+		if err := posts.RestoreComment(commentID, currentUser.UserID); err != nil {
+			fmt.Println(err)
+			http.Redirect(w, r, "/error", http.StatusSeeOther)
+			return
+		}
+
+		http.Redirect(w, r, "/trash", http.StatusSeeOther)
+	})))
+
+	mux.Handle("GET /users/suggest", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		list, err := users.Suggest(r.URL.Query().Get("q"), 8)
+		if err != nil {
+			fmt.Println("Error suggesting users: ", err)
+		}
+
+		TemplRender(w, r, templates.UserSuggestions(list))
+	})))
+
+	mux.Handle("GET /users/{handle}", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		profile, err := users.GetProfile(r.PathValue("handle"))
+		if err != nil {
+			fmt.Println("Error fetching profile: ", err)
+			w.WriteHeader(http.StatusNotFound)
+			TemplRender(w, r, templates.Error(currentUser, "Couldn't find that user."))
+			return
+		}
+
+		counts, err := users.GetFollowCounts(profile.UserID)
+		if err != nil {
+			fmt.Println("Error fetching follow counts: ", err)
+		}
+
+		var following bool
+		var relation string
+		if currentUser.UserID != "" {
+			following, err = users.IsFollowing(currentUser.UserID, profile.UserID)
+			if err != nil {
+				fmt.Println("Error checking follow: ", err)
+			}
+
+			relation, err = users.GetRelation(currentUser.UserID, profile.UserID)
+			if err != nil {
+				fmt.Println("Error checking mute/block: ", err)
+			}
+		}
+
+		tab := r.URL.Query().Get("tab")
+		page := posts.ParsePage(r.URL.Query().Get("page"))
+
+		var stats posts.UserStats
+		var postList posts.PostCollection
+		var comments []posts.UserComment
+		var more bool
+
+		if profile.ActivityVisibleTo(currentUser) {
+			stats, err = posts.GetUserStats(profile.UserID)
+			if err != nil {
+				fmt.Println("Error fetching user stats: ", err)
+			}
+
+			if tab == "comments" {
+				comments, more, err = posts.ListCommentsByUser(profile.UserID, page)
+			} else {
+				tab = "posts"
+				postList, more, err = posts.ListPostsByUser(profile.UserID, currentUser.UserID, page)
+			}
+			if err != nil {
+				fmt.Println("Error fetching user activity: ", err)
+			}
+		}
+
+		TemplRender(w, r, templates.Profile(currentUser, profile, counts, following, relation, stats, tab, page, postList, comments, more))
+	})))
+
+	mux.Handle("POST /users/{handle}/follow", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "You need to login before following someone."))
+			return
+		}
+
+		profile, err := users.GetProfile(r.PathValue("handle"))
+		if err != nil || profile.UserID == currentUser.UserID {
+			w.WriteHeader(http.StatusNotFound)
+			TemplRender(w, r, templates.Toast("error", "Couldn't follow that user."))
+			return
+		}
+
+		following, err := users.ToggleFollow(currentUser.UserID, profile.UserID)
+		if errors.Is(err, users.ErrBlocked) {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "You can't follow this user."))
+			return
+		}
+		if err != nil {
+			fmt.Println("Error toggling follow: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			TemplRender(w, r, templates.Toast("error", "Sorry, an error occurred while saving!"))
+			return
+		}
+
+		counts, err := users.GetFollowCounts(profile.UserID)
+		if err != nil {
+			fmt.Println("Error fetching follow counts: ", err)
+		}
+
+		TemplRender(w, r, templates.FollowButton(profile.Handle, following))
+		TemplRender(w, r, templates.FollowCounts(counts, "true"))
+	})))
+
+	mux.Handle("POST /users/{handle}/relation", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "You need to login first."))
+			return
+		}
+
+		profile, err := users.GetProfile(r.PathValue("handle"))
+		if err != nil || profile.UserID == currentUser.UserID {
+			w.WriteHeader(http.StatusNotFound)
+			TemplRender(w, r, templates.Toast("error", "Couldn't find that user."))
+			return
+		}
+
+		kind := r.FormValue("kind")
+		if kind == "" {
+			err = users.RemoveRelation(currentUser.UserID, profile.UserID)
+		} else {
+			err = users.SetRelation(currentUser.UserID, profile.UserID, kind)
+		}
+		if err != nil {
+			fmt.Println("Error saving mute/block: ", err)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			TemplRender(w, r, templates.Toast("error", "Sorry, an error occurred while saving!"))
+			return
+		}
+
+		TemplRender(w, r, templates.RelationButtons(profile.Handle, kind))
+		if kind == users.RelationBlock {
+			// Blocking drops follows in both directions, so refresh the counts
+			counts, err := users.GetFollowCounts(profile.UserID)
+			if err != nil {
+				fmt.Println("Error fetching follow counts: ", err)
+			}
+			TemplRender(w, r, templates.FollowCounts(counts, "true"))
+		}
+	})))
+
+	mux.Handle("GET /settings/people", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		list, err := users.ListRelations(currentUser.UserID)
+		if err != nil {
+			fmt.Println("Error fetching mutes and blocks: ", err)
+		}
+
+		TemplRender(w, r, templates.SettingsPeople(currentUser, list))
+	})))
+
+	mux.Handle("POST /tags/{tag}/follow", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "You need to login before following a tag."))
+			return
+		}
+
+		tag := r.PathValue("tag")
+		following, err := posts.ToggleFollowTag(currentUser.UserID, tag)
+		if err != nil {
+			fmt.Println("Error toggling tag follow: ", err)
+			w.WriteHeader(http.StatusNotFound)
+			TemplRender(w, r, templates.Toast("error", "Couldn't follow that tag."))
+			return
+		}
+
+		TemplRender(w, r, templates.TagFollowButton(tag, following))
+	})))
+
+	mux.Handle("GET /tags/suggest", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list, err := posts.SuggestTags(r.URL.Query().Get("q"))
+		if err != nil {
+			fmt.Println("Error suggesting tags: ", err)
+		}
+
+		TemplRender(w, r, templates.TagSuggestions(list))
+	})))
+
+	mux.Handle("GET /tags/{tag}", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag, err := posts.GetTag(r.PathValue("tag"))
+		if errors.Is(err, posts.ErrTagNotFound) {
+			// Old links to a tag that was merged away still work
+			if canonical, err := posts.TagForSynonym(r.PathValue("tag")); err == nil {
+				target := url.URL{Path: "/tags/" + canonical, RawQuery: r.URL.RawQuery}
+				http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+				return
+			}
+		}
+		if err != nil {
+			fmt.Println("Error fetching tag: ", err)
+			w.WriteHeader(http.StatusNotFound)
+			TemplRender(w, r, templates.Error(currentUser, "Couldn't find that tag."))
+			return
+		}
+
+		order := r.URL.Query().Get("order")
+		if order != posts.FeedHot {
+			order = posts.FeedNew
+		}
+		page := posts.ParsePage(r.URL.Query().Get("page"))
+
+		p, more, err := posts.ListPostsByTag(tag.Tag, currentUser.UserID, order, page)
+		if err != nil {
+			fmt.Println("Error fetching tag's posts: ", err)
+		}
+
+		var following bool
+		if currentUser.UserID != "" {
+			followed, err := posts.ListFollowedTags(currentUser.UserID)
+			if err != nil {
+				fmt.Println("Error fetching followed tags: ", err)
+			}
+			following = slices.Contains(followed, tag.Tag)
+		}
+
+		tags, err := posts.ListTags()
+		if err != nil {
+			fmt.Println("Error fetching tags", err)
+		}
+
+		TemplRender(w, r, templates.TagPage(currentUser, tag, p, order, page, more, following, tags))
+	})))
+
+	mux.Handle("POST /tags/{tag}/description", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !currentUser.IsModerator() {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "Only moderators can describe tags."))
+			return
+		}
+
+		tag := r.PathValue("tag")
+		description := strings.TrimSpace(r.FormValue("description"))
+		if err := posts.EditTagDescription(tag, description); err != nil {
+			renderTagError(w, r, err)
+			return
+		}
+
+		TemplRender(w, r, templates.TagDescription(tag, description, true))
+	})))
+
+	mux.Handle("GET /feed", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		order := r.URL.Query().Get("order")
+		if order != posts.FeedHot {
+			order = posts.FeedNew
+		}
+		page := posts.ParsePage(r.URL.Query().Get("page"))
+
+		p, more, err := posts.ListFeed(currentUser.UserID, order, page)
+		if err != nil {
+			fmt.Println("Error fetching feed: ", err)
+		}
+
+		followed, err := posts.ListFollowedTags(currentUser.UserID)
+		if err != nil {
+			fmt.Println("Error fetching followed tags: ", err)
+		}
+
+		tags, err := posts.ListTags()
+		if err != nil {
+			fmt.Println("Error fetching tags", err)
+		}
+		var t []string
+		for _, tag := range tags {
+			t = append(t, tag.Tag)
+		}
+		// ListTags only has tags in use, followed ones that aren't anymore still need an unfollow button
+		for _, f := range followed {
+			if !slices.Contains(t, f) {
+				t = append(t, f)
+			}
+		}
+
+		TemplRender(w, r, templates.Feed(currentUser, p, order, page, more, followed, t))
+	})))
+
+	mux.Handle("GET /messages", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		list, err := messages.ListConversations(currentUser.UserID)
+		if err != nil {
+			fmt.Println("Error fetching conversations: ", err)
+		}
+
+		TemplRender(w, r, templates.Messages(currentUser, list))
+	})))
+
+	mux.Handle("GET /messages/unread", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var count int
+		if currentUser.UserID != "" {
+			c, err := messages.UnreadCount(currentUser.UserID)
+			if err != nil {
+				fmt.Println("Error counting messages: ", err)
+			}
+			count = c
+		}
+
+		TemplRender(w, r, templates.MessagesBadge(count))
+	})))
+
+	mux.Handle("GET /messages/{handle}", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		profile, err := users.GetProfile(r.PathValue("handle"))
+		if err != nil || profile.UserID == currentUser.UserID {
+			TemplRender(w, r, templates.Error(currentUser, "Couldn't find that user."))
+			return
+		}
+
+		conversationID, err := messages.GetConversationID(currentUser.UserID, profile.UserID)
+		if err != nil {
+			fmt.Println("Error fetching conversation: ", err)
+		}
+
+		var list []messages.Message
+		var after int
+		if conversationID != "" {
+			list, err = messages.ListMessages(conversationID, 0)
+			if err != nil {
+				fmt.Println("Error fetching messages: ", err)
+			}
+			if len(list) > 0 {
+				after = list[len(list)-1].MessageID
+			}
+
+			if err := messages.MarkRead(conversationID, currentUser.UserID); err != nil {
+				fmt.Println("Error marking messages read: ", err)
+			}
+		}
+
+		// The thread stays readable after a block or a settings change, only sending is turned off
+		var notice string
+		if err := messages.CanMessage(currentUser.UserID, profile.UserID); errors.Is(err, messages.ErrNotAllowed) {
+			notice = profile.PreferredName + " isn't accepting messages from you."
+		} else if err != nil {
+			fmt.Println("Error checking messaging: ", err)
+		}
+
+		TemplRender(w, r, templates.MessageThread(currentUser, profile, list, after, notice))
+	})))
+
+	mux.Handle("GET /messages/{handle}/poll", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		profile, err := users.GetProfile(r.PathValue("handle"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		conversationID, err := messages.GetConversationID(currentUser.UserID, profile.UserID)
+		if err != nil {
+			fmt.Println("Error fetching conversation: ", err)
+		}
+
+		var list []messages.Message
+		if conversationID != "" {
+			after, _ := strconv.Atoi(r.FormValue("after"))
+			list, err = messages.ListMessages(conversationID, after)
+			if err != nil {
+				fmt.Println("Error fetching messages: ", err)
+			}
+		}
+
+		// Nothing new, leave the page as it is
+		if len(list) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if err := messages.MarkRead(conversationID, currentUser.UserID); err != nil {
+			fmt.Println("Error marking messages read: ", err)
+		}
+
+		TemplRender(w, r, templates.MessageBubbles(currentUser.UserID, list))
+		TemplRender(w, r, templates.MessagesPoll(profile.Handle, list[len(list)-1].MessageID, true))
+	})))
+
+	mux.Handle("POST /messages/{handle}", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Errors go to #toast, which has to be swapped whole rather than appended to like the thread
+		w.Header().Set("HX-Reswap", "outerHTML")
+
+		if currentUser.UserID == "" {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "You need to login before sending messages."))
+			return
+		}
+
+		profile, err := users.GetProfile(r.PathValue("handle"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			TemplRender(w, r, templates.Toast("error", "Couldn't find that user."))
+			return
+		}
+
+		content := strings.TrimSpace(r.FormValue("content"))
+		if msg := messages.Validate(content); msg != "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			TemplRender(w, r, templates.Toast("error", msg))
+			return
+		}
+
+		m, err := messages.Send(currentUser.UserID, profile.UserID, content)
+		if err != nil {
+			switch {
+			case errors.Is(err, messages.ErrNotAllowed):
+				w.WriteHeader(http.StatusForbidden)
+				TemplRender(w, r, templates.Toast("error", profile.PreferredName+" isn't accepting messages from you."))
+			case errors.Is(err, messages.ErrRateLimited):
+				w.WriteHeader(http.StatusTooManyRequests)
+				TemplRender(w, r, templates.Toast("error", "You're sending messages too fast, please wait a bit."))
+			default:
+				fmt.Println("Error sending message: ", err)
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				TemplRender(w, r, templates.Toast("error", "Sorry, an error occurred while sending!"))
+			}
+			return
+		}
+
+		w.Header().Del("HX-Reswap")
+
+		// Anything the other user sent since the last poll comes along too, so nothing is skipped when the poll moves on
+		after, _ := strconv.Atoi(r.FormValue("after"))
+		list, err := messages.ListMessages(m.ConversationID, after)
+		if err != nil {
+			fmt.Println("Error fetching messages: ", err)
+			list = []messages.Message{m}
+		}
+
+		TemplRender(w, r, templates.MessageBubbles(currentUser.UserID, list))
+		TemplRender(w, r, templates.MessagesPoll(profile.Handle, list[len(list)-1].MessageID, true))
+	})))
+
+	mux.Handle("GET /notifications", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser.UserID == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		list, err := notifications.List(currentUser.UserID, 100)
+		if err != nil {
+			fmt.Println("Error fetching notifications: ", err)
+			TemplRender(w, r, templates.Error(currentUser, "Error!"))
+			return
+		}
+
+		TemplRender(w, r, templates.Notifications(currentUser, list))
+	})))
+
+	mux.Handle("GET /notifications/unread", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var count int
+		if currentUser.UserID != "" {
+			c, err := notifications.UnreadCount(currentUser.UserID)
+			if err != nil {
+				fmt.Println("Error counting notifications: ", err)
+			}
+			count = c
+		}
+
+		TemplRender(w, r, templates.NotificationsBadge(count, ""))
+	})))
+
+	// Opening a notification marks it read on the way to whatever it's about
+	mux.Handle("GET /notifications/{notificationID}", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := notifications.MarkRead(r.PathValue("notificationID"), currentUser.UserID)
+		if err != nil {
+			fmt.Println("Error marking notification read: ", err)
+			http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+			return
+		}
+
+		http.Redirect(w, r, n.Link(), http.StatusSeeOther)
+	})))
+
+	mux.Handle("POST /notifications/{notificationID}/read", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := notifications.MarkRead(r.PathValue("notificationID"), currentUser.UserID); err != nil {
+			fmt.Println("Error marking notification read: ", err)
+		}
+
+		list, err := notifications.List(currentUser.UserID, 100)
+		if err != nil {
+			fmt.Println("Error fetching notifications: ", err)
+		}
+		count, err := notifications.UnreadCount(currentUser.UserID)
+		if err != nil {
+			fmt.Println("Error counting notifications: ", err)
+		}
+
+		TemplRender(w, r, templates.NotificationsList(list))
+		TemplRender(w, r, templates.NotificationsBadge(count, "true"))
+	})))
+
+	mux.Handle("POST /notifications/read", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := notifications.MarkAllRead(currentUser.UserID); err != nil {
+			fmt.Println("Error marking notifications read: ", err)
+		}
+
+		list, err := notifications.List(currentUser.UserID, 100)
+		if err != nil {
+			fmt.Println("Error fetching notifications: ", err)
+		}
+
+		TemplRender(w, r, templates.NotificationsList(list))
+		TemplRender(w, r, templates.NotificationsBadge(0, "true"))
+	})))
+
+	mux.Handle("GET /admin/jobs", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !currentUser.IsModerator() {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Error(currentUser, "Not allowed!"))
+			return
+		}
+
+		stats, err := jobs.Stats()
+		if err != nil {
+			fmt.Println("Error fetching job stats: ", err)
+		}
+
+		failed, err := jobs.Failed(50)
+		if err != nil {
+			fmt.Println("Error fetching failed jobs: ", err)
+		}
+
+		schedules, err := jobs.Schedules()
+		if err != nil {
+			fmt.Println("Error fetching job schedules: ", err)
+		}
+
+		TemplRender(w, r, templates.AdminJobs(currentUser, stats, failed, schedules))
+	})))
+
+	mux.Handle("POST /admin/jobs/{jobID}/retry", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !currentUser.IsModerator() {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "Only moderators can retry jobs."))
+			return
+		}
+
+		if err := jobs.Retry(r.PathValue("jobID")); err != nil {
+			fmt.Println("Error retrying job: ", err)
+			w.WriteHeader(http.StatusBadRequest)
+			TemplRender(w, r, templates.Toast("error", "That job can't be retried."))
+			return
+		}
+
+		failed, err := jobs.Failed(50)
+		if err != nil {
+			fmt.Println("Error fetching failed jobs: ", err)
+		}
+
+		TemplRender(w, r, templates.AdminJobsFailed(failed))
+	})))
+
+	mux.Handle("GET /admin/tags", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !currentUser.IsModerator() {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Error(currentUser, "Not allowed!"))
+			return
+		}
+
+		tags, err := posts.ListAllTags()
+		if err != nil {
+			fmt.Println("Error fetching tags: ", err)
+		}
+
+		synonyms, err := posts.ListSynonyms()
+		if err != nil {
+			fmt.Println("Error fetching tag synonyms: ", err)
+		}
+
+		TemplRender(w, r, templates.AdminTags(currentUser, tags, synonyms))
+	})))
+
+	mux.Handle("POST /admin/tags/{action}", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !currentUser.IsModerator() {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "Only moderators can manage tags."))
+			return
+		}
+
+		var message string
+		var err error
+		switch r.PathValue("action") {
+		case "rename":
+			err = posts.RenameTag(r.FormValue("from"), r.FormValue("to"))
+			message = "Tag renamed."
+		case "merge":
+			err = posts.MergeTags(r.FormValue("from"), r.FormValue("into"))
+			message = "Tags merged."
+		case "synonyms":
+			err = posts.AddSynonym(r.FormValue("synonym"), r.FormValue("tag"))
+			message = "Synonym added."
+		case "prune":
+			var n int64
+			n, err = posts.DeleteOrphanTags()
+			message = fmt.Sprintf("Deleted %d unused tags.", n)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			renderTagError(w, r, err)
+			return
+		}
+
+		renderAdminTags(w, r, message)
+	})))
+
+	mux.Handle("POST /admin/tags/synonyms/{synonym}/delete", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !currentUser.IsModerator() {
+			w.WriteHeader(http.StatusForbidden)
+			TemplRender(w, r, templates.Toast("error", "Only moderators can manage tags."))
+			return
+		}
+
+		if err := posts.RemoveSynonym(r.PathValue("synonym")); err != nil {
+			renderTagError(w, r, err)
+			return
+		}
+
+		renderAdminTags(w, r, "Synonym removed.")
+	})))
+
+	mux.HandleFunc("GET /admin/reset", func(w http.ResponseWriter, r *http.Request) {
+		if os.Getenv("DEV_ENV") == "TRUE" {
+			err := database.Reset()
+			if err != nil {
+				fmt.Println(err)
+				w.Write([]byte("Reset failed, errored out"))
+				return
+			}
+			if err := moods.Reload(); err != nil {
+				fmt.Println("Error loading moods: ", err)
+			}
+
+			t := time.Now().Format(time.RFC3339)
+
+			TemplRender(w, r, templates.Reset("", t))
+		} else {
+			w.Write([]byte("Not allowed!"))
+		}
+	})
+
+	mux.Handle("GET /settings", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ref := r.URL.Query().Get("r")
+		err := currentUser.GetSettings(currentUser.UserID)
+		if err != nil {
+			fmt.Println("Error fetching settings: ", err)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		}
+
+		switch ref {
+		case "firstlogin":
+			fmt.Println("in switch")
+			TemplRender(w, r, templates.SettingsFirstLogin(currentUser))
+			return
+		}
+		TemplRender(w, r, templates.Settings(currentUser))
+	})))
+
+	mux.Handle("POST /settings/edit", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := users.Settings{
+			PreferredName: r.FormValue("preferred-name"),
+			ContactMe:     r.FormValue("contact-me"),
+			Avatar:        r.FormValue("avatar-radio"),
+			SortComments:  r.FormValue("sort-comments"),
+			Digest:        r.FormValue("digest"),
+			HideActivity:  r.FormValue("hide-activity"),
+			AutoSubscribe: r.FormValue("auto-subscribe"),
+		}
+
+		if err := users.Validate(f); err != nil {
+			fmt.Println(err)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			TemplRender(w, r, templates.Toast("error", "Sorry, an error occurred while saving!"))
+			return
+		}
+
+		if err := users.SaveSettings(currentUser.UserID, f); err != nil {
+			fmt.Println("Error saving: ", err)
+			http.Redirect(w, r, "/error", http.StatusSeeOther)
+		}
+
+		err := currentUser.GetSettings(currentUser.UserID)
+		if err != nil {
+			fmt.Println("Error fetching settings: ", err)
+			http.Redirect(w, r, "/error", http.StatusSeeOther)
+		}
+
+		session, err := k.store.Get(r, "grumplr_kc_session")
+		if err != nil {
+			fmt.Println("Failed to access grumplr_kc_session", err)
+		}
+		session.Values["PreferredName"] = currentUser.PreferredName
+		session.Values["Avatar"] = currentUser.Avatar
+		session.Values["AvatarPath"] = currentUser.AvatarPath
+		session.Values["SortComments"] = currentUser.SortComments
+		err = session.Save(r, w)
+		if err != nil {
+			fmt.Println("Failed to delete grumplr_kc_session", err)
+		}
+
+		TemplRender(w, r, templates.PartialSettingsEditSuccess(*currentUser))
+	})))
+
+	mux.Handle("POST /settings/avatar", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := parseUploadForm(w, r); err != nil {
+			fmt.Println(err)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			TemplRender(w, r, templates.Toast("error", "That image is too large."))
+			return
+		}
+
+		files := formFiles(r, "avatar-file")
+		if len(files) != 1 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			TemplRender(w, r, templates.Toast("error", "Please choose an image first."))
+			return
+		}
+
+		// Unparseable values fall back to a centred, unzoomed crop
+		c := uploads.Crop{Zoom: 1, X: 0.5, Y: 0.5}
+		if v, err := strconv.ParseFloat(r.FormValue("crop-zoom"), 64); err == nil {
+			c.Zoom = v
+		}
+		if v, err := strconv.ParseFloat(r.FormValue("crop-x"), 64); err == nil {
+			c.X = v
+		}
+		if v, err := strconv.ParseFloat(r.FormValue("crop-y"), 64); err == nil {
+			c.Y = v
+		}
+
+		hash, err := uploads.SaveAvatar(files[0], c)
+		if err != nil {
+			msg := "Sorry, an error occurred while saving!"
+			var v *uploads.ValidationError
+			if errors.As(err, &v) {
+				msg = v.Message
+			} else {
+				fmt.Println("Error saving avatar: ", err)
+			}
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			TemplRender(w, r, templates.Toast("error", msg))
+			return
+		}
+
+		if err := users.SaveAvatarUpload(currentUser.UserID, hash); err != nil {
+			fmt.Println("Error saving avatar: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			TemplRender(w, r, templates.Toast("error", "Sorry, an error occurred while saving!"))
+			return
+		}
+
+		if err := currentUser.GetSettings(currentUser.UserID); err != nil {
+			fmt.Println("Error fetching settings: ", err)
+		}
+
+		session, err := k.store.Get(r, "grumplr_kc_session")
+		if err != nil {
+			fmt.Println("Failed to access grumplr_kc_session", err)
+		}
+		session.Values["Avatar"] = currentUser.Avatar
+		session.Values["AvatarPath"] = currentUser.AvatarPath
+		if err := session.Save(r, w); err != nil {
+			fmt.Println("Failed to save grumplr_kc_session", err)
+		}
+
+		w.Header().Set("HX-Refresh", "true")
+	})))
+
+	// Linked from every notification email. POST is also what mail clients send for one-click unsubscribe (RFC 8058).
+	mux.Handle("GET /unsubscribe", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := r.URL.Query().Get("t")
+		if _, ok := mail.VerifyUnsubscribeToken(t); !ok {
+			TemplRender(w, r, templates.Error(currentUser, "This unsubscribe link is invalid."))
+			return
+		}
+
+		TemplRender(w, r, templates.Unsubscribe(currentUser, t, false))
+	})))
+
+	mux.Handle("POST /unsubscribe", k.CheckAuthentication(currentUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := r.FormValue("t")
+		userID, ok := mail.VerifyUnsubscribeToken(t)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			TemplRender(w, r, templates.Error(currentUser, "This unsubscribe link is invalid."))
+			return
+		}
+
+		if err := users.Unsubscribe(userID); err != nil {
+			fmt.Println("Error unsubscribing: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			TemplRender(w, r, templates.Error(currentUser, "Error!"))
+			return
+		}
+
+		TemplRender(w, r, templates.Unsubscribe(currentUser, "", true))
+	})))
+
+	//--------------------------------------
 	// Auth handles
 	//--------------------------------------
 	mux.HandleFunc("GET /login", func(w http.ResponseWriter, r *http.Request) {
@@ -611,6 +1901,33 @@ func main() {
 
 	mux.Handle("GET /static/", http.StripPrefix("/static", http.FileServer(http.Dir("./static"))))
 
+	// Blob keys are content hashes, so these get the same long-lived caching as /static/ (see cacheFiles)
+	mux.HandleFunc("GET /uploads/{hash}/{file}", func(w http.ResponseWriter, r *http.Request) {
+		f, modified, err := uploads.Store.Open(r.PathValue("hash") + "/" + r.PathValue("file"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("ETag", fmt.Sprintf(`"%s-%s"`, r.PathValue("hash"), strings.TrimSuffix(r.PathValue("file"), ".webp")))
+		http.ServeContent(w, r, r.PathValue("file"), modified, f)
+	})
+
+	// Identicons never change for a given seed, ServeContent answers If-None-Match with a 304
+	mux.HandleFunc("GET /avatars/identicon/{seed}", func(w http.ResponseWriter, r *http.Request) {
+		seed := r.PathValue("seed")
+		if len(seed) > 64 {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("ETag", fmt.Sprintf(`"identicon-%s"`, seed))
+		http.ServeContent(w, r, "identicon.svg", time.Time{}, bytes.NewReader(users.Identicon(seed)))
+	})
+
 	/////////////////////////////////
 	// Gocloak
 	////////////////////////////////
@@ -644,9 +1961,219 @@ func main() {
 
 	var p string = os.Getenv("LISTEN_ADDR")
 	wrappedMux := StatusLogger(ExcludeCompression(SetCacheControl(mux)))
-	http.ListenAndServe(p, wrappedMux)
+
+	// Workers run in this process and outlive the server by a little: on SIGTERM the server stops taking requests first,
+	// then the workers finish whatever job they're on. Anything still queued is picked up after the restart.
+	workers, err := strconv.Atoi(envOr("JOB_WORKERS", strconv.Itoa(defaultJobWorkers)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	workersDone := jobs.Start(workersCtx, workers, jobPollInterval)
+
+	srv := &http.Server{Addr: p, Handler: wrappedMux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	fmt.Println("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("Error shutting down server: ", err)
+	}
+
+	stopWorkers()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		fmt.Println("Error shutting down: jobs still running")
+	}
+}
+
+func envOr(key string, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
 }
 
 func TemplRender(w http.ResponseWriter, r *http.Request, c templ.Component) {
 	c.Render(r.Context(), w)
 }
+
+// renderSaved renders the /saved page for the collection and page in the query string.
+func renderSaved(w http.ResponseWriter, r *http.Request, currentUser *users.User, formError string) {
+	collection := r.URL.Query().Get("collection")
+	page := posts.ParsePage(r.URL.Query().Get("page"))
+
+	collections, err := posts.ListCollections(currentUser.UserID)
+	if err != nil {
+		fmt.Println("Error fetching collections: ", err)
+	}
+
+	bookmarks, more, err := posts.ListBookmarks(currentUser.UserID, collection, page)
+	if err != nil {
+		fmt.Println("Error fetching bookmarks: ", err)
+	}
+
+	TemplRender(w, r, templates.Saved(currentUser, collections, collection, bookmarks, page, more, formError))
+}
+
+// savedReferer sends forms on the /saved page back to the collection and page they were submitted from.
+func savedReferer(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil || u.Path != "/saved" {
+		return "/saved"
+	}
+
+	return "/saved?" + u.RawQuery
+}
+
+// insightsFilter reads the date range and user of the insights page from the query string. An invalid range or a user
+// whose activity is hidden falls back to the defaults, with a message saying why.
+func insightsFilter(r *http.Request, currentUser *users.User) (insights.Filter, string, string) {
+	q := r.URL.Query()
+
+	f, formError := insights.ParseFilter(q.Get("from"), q.Get("to"), time.Now())
+	if formError != "" {
+		f, _ = insights.ParseFilter("", "", time.Now())
+	}
+
+	handle := q.Get("user")
+	if handle == "" {
+		return f, "", formError
+	}
+
+	profile, err := users.GetProfile(handle)
+	if err != nil || !profile.ActivityVisibleTo(currentUser) {
+		return f, "", "Couldn't find that user's activity, showing the whole site."
+	}
+	f.UserID = profile.UserID
+
+	return f, profile.Handle, formError
+}
+
+// parseUploadForm caps the request body and parses it, so handlers taking attachments don't fall back to
+// FormValue's default 32 MB limit. Plain urlencoded forms are parsed as usual.
+func parseUploadForm(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, uploads.MaxRequestSize)
+	if err := r.ParseMultipartForm(1 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return err
+	}
+
+	return nil
+}
+
+func formFiles(r *http.Request, name string) []*multipart.FileHeader {
+	if r.MultipartForm == nil {
+		return nil
+	}
+
+	return r.MultipartForm.File[name]
+}
+
+// saveAttachments returns a message for display if the images couldn't be saved.
+func saveAttachments(files []*multipart.FileHeader) ([]uploads.Image, string) {
+	images, err := uploads.Save(files)
+	if err != nil {
+		var v *uploads.ValidationError
+		if errors.As(err, &v) {
+			return nil, v.Message
+		}
+
+		fmt.Println("Error saving attachments: ", err)
+		return nil, "Couldn't save the images, please try again."
+	}
+
+	return images, ""
+}
+
+// renderAdminTags renders the tag admin page's content after a change, message saying what was done.
+func renderAdminTags(w http.ResponseWriter, r *http.Request, message string) {
+	tags, err := posts.ListAllTags()
+	if err != nil {
+		fmt.Println("Error fetching tags: ", err)
+	}
+
+	synonyms, err := posts.ListSynonyms()
+	if err != nil {
+		fmt.Println("Error fetching tag synonyms: ", err)
+	}
+
+	TemplRender(w, r, templates.AdminTagsContent(tags, synonyms, message))
+}
+
+// renderTagError shows why a tag change was refused. The tag functions' own errors are about the input and
+// are shown as they are, anything else is logged.
+func renderTagError(w http.ResponseWriter, r *http.Request, err error) {
+	for _, known := range []error{posts.ErrTagNotFound, posts.ErrTagExists, posts.ErrTagIsSynonym, posts.ErrSameTag, posts.ErrSynonymNotFound, posts.ErrTagInvalid, posts.ErrTagDescriptionTooLong} {
+		if errors.Is(err, known) {
+			msg := known.Error()
+			w.WriteHeader(http.StatusBadRequest)
+			TemplRender(w, r, templates.Toast("error", strings.ToUpper(msg[:1])+msg[1:]+"."))
+			return
+		}
+	}
+
+	fmt.Println("Error changing tags: ", err)
+	w.WriteHeader(http.StatusInternalServerError)
+	TemplRender(w, r, templates.Toast("error", "Something went wrong, please try again."))
+}
+
+// renderPresets renders the user's presets bar with selected picked.
+func renderPresets(w http.ResponseWriter, r *http.Request, userID string, selected int) {
+	presets, err := users.ListPresets(userID)
+	if err != nil {
+		fmt.Println("Error fetching filter presets: ", err)
+	}
+
+	TemplRender(w, r, templates.FilterPresets(presets, selected))
+}
+
+func renderPresetError(w http.ResponseWriter, r *http.Request, err error) {
+	for _, known := range []error{users.ErrPresetName, users.ErrPresetNotFound, users.ErrPresetsFull} {
+		if errors.Is(err, known) {
+			msg := known.Error()
+			w.WriteHeader(http.StatusBadRequest)
+			TemplRender(w, r, templates.Toast("error", strings.ToUpper(msg[:1])+msg[1:]+"."))
+			return
+		}
+	}
+
+	fmt.Println("Error saving filter preset: ", err)
+	w.WriteHeader(http.StatusInternalServerError)
+	TemplRender(w, r, templates.Toast("error", "Something went wrong, please try again."))
+}
+
+// parseQuery reads a query string saved by the app itself, so it can't fail in practice.
+func parseQuery(query string) url.Values {
+	v, err := url.ParseQuery(query)
+	if err != nil {
+		fmt.Println("Error parsing saved query: ", err)
+	}
+
+	return v
+}
+
+func serveFeed(w http.ResponseWriter, r *http.Request, f feeds.Feed, format string, err error) {
+	if errors.Is(err, feeds.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err == nil {
+		err = feeds.Serve(w, r, f, format)
+	}
+	if err != nil {
+		fmt.Println("Error serving feed: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,88 @@
+package markdown
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// Only a CommonMark subset is supported: paragraphs, links, emphasis, code, quotes and lists.
+// Goldmark parses everything, the sanitizer policy below then drops whatever isn't on the allowlist
+// (headings, images, tables etc. are reduced to their text).
+// Raw HTML in the source is never passed through, since html.WithUnsafe() isn't set.
+// Hard wraps keep single newlines as line breaks, the way plain text comments used to look.
+// @handle mentions link to the user's profile, see mention.go.
+var md = goldmark.New(
+	goldmark.WithExtensions(mentionExtension{}),
+	goldmark.WithRendererOptions(
+		html.WithHardWraps(),
+	),
+)
+
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+
+	p.AllowElements("p", "br", "em", "strong", "code", "pre", "blockquote", "ul", "ol", "li")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	p.AllowRelativeURLs(false)
+	p.RequireNoFollowOnLinks(true)
+	p.RequireNoReferrerOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	return p
+}
+
+// Rendered output is cached by a hash of the source, so each revision of a comment or description is only rendered once.
+// The cache is dropped wholesale once it reaches maxCached entries, which is simpler than LRU bookkeeping and good enough
+// for the sizes involved.
+const maxCached = 5000
+
+var (
+	cacheMu sync.RWMutex
+	cache   = make(map[[sha256.Size]byte]string)
+)
+
+// Render converts markdown source into sanitized HTML that is safe to output unescaped.
+func Render(src string) string {
+	if src == "" {
+		return ""
+	}
+
+	key := sha256.Sum256([]byte(src))
+
+	cacheMu.RLock()
+	out, ok := cache[key]
+	cacheMu.RUnlock()
+	if ok {
+		return out
+	}
+
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(stripSentinels.Replace(src)), &buf); err != nil {
+		fmt.Println("Error rendering markdown: ", err)
+		// Fall back to the escaped source rather than nothing
+		return bluemonday.StrictPolicy().Sanitize(src)
+	}
+
+	out = linkMentions(policy.Sanitize(buf.String()))
+
+	cacheMu.Lock()
+	if len(cache) >= maxCached {
+		cache = make(map[[sha256.Size]byte]string)
+	}
+	cache[key] = out
+	cacheMu.Unlock()
+
+	return out
+}
@@ -0,0 +1,164 @@
+package markdown
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestRenderFormatting(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"emphasis", "*soft* and **loud**", "<em>soft</em> and <strong>loud</strong>"},
+		{"inline code", "use `rm -rf` carefully", "<code>rm -rf</code>"},
+		{"code block", "```\nfmt.Println()\n```", "<pre><code>fmt.Println()\n</code></pre>"},
+		{"quote", "> they said what", "<blockquote>"},
+		{"unordered list", "- one\n- two", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>"},
+		{"ordered list", "3. three\n4. four", `<ol start="3">`},
+		{"link", "[docs](https://example.com/docs)", `<a href="https://example.com/docs" rel="nofollow noreferrer noopener" target="_blank">docs</a>`},
+		{"hard wrap", "line one\nline two", "line one<br>"},
+		{"heading stripped", "# Big", "Big"},
+		{"image stripped", "![cat](https://example.com/cat.png)", "<p></p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.src)
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("Render(%q) = %q, want it to contain %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderEmpty(t *testing.T) {
+	if got := Render(""); got != "" {
+		t.Errorf("Render(\"\") = %q, want empty", got)
+	}
+}
+
+// Each entry is an attempt to get script execution, a handler attribute or a dangerous URL into the output.
+var xssCorpus = []string{
+	`<script>alert(1)</script>`,
+	`<SCRIPT SRC=//evil.example/xss.js></SCRIPT>`,
+	`<img src=x onerror=alert(1)>`,
+	`<svg/onload=alert(1)>`,
+	`<iframe src="javascript:alert(1)"></iframe>`,
+	`<a href="javascript:alert(1)">click</a>`,
+	`[click](javascript:alert(1))`,
+	`[click](JaVaScRiPt:alert(1))`,
+	`[click](  javascript:alert(1))`,
+	`[click](java&#09;script:alert(1))`,
+	`[click](&#106;avascript:alert(1))`,
+	`[click](vbscript:msgbox(1))`,
+	`[click](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)`,
+	`![x](javascript:alert(1))`,
+	`![x" onerror="alert(1)](https://example.com/x.png)`,
+	`[x](https://example.com/" onmouseover="alert(1))`,
+	`<a href="https://example.com" onclick="alert(1)">x</a>`,
+	`<div style="background:url(javascript:alert(1))">x</div>`,
+	`<style>body{background:red}</style>`,
+	`<object data="javascript:alert(1)"></object>`,
+	`<embed src="javascript:alert(1)">`,
+	`<form action="javascript:alert(1)"><button>x</button></form>`,
+	`<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`,
+	`<<script>script>alert(1)<</script>/script>`,
+	`<scr<script>ipt>alert(1)</scr</script>ipt>`,
+	"`<script>alert(1)</script>`",
+	"```html\n<script>alert(1)</script>\n```",
+	`> <img src=x onerror=alert(1)>`,
+	`- <svg><script>alert(1)</script></svg>`,
+	`<!--<script>alert(1)//-->`,
+	`<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`,
+	`<base href="javascript:alert(1)//">`,
+	`<details open ontoggle=alert(1)>`,
+	`<a href="&#x6A;&#x61;&#x76;&#x61;&#x73;&#x63;&#x72;&#x69;&#x70;&#x74;:alert(1)">x</a>`,
+	`[x](<javascript:alert(1)>)`,
+	"[x]\n\n[x]: javascript:alert(1)",
+	`<https://example.com/"onmouseover="alert(1)>`,
+	`<javascript:alert(1)>`,
+}
+
+var allowedTags = map[string]bool{"p": true, "br": true, "em": true, "strong": true, "code": true, "pre": true, "blockquote": true, "ul": true, "ol": true, "li": true, "a": true}
+
+var allowedAttrs = map[string]bool{"href": true, "rel": true, "target": true, "start": true}
+
+// TestRenderXSSCorpus tokenizes the output, so text that merely mentions "javascript:" or "onerror" is fine,
+// but any tag, attribute or link scheme outside the allowlist fails.
+func TestRenderXSSCorpus(t *testing.T) {
+	for _, src := range xssCorpus {
+		got := Render(src)
+
+		z := html.NewTokenizer(strings.NewReader(got))
+		for {
+			tt := z.Next()
+			if tt == html.ErrorToken {
+				break
+			}
+
+			switch tt {
+			case html.CommentToken:
+				t.Errorf("Render(%q) = %q, contains a comment", src, got)
+			case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+				tok := z.Token()
+				if !allowedTags[tok.Data] {
+					t.Errorf("Render(%q) = %q, contains tag <%s>", src, got, tok.Data)
+				}
+
+				for _, a := range tok.Attr {
+					if !allowedAttrs[a.Key] {
+						t.Errorf("Render(%q) = %q, contains attribute %q", src, got, a.Key)
+					}
+
+					if a.Key == "href" {
+						u, err := url.Parse(a.Val)
+						if err != nil {
+							t.Errorf("Render(%q) = %q, contains unparseable href %q", src, got, a.Val)
+							continue
+						}
+						if s := strings.ToLower(u.Scheme); s != "http" && s != "https" && s != "mailto" {
+							t.Errorf("Render(%q) = %q, contains href with scheme %q", src, got, u.Scheme)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRenderMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"mention", "hey @Grumpy_Cat", `hey <a href="/users/grumpy_cat" class="mention link link-accent">@grumpy_cat</a>`},
+		{"email", "mail bob@example.com", "mail bob@example.com"},
+		{"inline code", "`@nobody`", "<code>@nobody</code>"},
+		{"too short", "@ab", "@ab"},
+		{"typed sentinels", "\uE000admin\uE001", "<p>admin</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.src)
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("Render(%q) = %q, want it to contain %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMentions(t *testing.T) {
+	got := Mentions("@alice and @Bob, again @alice, not `@carol` or dave@example.com")
+	want := []string{"alice", "bob"}
+
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Mentions() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,116 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Handles are 3 to 30 letters, digits or underscores, compared lowercase. users.ValidHandle enforces the same.
+const (
+	minHandle = 3
+	maxHandle = 30
+)
+
+// Mentions are parsed as their own inline node so "@name" inside code, links or an email address isn't one.
+// The sanitizer doesn't allow relative links in user content, so the node is rendered as the handle between two
+// private-use sentinels, and turned into a link only after sanitizing. Sentinels typed by the user are stripped
+// before parsing, and the handle is re-matched against the handle rules, so nothing else can come out as a link.
+const (
+	mentionOpen  = "\uE000"
+	mentionClose = "\uE001"
+)
+
+var (
+	kindMention    = ast.NewNodeKind("Mention")
+	mentionLink    = regexp.MustCompile(mentionOpen + `([a-z0-9_]{3,30})` + mentionClose)
+	stripSentinels = strings.NewReplacer(mentionOpen, "", mentionClose, "")
+)
+
+type mention struct {
+	ast.BaseInline
+	Handle string
+}
+
+func (n *mention) Kind() ast.NodeKind {
+	return kindMention
+}
+
+func (n *mention) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Handle": n.Handle}, nil)
+}
+
+type mentionParser struct{}
+
+func (mentionParser) Trigger() []byte {
+	return []byte{'@'}
+}
+
+func (mentionParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	// bob@example.com isn't a mention
+	if isHandleChar(block.PrecendingCharacter()) {
+		return nil
+	}
+
+	line, _ := block.PeekLine()
+	n := 1
+	for n < len(line) && n <= maxHandle+1 && isHandleChar(rune(line[n])) {
+		n++
+	}
+	if n-1 < minHandle || n-1 > maxHandle {
+		return nil
+	}
+
+	block.Advance(n)
+	return &mention{Handle: strings.ToLower(string(line[1:n]))}
+}
+
+func isHandleChar(r rune) bool {
+	return r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+type mentionRenderer struct{}
+
+func (mentionRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMention, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			w.WriteString(mentionOpen + node.(*mention).Handle + mentionClose)
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+type mentionExtension struct{}
+
+func (mentionExtension) Extend(m goldmark.Markdown) {
+	// Ahead of the emphasis parser, so underscores in a handle aren't read as emphasis
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(mentionParser{}, 50)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(mentionRenderer{}, 500)))
+}
+
+func linkMentions(html string) string {
+	return mentionLink.ReplaceAllString(html, `<a href="/users/$1" class="mention link link-accent">@$1</a>`)
+}
+
+// Mentions returns the distinct handles mentioned in src, lowercased, in order of first appearance.
+func Mentions(src string) []string {
+	doc := md.Parser().Parse(text.NewReader([]byte(stripSentinels.Replace(src))))
+
+	var handles []string
+	seen := make(map[string]bool)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if m, ok := n.(*mention); ok && entering && !seen[m.Handle] {
+			seen[m.Handle] = true
+			handles = append(handles, m.Handle)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	return handles
+}
@@ -0,0 +1,222 @@
+package messages
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"gorant/database"
+	"gorant/users"
+)
+
+const (
+	MaxLength = 2000
+	// Loaded when a thread is opened, older messages aren't shown
+	threadLimit = 100
+)
+
+// Rate limits per sender, across all their conversations
+const (
+	perMinute = 10
+	perHour   = 100
+)
+
+var (
+	ErrNotAllowed  = errors.New("error: user doesn't accept messages from sender")
+	ErrRateLimited = errors.New("error: sending messages too fast")
+)
+
+type Conversation struct {
+	ConversationID string         `db:"conversation_id"`
+	OtherID        string         `db:"other_id"`
+	Handle         string         `db:"handle"`
+	PreferredName  string         `db:"preferred_name"`
+	Avatar         string         `db:"avatar"`
+	AvatarPath     string         // Of the other user
+	LastMessage    sql.NullString `db:"last_message"`
+	LastMessageAt  sql.NullString `db:"last_message_at"`
+	Unread         int            `db:"unread"`
+}
+
+type Message struct {
+	MessageID      int            `db:"message_id"`
+	ConversationID string         `db:"conversation_id"`
+	SenderID       string         `db:"sender_id"`
+	Content        string         `db:"content"`
+	CreatedAt      string         `db:"created_at"`
+	ReadAt         sql.NullString `db:"read_at"`
+}
+
+// pair orders two user IDs the way conversations stores them
+func pair(a string, b string) (string, string) {
+	if a > b {
+		return b, a
+	}
+
+	return a, b
+}
+
+// Validate checks a message before sending, returning a message for the form when it's not sendable.
+func Validate(content string) string {
+	switch {
+	case content == "":
+		return "Please enter a message."
+	case len([]rune(content)) > MaxLength:
+		return "Messages are limited to 2000 characters."
+	}
+
+	return ""
+}
+
+// CanMessage returns ErrNotAllowed unless recipient accepts messages and neither has blocked the other.
+func CanMessage(senderID string, recipientID string) error {
+	if senderID == recipientID {
+		return ErrNotAllowed
+	}
+
+	var contactMe int
+	if err := database.DB.QueryRow("SELECT contact_me FROM users WHERE user_id=$1", recipientID).Scan(&contactMe); err != nil {
+		return err
+	}
+	if contactMe != 1 {
+		return ErrNotAllowed
+	}
+
+	for _, ids := range [][2]string{{recipientID, senderID}, {senderID, recipientID}} {
+		blocked, err := users.HasBlocked(ids[0], ids[1])
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrNotAllowed
+		}
+	}
+
+	return nil
+}
+
+func checkRate(senderID string) error {
+	now := time.Now()
+
+	var lastMinute, lastHour int
+	err := database.DB.QueryRow(`SELECT COUNT(1) FILTER (WHERE created_at::TIMESTAMPTZ > $2::TIMESTAMPTZ), COUNT(1)
+								FROM messages
+								WHERE sender_id=$1 AND created_at::TIMESTAMPTZ > $3::TIMESTAMPTZ`, senderID, now.Add(-time.Minute).Format(time.RFC3339), now.Add(-time.Hour).Format(time.RFC3339)).Scan(&lastMinute, &lastHour)
+	if err != nil {
+		return err
+	}
+
+	if lastMinute >= perMinute || lastHour >= perHour {
+		return ErrRateLimited
+	}
+
+	return nil
+}
+
+// Send delivers a message, starting the conversation between the two users if there isn't one yet.
+func Send(senderID string, recipientID string, content string) (Message, error) {
+	var m Message
+
+	if err := CanMessage(senderID, recipientID); err != nil {
+		return m, err
+	}
+	if err := checkRate(senderID); err != nil {
+		return m, err
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return m, err
+	}
+	defer tx.Rollback()
+
+	t := time.Now().Format(time.RFC3339)
+	a, b := pair(senderID, recipientID)
+	err = tx.QueryRow(`INSERT INTO conversations (user_a, user_b, created_at, last_message_at) VALUES ($1, $2, $3, $3)
+						ON CONFLICT (user_a, user_b) DO UPDATE SET last_message_at=EXCLUDED.last_message_at
+						RETURNING conversation_id`, a, b, t).Scan(&m.ConversationID)
+	if err != nil {
+		return m, err
+	}
+
+	err = tx.QueryRow(`INSERT INTO messages (conversation_id, sender_id, content, created_at) VALUES ($1, $2, $3, $4)
+						RETURNING message_id`, m.ConversationID, senderID, content, t).Scan(&m.MessageID)
+	if err != nil {
+		return m, err
+	}
+
+	m.SenderID = senderID
+	m.Content = content
+	m.CreatedAt = t
+
+	return m, tx.Commit()
+}
+
+// ListConversations returns userID's conversations, most recently active first.
+func ListConversations(userID string) ([]Conversation, error) {
+	var list []Conversation
+
+	err := database.DB.Select(&list, `SELECT conversations.conversation_id, users.user_id AS other_id, COALESCE(users.handle, '') AS handle, users.preferred_name, users.avatar,
+										last.content AS last_message, conversations.last_message_at,
+										(SELECT COUNT(1) FROM messages WHERE messages.conversation_id=conversations.conversation_id AND messages.sender_id<>$1 AND messages.read_at IS NULL) AS unread
+									FROM conversations
+										INNER JOIN users ON users.user_id = CASE WHEN conversations.user_a=$1 THEN conversations.user_b ELSE conversations.user_a END
+										LEFT JOIN LATERAL (SELECT content FROM messages WHERE messages.conversation_id=conversations.conversation_id ORDER BY message_id DESC LIMIT 1) AS last ON true
+									WHERE conversations.user_a=$1 OR conversations.user_b=$1
+									ORDER BY conversations.last_message_at::TIMESTAMPTZ DESC NULLS LAST`, userID)
+	if err != nil {
+		return list, err
+	}
+
+	for i := range list {
+		list[i].AvatarPath = users.ChooseAvatar(list[i].Avatar, list[i].OtherID)
+	}
+
+	return list, nil
+}
+
+// GetConversationID returns the ID of the conversation between two users, or "" if they've never messaged.
+func GetConversationID(userID string, otherID string) (string, error) {
+	var id string
+	a, b := pair(userID, otherID)
+	err := database.DB.QueryRow("SELECT conversation_id FROM conversations WHERE user_a=$1 AND user_b=$2", a, b).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return id, err
+}
+
+// ListMessages returns the messages in a conversation after message afterID, oldest first.
+// With afterID 0 it's the latest threadLimit messages, for opening the thread.
+func ListMessages(conversationID string, afterID int) ([]Message, error) {
+	var list []Message
+
+	err := database.DB.Select(&list, `SELECT * FROM (
+										SELECT message_id, conversation_id, sender_id, content, created_at, read_at
+										FROM messages
+										WHERE conversation_id=$1 AND message_id > $2
+										ORDER BY message_id DESC
+										LIMIT $3
+									) AS latest
+									ORDER BY message_id`, conversationID, afterID, threadLimit)
+
+	return list, err
+}
+
+// MarkRead marks everything the other user sent in a conversation as read by userID.
+func MarkRead(conversationID string, userID string) error {
+	_, err := database.DB.Exec(`UPDATE messages SET read_at=$1 WHERE conversation_id=$2 AND sender_id<>$3 AND read_at IS NULL`, time.Now().Format(time.RFC3339), conversationID, userID)
+
+	return err
+}
+
+func UnreadCount(userID string) (int, error) {
+	var count int
+	err := database.DB.QueryRow(`SELECT COUNT(1)
+								FROM messages
+									INNER JOIN conversations ON conversations.conversation_id=messages.conversation_id
+								WHERE (conversations.user_a=$1 OR conversations.user_b=$1) AND messages.sender_id<>$1 AND messages.read_at IS NULL`, userID).Scan(&count)
+
+	return count, err
+}
@@ -0,0 +1,123 @@
+package messages
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorant/database"
+	"gorant/database/dbtest"
+	"gorant/users"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		content string
+		ok      bool
+	}{
+		{"", false},
+		{"hi", true},
+		{strings.Repeat("ä", MaxLength), true},
+		{strings.Repeat("a", MaxLength+1), false},
+	}
+
+	for _, tt := range tests {
+		if got := Validate(tt.content); (got == "") != tt.ok {
+			t.Errorf("Validate of %d runes = %q", len([]rune(tt.content)), got)
+		}
+	}
+}
+
+func TestCanMessage(t *testing.T) {
+	dbtest.Open(t)
+	for _, u := range []string{"alice", "bob", "carol", "quiet"} {
+		dbtest.AddUser(t, u)
+	}
+	if _, err := database.DB.Exec("UPDATE users SET contact_me=0 WHERE user_id='quiet'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetRelation("bob", "alice", users.RelationBlock); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetRelation("carol", "bob", users.RelationMute); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sender, recipient string
+		allowed           bool
+	}{
+		{"alice", "carol", true},
+		{"carol", "bob", true}, // Muting doesn't stop messages, blocking does
+		{"alice", "bob", false},
+		{"bob", "alice", false},
+		{"alice", "quiet", false},
+		{"alice", "alice", false},
+	}
+
+	for _, tt := range tests {
+		err := CanMessage(tt.sender, tt.recipient)
+		if tt.allowed && err != nil {
+			t.Errorf("CanMessage(%s, %s) = %v, want allowed", tt.sender, tt.recipient, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrNotAllowed) {
+			t.Errorf("CanMessage(%s, %s) = %v, want ErrNotAllowed", tt.sender, tt.recipient, err)
+		}
+
+		// Send checks the same, and nothing is stored when it says no
+		if _, err := Send(tt.sender, tt.recipient, "hello"); !tt.allowed && !errors.Is(err, ErrNotAllowed) {
+			t.Errorf("Send(%s, %s) = %v, want ErrNotAllowed", tt.sender, tt.recipient, err)
+		}
+	}
+
+	var n int
+	if err := database.DB.Get(&n, "SELECT COUNT(1) FROM messages WHERE sender_id='alice' AND content='hello'"); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("alice has %d messages stored, want only the one to carol", n)
+	}
+}
+
+func TestSendRateLimit(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.AddUser(t, "alice")
+	dbtest.AddUser(t, "bob")
+	dbtest.AddUser(t, "carol")
+
+	// The limit is per sender, across conversations
+	for i := 0; i < perMinute; i++ {
+		to := "bob"
+		if i%2 == 1 {
+			to = "carol"
+		}
+		if _, err := Send("alice", to, "spam"); err != nil {
+			t.Fatalf("message %d: %v", i+1, err)
+		}
+	}
+	if _, err := Send("alice", "bob", "one too many"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("message %d in a minute = %v, want ErrRateLimited", perMinute+1, err)
+	}
+	if _, err := Send("bob", "alice", "still fine"); err != nil {
+		t.Errorf("bob is limited by alice's messages: %v", err)
+	}
+
+	// A minute later the per minute limit has passed, but not the hourly one
+	earlier := time.Now().Add(-2 * time.Minute).Format(time.RFC3339)
+	if _, err := database.DB.Exec("UPDATE messages SET created_at=$1 WHERE sender_id='alice'", earlier); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Send("alice", "bob", "calmer now"); err != nil {
+		t.Fatalf("Send after the minute passed: %v", err)
+	}
+
+	if _, err := database.DB.Exec(`INSERT INTO messages (conversation_id, sender_id, content, created_at)
+									SELECT conversation_id, 'alice', 'old spam', $1 FROM conversations, generate_series(1, $2)
+									WHERE user_a='alice' AND user_b='bob'`, earlier, perHour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Send("alice", "bob", "over the hour"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Send past %d in an hour = %v, want ErrRateLimited", perHour, err)
+	}
+}
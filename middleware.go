@@ -93,7 +93,7 @@ func ExcludeCompression(h http.Handler) http.Handler {
 	})
 }
 
-var cacheFiles = []string{"htmx-bundle.js", "InterVariable.woff2", "avatar-shiba.webp"}
+var cacheFiles = []string{"htmx-bundle.js", "InterVariable.woff2", "avatar-shiba.webp", "/uploads/", "/avatars/"}
 
 func contains(s string, a []string) bool {
 	for _, v := range a {
@@ -0,0 +1,142 @@
+package moods
+
+import (
+	"fmt"
+	"sync"
+
+	"gorant/database"
+)
+
+// Mood is one step of the scale posts are tagged with. Intensity orders the scale, negative moods are the
+// grumpy ones and the default mood sits at 0.
+type Mood struct {
+	Key       string `db:"mood_key"`
+	Label     string `db:"label"`
+	Intensity int    `db:"intensity"`
+	Color     string `db:"color"`
+	Icon      string `db:"icon"`
+	Default   bool   `db:"is_default"`
+}
+
+// The scale rarely changes, so it's read from the moods table once and kept here, lowest intensity first
+var (
+	mu     sync.RWMutex
+	scale  []Mood
+	loaded bool
+)
+
+func load() ([]Mood, error) {
+	var list []Mood
+	err := database.DB.Select(&list, "SELECT mood_key, label, intensity, color, icon, is_default FROM moods ORDER BY intensity")
+
+	return list, err
+}
+
+// Reload reads the scale from the database again, after the moods table changed.
+func Reload() error {
+	list, err := load()
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	scale, loaded = list, true
+	mu.Unlock()
+
+	return nil
+}
+
+// All returns the scale from the lowest intensity to the highest. If it can't be loaded the error is logged,
+// the result is empty and the next call tries again.
+func All() []Mood {
+	mu.RLock()
+	list, ok := scale, loaded
+	mu.RUnlock()
+	if ok {
+		return list
+	}
+
+	if err := Reload(); err != nil {
+		fmt.Println("Error loading moods: ", err)
+		return nil
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	return scale
+}
+
+// Keys returns the mood keys, in the order of All.
+func Keys() []string {
+	var keys []string
+	for _, m := range All() {
+		keys = append(keys, m.Key)
+	}
+
+	return keys
+}
+
+func Get(key string) (Mood, bool) {
+	for _, m := range All() {
+		if m.Key == key {
+			return m, true
+		}
+	}
+
+	return Mood{}, false
+}
+
+// Valid reports whether key is on the scale. Keys are matched exactly, "Angry" or "ang" aren't valid.
+func Valid(key string) bool {
+	_, ok := Get(key)
+	return ok
+}
+
+// Default returns the mood new posts get when none is picked: the one flagged is_default, or else the
+// middle of the scale.
+func Default() Mood {
+	list := All()
+	for _, m := range list {
+		if m.Default {
+			return m
+		}
+	}
+	if len(list) == 0 {
+		return Mood{}
+	}
+
+	return list[len(list)/2]
+}
+
+// Lookup returns the mood for key, falling back to Default for keys that aren't on the scale (anymore).
+func Lookup(key string) Mood {
+	if m, ok := Get(key); ok {
+		return m
+	}
+
+	return Default()
+}
+
+func Icon(key string) string {
+	return Lookup(key).Icon
+}
+
+// Nearest returns the mood whose intensity is closest to intensity, the lower one on a tie.
+func Nearest(intensity int) Mood {
+	var nearest Mood
+	for i, m := range All() {
+		if i == 0 || abs(m.Intensity-intensity) < abs(nearest.Intensity-intensity) {
+			nearest = m
+		}
+	}
+
+	return nearest
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,34 @@
+package moods
+
+import "testing"
+
+func TestValid(t *testing.T) {
+	mu.Lock()
+	scale, loaded = []Mood{{Key: "angry", Intensity: -3}, {Key: "neutral", Default: true}, {Key: "happy", Intensity: 1}}, true
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		scale, loaded = nil, false
+		mu.Unlock()
+	}()
+
+	for _, key := range []string{"angry", "neutral", "happy"} {
+		if !Valid(key) {
+			t.Errorf("Valid(%q) = false", key)
+		}
+	}
+
+	// Only whole keys, never prefixes or other spellings
+	for _, key := range []string{"", "a", "ang", "angr", "Angry", "angry ", "angryy", "neutral,happy"} {
+		if Valid(key) {
+			t.Errorf("Valid(%q) = true", key)
+		}
+	}
+
+	if d := Default(); d.Key != "neutral" {
+		t.Errorf("Default() = %q, want neutral", d.Key)
+	}
+	if m := Lookup("ang"); m.Key != "neutral" {
+		t.Errorf("Lookup(ang) = %q, want the default", m.Key)
+	}
+}
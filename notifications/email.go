@@ -0,0 +1,165 @@
+package notifications
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorant/database"
+	"gorant/mail"
+)
+
+// Digest frequencies, stored in users.digest
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+const digestLimit = 20
+
+// Job kinds for the queue, the handlers are registered in main
+const (
+	JobEmailNow    = "notifications.email_now"
+	JobSendDigests = "notifications.send_digests"
+)
+
+type EmailNowJob struct {
+	NotificationID string `json:"notification_id"`
+}
+
+type recipient struct {
+	UserID        string         `db:"user_id"`
+	Email         string         `db:"email"`
+	PreferredName string         `db:"preferred_name"`
+	Digest        string         `db:"digest"`
+	LastDigestAt  sql.NullString `db:"last_digest_at"`
+}
+
+// Only users who haven't ticked "only send me essential emails" (contact_me=0) get anything from here
+func getRecipient(userID string) (recipient, bool, error) {
+	var r recipient
+	err := database.DB.Get(&r, `SELECT user_id, email, preferred_name, digest, last_digest_at FROM users WHERE user_id=$1 AND contact_me=1`, userID)
+	if err == sql.ErrNoRows {
+		return r, false, nil
+	}
+
+	return r, err == nil, err
+}
+
+func getNotification(notificationID string) (Notification, error) {
+	var n Notification
+	err := database.DB.Get(&n, `SELECT notifications.notification_id, notifications.user_id, notifications.actor_id, users.preferred_name, notifications.type,
+									notifications.post_id, posts.post_title, notifications.comment_id::TEXT AS comment_id, notifications.count, notifications.created_at, notifications.read_at
+								FROM notifications
+									LEFT JOIN users ON users.user_id = notifications.actor_id
+									LEFT JOIN posts ON posts.post_id = notifications.post_id
+								WHERE notifications.notification_id=$1`, notificationID)
+
+	return n, err
+}
+
+func footer(userID string) string {
+	return "\n\n--\nYou're getting this because of your Grumplr email settings: " + mail.BaseURL + "/settings" +
+		"\nUnsubscribe from all of these emails: " + mail.UnsubscribeURL(userID) + "\n"
+}
+
+// EmailNow sends a single notification by email straight away, for types registered with EmailNow.
+// It runs from the job queue, so a notification that was deleted before its turn came up is skipped rather than retried.
+func EmailNow(notificationID string) error {
+	n, err := getNotification(notificationID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	r, ok, err := getRecipient(n.UserID)
+	if err != nil || !ok {
+		return err
+	}
+
+	return mail.Send(mail.Message{
+		To:      r.Email,
+		Subject: n.Message(),
+		Text:    n.Message() + "\n\n" + mail.BaseURL + n.Link() + footer(r.UserID),
+		Headers: mail.UnsubscribeHeaders(r.UserID),
+	})
+}
+
+// SendDueDigests emails every user whose daily or weekly digest is due a summary of their unread notifications
+// since the last one. Users with nothing new are skipped but still marked as done, so the next digest covers
+// the right period.
+func SendDueDigests() error {
+	now := time.Now()
+
+	var due []recipient
+	err := database.DB.Select(&due, `SELECT user_id, email, preferred_name, digest, last_digest_at FROM users
+									WHERE contact_me=1 AND digest IN ($1, $2)
+										AND COALESCE(last_digest_at::TIMESTAMPTZ, 'epoch') <= CASE digest WHEN $1 THEN $3::TIMESTAMPTZ ELSE $4::TIMESTAMPTZ END`,
+		DigestDaily, DigestWeekly, now.Add(-24*time.Hour).Format(time.RFC3339), now.Add(-7*24*time.Hour).Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	for _, r := range due {
+		if err := sendDigest(r, now); err != nil {
+			fmt.Println("Error sending digest: ", err)
+		}
+	}
+
+	return nil
+}
+
+func sendDigest(r recipient, now time.Time) error {
+	since := r.LastDigestAt.String
+	if !r.LastDigestAt.Valid {
+		if r.Digest == DigestDaily {
+			since = now.Add(-24 * time.Hour).Format(time.RFC3339)
+		} else {
+			since = now.Add(-7 * 24 * time.Hour).Format(time.RFC3339)
+		}
+	}
+
+	var list []Notification
+	err := database.DB.Select(&list, `SELECT notifications.notification_id, notifications.user_id, notifications.actor_id, users.preferred_name, notifications.type,
+										notifications.post_id, posts.post_title, notifications.comment_id::TEXT AS comment_id, notifications.count, notifications.created_at, notifications.read_at
+									FROM notifications
+										LEFT JOIN users ON users.user_id = notifications.actor_id
+										LEFT JOIN posts ON posts.post_id = notifications.post_id
+									WHERE notifications.user_id=$1 AND notifications.read_at IS NULL AND posts.deleted_at IS NULL
+										AND notifications.created_at::TIMESTAMPTZ > $2::TIMESTAMPTZ
+									ORDER BY notifications.notification_id DESC`, r.UserID, since)
+	if err != nil {
+		return err
+	}
+
+	if len(list) > 0 {
+		var b strings.Builder
+		fmt.Fprintf(&b, "Hi %s, here's what happened on Grumplr since your last digest:\n\n", r.PreferredName)
+		for i, n := range list {
+			if i == digestLimit {
+				fmt.Fprintf(&b, "...and %d more.\n", len(list)-digestLimit)
+				break
+			}
+			fmt.Fprintf(&b, "- %s\n  %s%s\n", n.Message(), mail.BaseURL, n.Link())
+		}
+		fmt.Fprintf(&b, "\nSee all your notifications: %s/notifications", mail.BaseURL)
+		b.WriteString(footer(r.UserID))
+
+		err := mail.Send(mail.Message{
+			To:      r.Email,
+			Subject: fmt.Sprintf("Your Grumplr %s digest: %d new", r.Digest, len(list)),
+			Text:    b.String(),
+			Headers: mail.UnsubscribeHeaders(r.UserID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = database.DB.Exec(`UPDATE users SET last_digest_at=$1 WHERE user_id=$2`, now.Format(time.RFC3339), r.UserID)
+	return err
+}
@@ -0,0 +1,168 @@
+package notifications
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"gorant/database"
+	"gorant/database/dbtest"
+	"gorant/mail"
+)
+
+func useMemorySender(t *testing.T) *mail.MemorySender {
+	s := &mail.MemorySender{}
+	mail.Default = s
+	mail.Secret = []byte("test secret")
+	t.Cleanup(func() {
+		mail.Default = nil
+		mail.Secret = nil
+	})
+
+	return s
+}
+
+func notify(t *testing.T, userID string, actorID string, typ string, postID string) {
+	t.Helper()
+
+	n := Notification{
+		UserID:  userID,
+		ActorID: sql.NullString{String: actorID, Valid: true},
+		Type:    typ,
+		PostID:  sql.NullString{String: postID, Valid: true},
+	}
+	if err := Notify(n); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplyEmail(t *testing.T) {
+	dbtest.Open(t)
+	sender := useMemorySender(t)
+	dbtest.AddUser(t, "author")
+	dbtest.AddUser(t, "replier")
+	dbtest.AddPost(t, "rant", "author")
+
+	notify(t, "author", "replier", TypeReply, "rant")
+
+	// Notify only queues the email, run the job the way a worker would
+	var payload []byte
+	if err := database.DB.QueryRow("SELECT payload FROM jobs WHERE kind=$1", JobEmailNow).Scan(&payload); err != nil {
+		t.Fatalf("no email job queued for a reply: %v", err)
+	}
+	var job EmailNowJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		t.Fatal(err)
+	}
+	if err := EmailNow(job.NotificationID); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := sender.Sent()
+	if len(sent) != 1 || sent[0].To != "author@example.com" || sent[0].Subject != `replier commented on "rant"` {
+		t.Fatalf("sent %+v, want the reply notification to author@example.com", sent)
+	}
+	if !strings.Contains(sent[0].Text, mail.BaseURL+"/posts/rant") || sent[0].Headers["List-Unsubscribe"] == "" {
+		t.Errorf("reply email has no link or unsubscribe header: %+v", sent[0])
+	}
+
+	// Users who only want essential emails get none
+	if _, err := database.DB.Exec("UPDATE users SET contact_me=0 WHERE user_id='author'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := EmailNow(job.NotificationID); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sender.Sent()); n != 1 {
+		t.Errorf("sent %d emails, want no more after opting out", n)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	dbtest.Open(t)
+	sender := useMemorySender(t)
+	for _, u := range []string{"reader", "alice", "bob", "carol", "dave"} {
+		dbtest.AddUser(t, u)
+	}
+	dbtest.AddPost(t, "included", "reader")
+	dbtest.AddPost(t, "read", "reader")
+	dbtest.AddPost(t, "trashed", "reader")
+	dbtest.AddPost(t, "older", "reader")
+
+	lastDigest := time.Now().Add(-25 * time.Hour)
+	if _, err := database.DB.Exec("UPDATE users SET digest=$1, last_digest_at=$2 WHERE user_id='reader'", DigestDaily, lastDigest.Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+
+	notify(t, "reader", "alice", TypeUpvote, "included")
+	notify(t, "reader", "bob", TypeUpvote, "read")
+	notify(t, "reader", "carol", TypeUpvote, "trashed")
+	notify(t, "reader", "dave", TypeUpvote, "older")
+
+	for _, q := range []string{
+		"UPDATE notifications SET read_at=created_at WHERE post_id='read'",
+		"UPDATE posts SET deleted_at=created_at WHERE post_id='trashed'",
+	} {
+		if _, err := database.DB.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := database.DB.Exec("UPDATE notifications SET created_at=$1 WHERE post_id='older'", lastDigest.Add(-time.Hour).Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SendDueDigests(); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := sender.Sent()
+	if len(sent) != 1 || sent[0].To != "reader@example.com" {
+		t.Fatalf("sent %+v, want one digest to reader@example.com", sent)
+	}
+	if !strings.Contains(sent[0].Subject, "1 new") || !strings.Contains(sent[0].Text, `alice upvoted your comment on "included"`) {
+		t.Errorf("digest doesn't have the unread notification:\n%s\n%s", sent[0].Subject, sent[0].Text)
+	}
+	for _, skipped := range []string{"bob", "carol", "dave"} {
+		if strings.Contains(sent[0].Text, skipped) {
+			t.Errorf("digest has %s's notification:\n%s", skipped, sent[0].Text)
+		}
+	}
+
+	// Not due again until tomorrow
+	if err := SendDueDigests(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sender.Sent()); n != 1 {
+		t.Errorf("sent %d emails, want the digest only once a day", n)
+	}
+}
+
+func TestAnonymousIsNeverEmailed(t *testing.T) {
+	dbtest.Open(t)
+	sender := useMemorySender(t)
+	dbtest.AddUser(t, "replier")
+	dbtest.AddPost(t, "anonymous-rant", "anonymous@rantkit.com")
+
+	// Reset seeds the anonymous user, whose digest is due straight away
+	notify(t, "anonymous@rantkit.com", "replier", TypeReply, "anonymous-rant")
+
+	var payload []byte
+	if err := database.DB.QueryRow("SELECT payload FROM jobs WHERE kind=$1", JobEmailNow).Scan(&payload); err == nil {
+		var job EmailNowJob
+		if err := json.Unmarshal(payload, &job); err != nil {
+			t.Fatal(err)
+		}
+		if err := EmailNow(job.NotificationID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SendDueDigests(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := sender.Sent(); len(sent) != 0 {
+		t.Errorf("sent %+v to the anonymous user", sent)
+	}
+}
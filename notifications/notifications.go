@@ -0,0 +1,133 @@
+package notifications
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gorant/database"
+	"gorant/jobs"
+)
+
+type Notification struct {
+	NotificationID string         `db:"notification_id"`
+	UserID         string         `db:"user_id"` // Recipient
+	ActorID        sql.NullString `db:"actor_id"`
+	ActorName      sql.NullString `db:"preferred_name"`
+	Type           string         `db:"type"`
+	PostID         sql.NullString `db:"post_id"`
+	PostTitle      sql.NullString `db:"post_title"`
+	CommentID      sql.NullString `db:"comment_id"`
+	Count          int            `db:"count"` // How many events a batched notification stands for, 1 otherwise
+	CreatedAt      string         `db:"created_at"`
+	ReadAt         sql.NullString `db:"read_at"`
+}
+
+func (n Notification) Unread() bool {
+	return !n.ReadAt.Valid
+}
+
+// Notify stores a notification for n.UserID. Nobody is notified about their own actions, and an identical
+// notification that's still unread isn't stored twice, so toggling a reaction on and off doesn't pile them up.
+// Types registered with Batch are folded into the unread one for the same post instead, see batch.
+func Notify(n Notification) error {
+	if n.UserID == "" || (n.ActorID.Valid && n.ActorID.String == n.UserID) {
+		return nil
+	}
+
+	t, ok := types[n.Type]
+	if !ok {
+		return fmt.Errorf("error: unregistered notification type %q", n.Type)
+	}
+
+	if t.Batch {
+		if ok, err := batch(n); ok || err != nil {
+			return err
+		}
+	}
+
+	var id string
+	err := database.DB.QueryRow(`INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id, created_at)
+								SELECT $1, $2, $3, $4, $5::INT, $6
+								WHERE NOT EXISTS (
+									SELECT 1 FROM notifications
+									WHERE user_id=$1 AND actor_id IS NOT DISTINCT FROM $2 AND type=$3 AND post_id IS NOT DISTINCT FROM $4
+										AND comment_id IS NOT DISTINCT FROM $5::INT AND read_at IS NULL
+								)
+								RETURNING notification_id`, n.UserID, n.ActorID, n.Type, n.PostID, n.CommentID, time.Now().Format(time.RFC3339)).Scan(&id)
+	if err == sql.ErrNoRows {
+		// Duplicate of an unread one
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if t.EmailNow {
+		// Kept off the request path, SMTP can take a while. The queue also retries if the server is down.
+		return jobs.Enqueue(JobEmailNow, EmailNowJob{NotificationID: id})
+	}
+
+	return nil
+}
+
+// batch bumps the count of the user's unread notification of the same type for the same post, and reports
+// whether there was one. It keeps the first event's actor and comment, so the link goes to the oldest unread one.
+func batch(n Notification) (bool, error) {
+	res, err := database.DB.Exec(`UPDATE notifications SET count=count+1, created_at=$1
+								WHERE notification_id=(
+									SELECT notification_id FROM notifications
+									WHERE user_id=$2 AND type=$3 AND post_id IS NOT DISTINCT FROM $4 AND read_at IS NULL
+									ORDER BY notification_id DESC
+									LIMIT 1
+								)`, time.Now().Format(time.RFC3339), n.UserID, n.Type, n.PostID)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := res.RowsAffected()
+	return count > 0, err
+}
+
+func List(userID string, limit int) ([]Notification, error) {
+	var list []Notification
+
+	err := database.DB.Select(&list, `SELECT notifications.notification_id, notifications.user_id, notifications.actor_id, users.preferred_name, notifications.type,
+										notifications.post_id, posts.post_title, notifications.comment_id::TEXT AS comment_id, notifications.count, notifications.created_at, notifications.read_at
+									FROM notifications
+										LEFT JOIN users ON users.user_id = notifications.actor_id
+										LEFT JOIN posts ON posts.post_id = notifications.post_id
+									WHERE notifications.user_id=$1 AND posts.deleted_at IS NULL
+									ORDER BY notifications.notification_id DESC
+									LIMIT $2`, userID, limit)
+
+	return list, err
+}
+
+// UnreadCount counts what List would show unread, notifications about trashed posts are left out the same way.
+func UnreadCount(userID string) (int, error) {
+	var count int
+	err := database.DB.QueryRow(`SELECT COUNT(1)
+								FROM notifications
+									LEFT JOIN posts ON posts.post_id = notifications.post_id
+								WHERE notifications.user_id=$1 AND notifications.read_at IS NULL AND posts.deleted_at IS NULL`, userID).Scan(&count)
+
+	return count, err
+}
+
+// MarkRead marks one notification as read and returns it, so the caller can send the user on to its Link.
+func MarkRead(notificationID string, userID string) (Notification, error) {
+	var n Notification
+
+	err := database.DB.QueryRow(`UPDATE notifications SET read_at=COALESCE(read_at, $1)
+								WHERE notification_id=$2 AND user_id=$3
+								RETURNING notification_id, user_id, type, post_id, comment_id::TEXT, created_at, read_at`, time.Now().Format(time.RFC3339), notificationID, userID).Scan(&n.NotificationID, &n.UserID, &n.Type, &n.PostID, &n.CommentID, &n.CreatedAt, &n.ReadAt)
+
+	return n, err
+}
+
+func MarkAllRead(userID string) error {
+	_, err := database.DB.Exec(`UPDATE notifications SET read_at=$1 WHERE user_id=$2 AND read_at IS NULL`, time.Now().Format(time.RFC3339), userID)
+
+	return err
+}
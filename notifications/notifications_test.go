@@ -0,0 +1,89 @@
+package notifications
+
+import (
+	"database/sql"
+	"testing"
+
+	"gorant/database"
+	"gorant/database/dbtest"
+)
+
+func TestNotifyDedupes(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.AddUser(t, "owner")
+	dbtest.AddUser(t, "fan")
+	dbtest.AddPost(t, "rant", "owner")
+
+	// Liking, unliking and liking again leaves one unread notification
+	notify(t, "owner", "fan", TypeLike, "rant")
+	notify(t, "owner", "fan", TypeLike, "rant")
+	// Nobody is notified about their own actions
+	notify(t, "owner", "owner", TypeLike, "rant")
+
+	list, err := List("owner", 10)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("List = %v, %v, want one notification", list, err)
+	}
+
+	// Once it's read, the same event is new again
+	if _, err := MarkRead(list[0].NotificationID, "owner"); err != nil {
+		t.Fatal(err)
+	}
+	notify(t, "owner", "fan", TypeLike, "rant")
+	if count, err := UnreadCount("owner"); err != nil || count != 1 {
+		t.Errorf("UnreadCount after a repeat of a read notification = %d, %v, want 1", count, err)
+	}
+
+	if err := Notify(Notification{UserID: "owner", Type: "unregistered"}); err == nil {
+		t.Error("Notify of an unregistered type succeeded")
+	}
+}
+
+func TestNotifyBatches(t *testing.T) {
+	dbtest.Open(t)
+	for _, u := range []string{"owner", "fan", "alice", "bob"} {
+		dbtest.AddUser(t, u)
+	}
+	dbtest.AddPost(t, "rant", "owner")
+
+	notify(t, "fan", "alice", TypeThread, "rant")
+	notify(t, "fan", "bob", TypeThread, "rant")
+
+	list, err := List("fan", 10)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("List = %v, %v, want one batched notification", list, err)
+	}
+	if list[0].Count != 2 || list[0].ActorID.String != "alice" {
+		t.Errorf("batched notification = %+v, want alice's with a count of 2", list[0])
+	}
+}
+
+func TestUnreadCount(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.AddUser(t, "owner")
+	dbtest.AddUser(t, "fan")
+	dbtest.AddPost(t, "rant", "owner")
+	dbtest.AddPost(t, "trashed", "owner")
+
+	notify(t, "owner", "fan", TypeLike, "rant")
+	notify(t, "owner", "fan", TypeLike, "trashed")
+	if err := Notify(Notification{UserID: "owner", ActorID: sql.NullString{String: "fan", Valid: true}, Type: TypeLike}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.DB.Exec("UPDATE posts SET deleted_at=created_at WHERE post_id='trashed'"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A notification without a post still counts, one about a trashed post doesn't
+	if count, err := UnreadCount("owner"); err != nil || count != 2 {
+		t.Errorf("UnreadCount = %d, %v, want 2", count, err)
+	}
+
+	if err := MarkAllRead("owner"); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := UnreadCount("owner"); err != nil || count != 0 {
+		t.Errorf("UnreadCount after MarkAllRead = %d, %v, want 0", count, err)
+	}
+}
@@ -0,0 +1,118 @@
+package notifications
+
+import "strconv"
+
+// Type describes how one kind of notification is shown. New kinds only need a Register call,
+// nothing in the table or the templates is specific to a type.
+type Type struct {
+	Name string
+	// Message is the text shown in the inbox, e.g. "Alice replied to your rant"
+	Message func(n Notification) string
+	// Link is where clicking the notification goes
+	Link func(n Notification) string
+	// EmailNow sends an email as soon as the notification is stored, instead of leaving it for the digest
+	EmailNow bool
+	// Batch folds repeats for the same post into one unread notification with a count, for busy threads
+	Batch bool
+}
+
+const (
+	TypeReply    = "reply"
+	TypeUpvote   = "upvote"
+	TypeLike     = "like" // Before reactions, kept for the notifications that are still around
+	TypeMention  = "mention"
+	TypeThread   = "thread"
+	TypeReaction = "reaction"
+)
+
+var types = make(map[string]Type)
+
+func Register(t Type) {
+	types[t.Name] = t
+}
+
+func init() {
+	Register(Type{
+		Name:     TypeReply,
+		Message:  func(n Notification) string { return n.actor() + " commented on " + n.post() },
+		Link:     commentLink,
+		EmailNow: true,
+	})
+	Register(Type{
+		Name:    TypeUpvote,
+		Message: func(n Notification) string { return n.actor() + " upvoted your comment on " + n.post() },
+		Link:    commentLink,
+	})
+	Register(Type{
+		Name:    TypeLike,
+		Message: func(n Notification) string { return n.actor() + " liked " + n.post() },
+		Link:    postLink,
+	})
+	Register(Type{
+		Name:    TypeReaction,
+		Message: func(n Notification) string { return n.actor() + " reacted to " + n.post() },
+		Link:    postLink,
+	})
+	Register(Type{
+		Name:     TypeMention,
+		Message:  func(n Notification) string { return n.actor() + " mentioned you on " + n.post() },
+		Link:     commentLink,
+		EmailNow: true,
+	})
+	Register(Type{
+		Name: TypeThread,
+		Message: func(n Notification) string {
+			if n.Count > 1 {
+				return strconv.Itoa(n.Count) + " new comments on " + n.post()
+			}
+			return n.actor() + " commented on " + n.post()
+		},
+		Link:  commentLink,
+		Batch: true,
+	})
+}
+
+func (n Notification) Message() string {
+	if t, ok := types[n.Type]; ok && t.Message != nil {
+		return t.Message(n)
+	}
+
+	return "You have a new notification"
+}
+
+func (n Notification) Link() string {
+	if t, ok := types[n.Type]; ok && t.Link != nil {
+		return t.Link(n)
+	}
+
+	return "/notifications"
+}
+
+func (n Notification) actor() string {
+	if n.ActorName.Valid && n.ActorName.String != "" {
+		return n.ActorName.String
+	}
+
+	return "Someone"
+}
+
+func (n Notification) post() string {
+	if n.PostTitle.Valid {
+		return `"` + n.PostTitle.String + `"`
+	}
+
+	return "your rant"
+}
+
+func postLink(n Notification) string {
+	return "/posts/" + n.PostID.String
+}
+
+// Comments are anchored as #post-<commentID> on the post page
+func commentLink(n Notification) string {
+	if !n.CommentID.Valid {
+		return postLink(n)
+	}
+
+	return "/posts/" + n.PostID.String + "#post-" + n.CommentID.String
+}
@@ -0,0 +1,185 @@
+package posts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorant/database"
+)
+
+const SavedPageSize = 20
+
+type Bookmark struct {
+	BookmarkID   string        `db:"bookmark_id"`
+	PostID       string        `db:"post_id"`
+	CommentID    sql.NullInt64 `db:"comment_id"`
+	CollectionID sql.NullInt64 `db:"collection_id"`
+	Title        string        `db:"title"`   // The post's title, as it was when saved if the post is gone
+	Excerpt      string        `db:"excerpt"` // Start of the comment, for comment bookmarks
+	CreatedAt    string        `db:"created_at"`
+	Gone         bool          // The post or comment was deleted since, the bookmark is shown greyed out
+
+	CreatedAtProcessed string
+}
+
+type Collection struct {
+	CollectionID string `db:"collection_id"`
+	Name         string `db:"name"`
+	Count        int    `db:"cnt"`
+}
+
+// ToggleBookmark saves or unsaves a post, or one of its comments when commentID isn't empty, and returns whether it's now saved.
+func ToggleBookmark(userID string, postID string, commentID string) (bool, error) {
+	var q string
+	var args []any
+	if commentID == "" {
+		q = "DELETE FROM bookmarks WHERE user_id=$1 AND post_id=$2 AND comment_id IS NULL"
+		args = []any{userID, postID}
+	} else {
+		q = "DELETE FROM bookmarks WHERE user_id=$1 AND comment_id=$2"
+		args = []any{userID, commentID}
+	}
+
+	res, err := database.DB.Exec(q, args...)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return false, nil
+	}
+
+	// Title and excerpt are copied over, so there's still something to show if the post is purged later
+	t := time.Now().Format(time.RFC3339)
+	if commentID == "" {
+		res, err = database.DB.Exec(`INSERT INTO bookmarks (user_id, post_id, title, excerpt, created_at)
+									SELECT $1, post_id, post_title, '', $3 FROM posts WHERE post_id=$2 AND deleted_at IS NULL`, userID, postID, t)
+	} else {
+		res, err = database.DB.Exec(`INSERT INTO bookmarks (user_id, post_id, comment_id, title, excerpt, created_at)
+									SELECT $1, posts.post_id, comments.comment_id, posts.post_title, LEFT(comments.content, 200), $4
+									FROM comments
+										INNER JOIN posts ON posts.post_id=comments.post_id
+									WHERE comments.comment_id=$3 AND posts.post_id=$2 AND comments.deleted_at IS NULL AND posts.deleted_at IS NULL`, userID, postID, commentID, t)
+	}
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, errors.New("error: nothing to bookmark")
+	}
+
+	return true, nil
+}
+
+// ListBookmarks returns one page (from 1) of a user's bookmarks, newest first, and whether there's another page after it.
+// An empty collectionID lists every bookmark.
+func ListBookmarks(userID string, collectionID string, page int) ([]Bookmark, bool, error) {
+	var bookmarks []Bookmark
+
+	// Bookmarks outlive what they point to: trashed and purged posts and comments show up as gone, and come back
+	// if they're restored from the trash
+	rows, err := database.DB.Query(`SELECT bookmarks.bookmark_id, bookmarks.post_id, bookmarks.comment_id, bookmarks.collection_id,
+										COALESCE(posts.post_title, bookmarks.title, ''),
+										COALESCE(CASE WHEN comments.deleted_at IS NULL THEN comments.content END, bookmarks.excerpt, ''), bookmarks.created_at,
+										posts.post_id IS NULL OR posts.deleted_at IS NOT NULL
+											OR (bookmarks.comment_id IS NOT NULL AND (comments.comment_id IS NULL OR comments.deleted_at IS NOT NULL)) AS gone
+									FROM bookmarks
+										LEFT JOIN posts ON posts.post_id=bookmarks.post_id
+										LEFT JOIN comments ON comments.comment_id=bookmarks.comment_id
+									WHERE bookmarks.user_id=$1 AND ($2='' OR bookmarks.collection_id::TEXT=$2)
+									ORDER BY bookmarks.created_at::TIMESTAMPTZ DESC, bookmarks.bookmark_id DESC
+									LIMIT $3 OFFSET $4`, userID, collectionID, SavedPageSize+1, offset(page, SavedPageSize))
+	if err != nil {
+		return bookmarks, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b Bookmark
+		if err := rows.Scan(&b.BookmarkID, &b.PostID, &b.CommentID, &b.CollectionID, &b.Title, &b.Excerpt, &b.CreatedAt, &b.Gone); err != nil {
+			return bookmarks, false, err
+		}
+
+		if excerpt := []rune(b.Excerpt); b.CommentID.Valid && len(excerpt) > 200 {
+			b.Excerpt = strings.TrimSpace(string(excerpt[:200])) + "…"
+		}
+
+		b.CreatedAtProcessed, err = ConvertDate(b.CreatedAt)
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		bookmarks = append(bookmarks, b)
+	}
+
+	if len(bookmarks) > SavedPageSize {
+		return bookmarks[:SavedPageSize], true, rows.Err()
+	}
+
+	return bookmarks, false, rows.Err()
+}
+
+func RemoveBookmark(userID string, bookmarkID string) error {
+	_, err := database.DB.Exec("DELETE FROM bookmarks WHERE bookmark_id=$1 AND user_id=$2", bookmarkID, userID)
+	return err
+}
+
+// MoveBookmark puts a bookmark into one of the user's collections, or takes it out of any when collectionID is empty.
+func MoveBookmark(userID string, bookmarkID string, collectionID string) error {
+	var res sql.Result
+	var err error
+	if collectionID == "" {
+		res, err = database.DB.Exec("UPDATE bookmarks SET collection_id=NULL WHERE bookmark_id=$1 AND user_id=$2", bookmarkID, userID)
+	} else {
+		res, err = database.DB.Exec(`UPDATE bookmarks SET collection_id=bookmark_collections.collection_id
+									FROM bookmark_collections
+									WHERE bookmarks.bookmark_id=$1 AND bookmarks.user_id=$2 AND bookmark_collections.collection_id=$3 AND bookmark_collections.user_id=$2`, bookmarkID, userID, collectionID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("error: bookmark or collection not found")
+	}
+
+	return nil
+}
+
+func ListCollections(userID string) ([]Collection, error) {
+	var collections []Collection
+
+	err := database.DB.Select(&collections, `SELECT bookmark_collections.collection_id, bookmark_collections.name, COUNT(bookmarks.bookmark_id) AS cnt
+											FROM bookmark_collections
+												LEFT JOIN bookmarks ON bookmarks.collection_id=bookmark_collections.collection_id
+											WHERE bookmark_collections.user_id=$1
+											GROUP BY bookmark_collections.collection_id, bookmark_collections.name
+											ORDER BY LOWER(bookmark_collections.name)`, userID)
+	return collections, err
+}
+
+// ValidateCollection checks a new collection name, returning a message for the form when it's not usable.
+func ValidateCollection(name string) string {
+	switch {
+	case name == "":
+		return "Please enter a name."
+	case len([]rune(name)) > 50:
+		return "Collection names are limited to 50 characters."
+	}
+
+	return ""
+}
+
+func NewCollection(userID string, name string) error {
+	_, err := database.DB.Exec(`INSERT INTO bookmark_collections (user_id, name, created_at) VALUES ($1, $2, $3)
+								ON CONFLICT (user_id, name) DO NOTHING`, userID, name, time.Now().Format(time.RFC3339))
+	return err
+}
+
+// DeleteCollection removes a collection, the bookmarks in it are kept and go back to "All".
+func DeleteCollection(userID string, collectionID string) error {
+	_, err := database.DB.Exec("DELETE FROM bookmark_collections WHERE collection_id=$1 AND user_id=$2", collectionID, userID)
+	return err
+}
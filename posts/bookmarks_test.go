@@ -0,0 +1,65 @@
+package posts
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"gorant/database"
+	"gorant/database/dbtest"
+)
+
+func TestBookmarksOfTrashedPosts(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.AddUser(t, "owner")
+	dbtest.AddUser(t, "reader")
+	dbtest.AddPost(t, "rant", "owner")
+
+	var commentID string
+	err := database.DB.QueryRow(`INSERT INTO comments (user_id, content, created_at, post_id) VALUES ('owner', $1, '2024-01-01T00:00:00Z', 'rant')
+								RETURNING comment_id`, strings.Repeat("ä", 250)).Scan(&commentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []string{"", commentID} {
+		if saved, err := ToggleBookmark("reader", "rant", c); err != nil || !saved {
+			t.Fatalf("ToggleBookmark(%q) = %v, %v", c, saved, err)
+		}
+	}
+
+	gone := func() []bool {
+		t.Helper()
+
+		list, _, err := ListBookmarks("reader", "", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var g []bool
+		for _, b := range list {
+			g = append(g, b.Gone)
+			if b.CommentID.Valid && (!utf8.ValidString(b.Excerpt) || utf8.RuneCountInString(b.Excerpt) > 201) {
+				t.Errorf("comment excerpt is %d runes, valid UTF-8 %v", utf8.RuneCountInString(b.Excerpt), utf8.ValidString(b.Excerpt))
+			}
+		}
+		return g
+	}
+
+	if g := gone(); len(g) != 2 || g[0] || g[1] {
+		t.Fatalf("bookmarks gone = %v, want two live ones", g)
+	}
+
+	if err := DeletePost("rant", "owner"); err != nil {
+		t.Fatal(err)
+	}
+	if g := gone(); len(g) != 2 || !g[0] || !g[1] {
+		t.Errorf("bookmarks gone = %v after trashing the post, want both kept and gone", g)
+	}
+
+	if err := RestorePost("rant", "owner"); err != nil {
+		t.Fatal(err)
+	}
+	if g := gone(); len(g) != 2 || g[0] || g[1] {
+		t.Errorf("bookmarks gone = %v after restoring the post, want them back", g)
+	}
+}
@@ -2,23 +2,28 @@ package posts
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
 	"gorant/database"
+	"gorant/notifications"
+	"gorant/uploads"
 	"gorant/users"
 
 	"github.com/rezakhademix/govalidator/v2"
 )
 
 type Comment struct {
-	CommentID string `db:"comment_id"`
-	UserID    string `db:"user_id"`
-	Content   string `db:"content"`
-	CreatedAt string `db:"created_at"`
-	PostID    string `db:"post_id"`
+	CommentID string         `db:"comment_id"`
+	UserID    string         `db:"user_id"`
+	Content   string         `db:"content"`
+	CreatedAt string         `db:"created_at"`
+	PostID    string         `db:"post_id"`
+	EditedAt  sql.NullString `db:"edited_at"`
+	DeletedAt sql.NullString `db:"deleted_at"`
 }
 
 type CommentVote struct {
@@ -29,15 +34,21 @@ type CommentVote struct {
 }
 
 type JoinComment struct {
-	CommentID       string `db:"comment_id"`
-	UserID          string `db:"user_id"`
-	Content         string `db:"content"`
-	CreatedAt       string `db:"created_at"`
-	PostID          string `db:"post_id"`
-	PostDescription string `db:"description"`
+	CommentID       string         `db:"comment_id"`
+	UserID          string         `db:"user_id"`
+	Content         string         `db:"content"`
+	CreatedAt       string         `db:"created_at"`
+	PostID          string         `db:"post_id"`
+	EditedAt        sql.NullString `db:"edited_at"`
+	DeletedAt       sql.NullString `db:"deleted_at"`
+	PostDescription string         `db:"description"`
+	PostTitle       string         `db:"post_title"`
 	Initials        string
 	PreferredName   string `db:"preferred_name"`
 	Avatar          string `db:"avatar"`
+	Handle          string `db:"handle"` // Empty for the anonymous user, whose name isn't linked
+	Muted           bool   `db:"muted"`  // The author is muted or blocked by the viewer, the comment is shown collapsed
+	Bookmarked      bool   `db:"bookmarked"`
 
 	// Processed
 	CreatedAtProcessed string
@@ -51,13 +62,29 @@ type JoinComment struct {
 	IDsVoted         sql.NullString `db:"cnt"`
 	IDsVotedString   string         // String separated by "," with the user_ids grouped
 	CurrentUserVoted string         // Returns a true or false for use in Templ template
+
+	Attachments []uploads.Attachment
 }
 
+// ErrBlocked is returned when someone tries to reply to the post of a user who has blocked them.
+var ErrBlocked = errors.New("error: blocked by the post's author")
+
 func Insert(c Comment) (string, error) {
 	var insertedID string
 
+	// Nothing is inserted if the post's author has blocked the commenter
 	var lastInsertID int
-	err := database.DB.QueryRow(`INSERT INTO comments (user_id, content, created_at, post_id) VALUES ($1, $2, $3, $4) RETURNING comment_id`, c.UserID, c.Content, c.CreatedAt, c.PostID).Scan(&lastInsertID)
+	err := database.DB.QueryRow(`INSERT INTO comments (user_id, content, created_at, post_id)
+								SELECT $1, $2, $3, $4
+								WHERE NOT EXISTS (
+									SELECT 1 FROM user_relations
+										INNER JOIN posts ON posts.user_id=user_relations.user_id
+									WHERE posts.post_id=$4 AND user_relations.target_id=$1 AND user_relations.kind='block'
+								)
+								RETURNING comment_id`, c.UserID, c.Content, c.CreatedAt, c.PostID).Scan(&lastInsertID)
+	if err == sql.ErrNoRows {
+		return insertedID, ErrBlocked
+	}
 	if err != nil {
 		return insertedID, err
 	}
@@ -73,6 +100,12 @@ func Insert(c Comment) (string, error) {
 	// }
 	insertedID = strconv.Itoa(lastInsertID)
 	fmt.Println("Successfully inserted!")
+
+	notify(notifications.TypeReply, c.UserID, c.PostID, insertedID)
+	saveMentions(c.PostID, insertedID, c.UserID, c.Content)
+	subscribeCommenter(c.UserID, c.PostID)
+	queueSubscribers(c.PostID, insertedID, c.UserID)
+
 	return insertedID, nil
 }
 
@@ -82,17 +115,19 @@ func ListComments(postID string, currentUser string) ([]JoinComment, error) {
 	// Useful resource for the join - https://stackoverflow.com/questions/2215754/sql-left-join-count
 	// I considered left join for post description, but it was stupid to append description to every comment.
 	// Decided to just do a separate query for that instead.
-	rows, err := database.DB.Query(`SELECT comments.comment_id, comments.user_id, comments.content, comments.created_at, comments.post_id, cnt, ids_voted, users.preferred_name, users.avatar FROM comments 
+	rows, err := database.DB.Query(`SELECT comments.comment_id, comments.user_id, comments.content, comments.created_at, comments.post_id, comments.edited_at, comments.deleted_at, cnt, ids_voted, users.preferred_name, users.avatar, COALESCE(users.handle, ''),
+							EXISTS (SELECT 1 FROM user_relations WHERE user_relations.user_id=$2 AND user_relations.target_id=comments.user_id) AS muted,
+							EXISTS (SELECT 1 FROM bookmarks WHERE bookmarks.user_id=$2 AND bookmarks.comment_id=comments.comment_id) AS bookmarked FROM comments 
 
 							LEFT JOIN (SELECT comments_votes.comment_id, COUNT(1) AS cnt, string_agg(DISTINCT comments_votes.user_id, ',') AS ids_voted 
 							FROM comments_votes 
 							GROUP BY comments_votes.comment_id) AS comments_votes 
 							ON comments.comment_id = comments_votes.comment_id 
 							
-							LEFT JOIN (SELECT users.user_id, users.preferred_name, users.avatar FROM users) as users
+							LEFT JOIN (SELECT users.user_id, users.preferred_name, users.avatar, users.handle FROM users) as users
 							ON comments.user_id = users.user_id
 							WHERE comments.post_id=$1
-							ORDER BY cnt DESC NULLS LAST;`, postID)
+							ORDER BY cnt DESC NULLS LAST;`, postID, currentUser)
 	if err != nil {
 		return comments, err
 	}
@@ -101,7 +136,7 @@ func ListComments(postID string, currentUser string) ([]JoinComment, error) {
 	for rows.Next() {
 		var c JoinComment
 
-		if err := rows.Scan(&c.CommentID, &c.UserID, &c.Content, &c.CreatedAt, &c.PostID, &c.Count, &c.IDsVoted, &c.PreferredName, &c.Avatar); err != nil {
+		if err := rows.Scan(&c.CommentID, &c.UserID, &c.Content, &c.CreatedAt, &c.PostID, &c.EditedAt, &c.DeletedAt, &c.Count, &c.IDsVoted, &c.PreferredName, &c.Avatar, &c.Handle, &c.Muted, &c.Bookmarked); err != nil {
 			fmt.Println("Scanning error: ", err)
 			return comments, err
 		}
@@ -131,7 +166,11 @@ func ListComments(postID string, currentUser string) ([]JoinComment, error) {
 			fmt.Println(err)
 		}
 
-		c.AvatarPath = users.ChooseAvatar(c.Avatar)
+		c.AvatarPath = users.ChooseAvatar(c.Avatar, c.UserID)
+
+		if c.DeletedAt.Valid {
+			blankDeleted(&c)
+		}
 
 		comments = append(comments, c)
 	}
@@ -139,10 +178,47 @@ func ListComments(postID string, currentUser string) ([]JoinComment, error) {
 	return comments, nil
 }
 
+// ListLatestComments returns up to limit of the newest comments on a post that aren't deleted, with only what a
+// feed shows of them: the author's name, the content and the times.
+func ListLatestComments(postID string, limit int) ([]JoinComment, error) {
+	var comments []JoinComment
+
+	rows, err := database.DB.Query(`SELECT comments.comment_id, comments.content, comments.created_at, comments.post_id, comments.edited_at, COALESCE(users.preferred_name, '')
+									FROM comments
+										LEFT JOIN users ON users.user_id=comments.user_id
+									WHERE comments.post_id=$1 AND comments.deleted_at IS NULL
+									ORDER BY comments.created_at::TIMESTAMPTZ DESC
+									LIMIT $2`, postID, limit)
+	if err != nil {
+		return comments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c JoinComment
+		if err := rows.Scan(&c.CommentID, &c.Content, &c.CreatedAt, &c.PostID, &c.EditedAt, &c.PreferredName); err != nil {
+			return comments, err
+		}
+		comments = append(comments, c)
+	}
+
+	return comments, rows.Err()
+}
+
+// blankDeleted strips a soft-deleted comment down to a placeholder, so the content never reaches the template.
+func blankDeleted(c *JoinComment) {
+	c.Content = "[deleted]"
+	c.PreferredName = "[deleted]"
+	c.Handle = ""
+	c.Initials = ""
+	c.AvatarPath = ""
+	c.EditedAt = sql.NullString{}
+}
+
 func GetComment(commentID string, currentUser string) (Comment, error) {
 	var c Comment
 
-	err := database.DB.QueryRow("SELECT * FROM comments WHERE comment_id=$1 AND user_id=$2", commentID, currentUser).Scan(&c.CommentID, &c.UserID, &c.Content, &c.CreatedAt, &c.PostID)
+	err := database.DB.QueryRow("SELECT comment_id, user_id, content, created_at, post_id, edited_at FROM comments WHERE comment_id=$1 AND user_id=$2 AND deleted_at IS NULL", commentID, currentUser).Scan(&c.CommentID, &c.UserID, &c.Content, &c.CreatedAt, &c.PostID, &c.EditedAt)
 	if err != nil {
 		return c, err
 	}
@@ -150,27 +226,34 @@ func GetComment(commentID string, currentUser string) (Comment, error) {
 	return c, nil
 }
 
+// ErrCommentInvalid is returned for edits that fail the same checks as a new comment.
+var ErrCommentInvalid = errors.New("error: comment is invalid")
+
 func EditComment(commentID string, editedContent string, currentUser string) error {
-	/////////////////////
-	// TODO Need to add validation before saving into DB
-	/////////////////////
-	_, err := database.DB.Exec("UPDATE comments SET content=$1 WHERE comment_id=$2 AND user_id=$3", editedContent, commentID, currentUser)
-	if err != nil {
-		return err
+	if v := Validate(Comment{Content: editedContent}); v != nil {
+		return fmt.Errorf("%w: %s", ErrCommentInvalid, v["content"])
 	}
 
-	return nil
-}
+	var postID string
+	if err := database.DB.QueryRow("SELECT post_id FROM comments WHERE comment_id=$1 AND user_id=$2 AND deleted_at IS NULL", commentID, currentUser).Scan(&postID); err != nil {
+		return err
+	}
 
-func Delete(commentID string, username string) error {
-	_, err := database.DB.Exec(`DELETE FROM comments WHERE comment_id=$1 AND user_id=$2`, commentID, username)
-	if err != nil {
+	if err := overwrite(postID, commentID, FieldComment, editedContent, currentUser); err != nil {
 		return err
 	}
 
+	saveMentions(postID, commentID, currentUser, editedContent)
 	return nil
 }
 
+func Delete(commentID string, username string) error {
+	// Soft delete, so the comment still takes up its place in the thread as a "[deleted]" placeholder
+	t := time.Now().Format(time.RFC3339)
+	_, err := database.DB.Exec(`UPDATE comments SET deleted_at=$1, deleted_by=$2 WHERE comment_id=$3 AND user_id=$4 AND deleted_at IS NULL`, t, username, commentID, username)
+	return err
+}
+
 func Validate(c Comment) map[string](string) {
 	v := govalidator.New()
 
@@ -205,6 +288,15 @@ func UpVote(commentID string, username string) error {
 		return err
 	}
 
+	if strings.HasPrefix(q, "INSERT") {
+		var postID string
+		if err := database.DB.QueryRow("SELECT post_id FROM comments WHERE comment_id=$1", commentID).Scan(&postID); err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		notify(notifications.TypeUpvote, username, postID, commentID)
+	}
+
 	return nil
 }
 
@@ -252,20 +344,22 @@ func ConvertDate(date string) (string, error) {
 
 func ListCommentsFilterSort(postID string, currentUser string, sort string, filter string) ([]JoinComment, error) {
 	var comments []JoinComment
-	var q string = `SELECT comments.comment_id, comments.user_id, comments.content, comments.created_at, comments.post_id, cnt, ids_voted, users.preferred_name, users.avatar FROM comments 
+	var q string = `SELECT comments.comment_id, comments.user_id, comments.content, comments.created_at, comments.post_id, comments.edited_at, comments.deleted_at, cnt, ids_voted, users.preferred_name, users.avatar, COALESCE(users.handle, ''),
+					EXISTS (SELECT 1 FROM user_relations WHERE user_relations.user_id=$2 AND user_relations.target_id=comments.user_id) AS muted,
+					EXISTS (SELECT 1 FROM bookmarks WHERE bookmarks.user_id=$2 AND bookmarks.comment_id=comments.comment_id) AS bookmarked FROM comments 
 
 					LEFT JOIN (SELECT comments_votes.comment_id, COUNT(1) AS cnt, string_agg(DISTINCT comments_votes.user_id, ',') AS ids_voted 
 					FROM comments_votes 
 					GROUP BY comments_votes.comment_id) AS comments_votes 
 					ON comments.comment_id = comments_votes.comment_id 
 					
-					LEFT JOIN (SELECT users.user_id, users.preferred_name, users.avatar FROM users) as users
+					LEFT JOIN (SELECT users.user_id, users.preferred_name, users.avatar, users.handle FROM users) as users
 					ON comments.user_id = users.user_id
 					
 					WHERE comments.post_id=$1 ` // Still short of ORDER BY clause, deliberate space here
 
 	if filter != "" {
-		q += `AND (comments.content ILIKE '%' || $2 || '%') `
+		q += `AND comments.deleted_at IS NULL AND (comments.content ILIKE '%' || $3 || '%') `
 	}
 
 	if sort == "upvote;asc" {
@@ -288,9 +382,9 @@ func ListCommentsFilterSort(postID string, currentUser string, sort string, filt
 	// I considered left join for post description, but it was stupid to append description to every comment.
 	// Decided to just do a separate query for that instead.
 	if filter != "" {
-		rows, err = database.DB.Query(q, postID, filter)
+		rows, err = database.DB.Query(q, postID, currentUser, filter)
 	} else {
-		rows, err = database.DB.Query(q, postID)
+		rows, err = database.DB.Query(q, postID, currentUser)
 	}
 	if err != nil {
 		return comments, err
@@ -300,7 +394,7 @@ func ListCommentsFilterSort(postID string, currentUser string, sort string, filt
 	for rows.Next() {
 		var c JoinComment
 
-		if err := rows.Scan(&c.CommentID, &c.UserID, &c.Content, &c.CreatedAt, &c.PostID, &c.Count, &c.IDsVoted, &c.PreferredName, &c.Avatar); err != nil {
+		if err := rows.Scan(&c.CommentID, &c.UserID, &c.Content, &c.CreatedAt, &c.PostID, &c.EditedAt, &c.DeletedAt, &c.Count, &c.IDsVoted, &c.PreferredName, &c.Avatar, &c.Handle, &c.Muted, &c.Bookmarked); err != nil {
 			fmt.Println("Scanning error: ", err)
 			return comments, err
 		}
@@ -330,10 +424,25 @@ func ListCommentsFilterSort(postID string, currentUser string, sort string, filt
 			fmt.Println(err)
 		}
 
-		c.AvatarPath = users.ChooseAvatar(c.Avatar)
+		c.AvatarPath = users.ChooseAvatar(c.Avatar, c.UserID)
+
+		if c.DeletedAt.Valid {
+			blankDeleted(&c)
+		}
 
 		comments = append(comments, c)
 	}
+	rows.Close()
+
+	attachments, err := uploads.ListByPost(postID)
+	if err != nil {
+		return comments, err
+	}
+	for i := range comments {
+		if !comments[i].DeletedAt.Valid {
+			comments[i].Attachments = attachments[comments[i].CommentID]
+		}
+	}
 
 	return comments, nil
 }
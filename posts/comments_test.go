@@ -0,0 +1,44 @@
+package posts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorant/database"
+	"gorant/database/dbtest"
+)
+
+func TestEditCommentValidation(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.AddUser(t, "owner")
+	dbtest.AddPost(t, "rant", "owner")
+
+	commentID, err := Insert(Comment{UserID: "owner", Content: "the original comment", CreatedAt: time.Now().Format(time.RFC3339), PostID: "rant"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, content := range []string{"", "too short", strings.Repeat("a", 2001)} {
+		if err := EditComment(commentID, content, "owner"); !errors.Is(err, ErrCommentInvalid) {
+			t.Errorf("EditComment with %d characters = %v, want ErrCommentInvalid", len(content), err)
+		}
+	}
+
+	var content string
+	var revisions int
+	if err := database.DB.QueryRow("SELECT content FROM comments WHERE comment_id=$1", commentID).Scan(&content); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Get(&revisions, "SELECT COUNT(1) FROM revisions WHERE comment_id=$1", commentID); err != nil {
+		t.Fatal(err)
+	}
+	if content != "the original comment" || revisions != 0 {
+		t.Errorf("rejected edits left %q with %d revisions", content, revisions)
+	}
+
+	if err := EditComment(commentID, "a comment that's long enough", "owner"); err != nil {
+		t.Errorf("EditComment of a valid edit = %v", err)
+	}
+}
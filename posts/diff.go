@@ -0,0 +1,56 @@
+package posts
+
+import "strings"
+
+type DiffLine struct {
+	Op   string // "=" unchanged, "+" added, "-" removed
+	Text string
+}
+
+// DiffLines returns a line-by-line diff from a to b, using the longest common subsequence of lines.
+// Content here is short (titles, descriptions, comments up to 2000 chars), so the O(n*m) table is fine.
+func DiffLines(a string, b string) []DiffLine {
+	var diff []DiffLine
+
+	x := strings.Split(a, "\n")
+	y := strings.Split(b, "\n")
+
+	// lcs[i][j] holds the length of the LCS of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			diff = append(diff, DiffLine{Op: "=", Text: x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: "-", Text: x[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: "+", Text: y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		diff = append(diff, DiffLine{Op: "-", Text: x[i]})
+	}
+	for ; j < len(y); j++ {
+		diff = append(diff, DiffLine{Op: "+", Text: y[j]})
+	}
+
+	return diff
+}
@@ -0,0 +1,29 @@
+package posts
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []DiffLine
+	}{
+		{"empty", "", "", []DiffLine{{"=", ""}}},
+		{"identical", "one\ntwo", "one\ntwo", []DiffLine{{"=", "one"}, {"=", "two"}}},
+		{"insert only", "one\nthree", "one\ntwo\nthree", []DiffLine{{"=", "one"}, {"+", "two"}, {"=", "three"}}},
+		{"delete only", "one\ntwo\nthree", "one\nthree", []DiffLine{{"=", "one"}, {"-", "two"}, {"=", "three"}}},
+		{"from empty", "", "one", []DiffLine{{"-", ""}, {"+", "one"}}},
+		{"replaced", "one\ntwo", "one\n2", []DiffLine{{"=", "one"}, {"-", "two"}, {"+", "2"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffLines(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffLines(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package posts
+
+import (
+	"errors"
+	"time"
+
+	"gorant/database"
+)
+
+// Feed orders. Hot weighs reactions and comments against age, roughly the way link aggregators do,
+// so a busy rant from this morning ranks above a quiet one from a minute ago.
+const (
+	FeedNew = "new"
+	FeedHot = "hot"
+)
+
+const FeedPageSize = 20
+
+// ListFeed returns one page (from 1) of posts by users userID follows or tagged with tags they follow,
+// and whether there's another page after it. Their own posts aren't included.
+func ListFeed(userID string, order string, page int) (PostCollection, bool, error) {
+	rows, err := database.DB.Query(`SELECT posts.post_id, posts.user_id, posts.post_title, posts.description, posts.protected, posts.created_at, posts.mood, users.preferred_name, comments_cnt, reactions_cnt, reactions, bookmarks_cnt, tags,
+										EXISTS (SELECT 1 FROM user_relations WHERE user_relations.user_id=$1 AND user_relations.target_id=posts.user_id) AS muted
+									FROM posts
+										LEFT JOIN users ON users.user_id=posts.user_id
+										LEFT JOIN(SELECT comments.post_id, COUNT(1) AS comments_cnt
+												FROM comments
+												WHERE comments.deleted_at IS NULL
+												GROUP BY comments.post_id) AS comments ON comments.post_id=posts.post_id
+										LEFT JOIN(SELECT post_id, SUM(n)::INT AS reactions_cnt, string_agg(reaction || ':' || n, ',' ORDER BY n DESC, reaction) AS reactions
+												FROM(SELECT post_id, reaction, COUNT(1) AS n FROM posts_reactions GROUP BY post_id, reaction) AS reaction_counts
+												GROUP BY reaction_counts.post_id) AS posts_reactions ON posts.post_id=posts_reactions.post_id
+										LEFT JOIN(SELECT post_id, COUNT(1) AS bookmarks_cnt
+												FROM bookmarks
+												WHERE comment_id IS NULL
+												GROUP BY bookmarks.post_id) AS bookmarks ON posts.post_id=bookmarks.post_id
+										LEFT JOIN(SELECT posts_tags.post_id, string_agg(tags.tag, ',') as tags
+												FROM posts_tags
+														LEFT JOIN tags ON posts_tags.tag_id=tags.tag_id
+												GROUP BY posts_tags.post_id) as posts_tags ON posts.post_id=posts_tags.post_id
+									WHERE posts.deleted_at IS NULL AND posts.user_id <> $1
+										AND (posts.user_id IN (SELECT followee_id FROM follows WHERE follower_id=$1)
+											OR posts.post_id IN (SELECT posts_tags.post_id FROM posts_tags
+																	INNER JOIN tags_follows ON tags_follows.tag_id=posts_tags.tag_id
+																WHERE tags_follows.user_id=$1))
+									ORDER BY `+feedOrderBy(order)+`
+									LIMIT $2 OFFSET $3`, userID, FeedPageSize+1, offset(page, FeedPageSize))
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPosts(rows)
+	if len(posts) > FeedPageSize {
+		return posts[:FeedPageSize], true, err
+	}
+
+	return posts, false, err
+}
+
+// feedOrderBy is the ORDER BY clause for a feed order, for queries that select reactions_cnt and comments_cnt.
+func feedOrderBy(order string) string {
+	if order == FeedHot {
+		return `(COALESCE(reactions_cnt, 0) + COALESCE(comments_cnt, 0) + 1) / POWER(EXTRACT(EPOCH FROM now() - posts.created_at::TIMESTAMPTZ) / 3600 + 2, 1.5) DESC, posts.created_at::TIMESTAMPTZ DESC`
+	}
+
+	return `posts.created_at::TIMESTAMPTZ DESC`
+}
+
+// ToggleFollowTag follows a tag, or unfollows it if userID already does. It returns whether they follow it now.
+func ToggleFollowTag(userID string, tag string) (bool, error) {
+	var tagID int
+	if err := database.DB.QueryRow("SELECT tag_id FROM tags WHERE tag=$1", tag).Scan(&tagID); err != nil {
+		return false, errors.New("error: tag not found")
+	}
+
+	res, err := database.DB.Exec("DELETE FROM tags_follows WHERE user_id=$1 AND tag_id=$2", userID, tagID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return false, nil
+	}
+
+	_, err = database.DB.Exec(`INSERT INTO tags_follows (user_id, tag_id, created_at) VALUES ($1, $2, $3)
+								ON CONFLICT (user_id, tag_id) DO NOTHING`, userID, tagID, time.Now().Format(time.RFC3339))
+	return err == nil, err
+}
+
+func ListFollowedTags(userID string) ([]string, error) {
+	var tags []string
+	err := database.DB.Select(&tags, `SELECT tags.tag FROM tags_follows
+										INNER JOIN tags ON tags.tag_id=tags_follows.tag_id
+									WHERE tags_follows.user_id=$1
+									ORDER BY tags.tag`, userID)
+
+	return tags, err
+}
@@ -0,0 +1,260 @@
+package posts
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorant/database"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// How a filter's tags combine: posts with any of them, or only posts with all of them.
+const (
+	TagsAny = "any"
+	TagsAll = "all"
+)
+
+const filterDate = "2006-01-02"
+
+// Longest text query a filter searches for
+const maxFilterQuery = 100
+
+// Filter narrows down the post list. Empty fields don't filter, so the zero Filter matches every post.
+type Filter struct {
+	Moods        []string
+	Tags         []string
+	TagMode      string // TagsAny or TagsAll
+	ExcludeTags  []string
+	From         time.Time // Posted on or after this day
+	To           time.Time // Posted on or before this day
+	Author       string    // Handle of the author
+	MinReactions int
+	MinComments  int
+	Query        string // Searched for in titles and descriptions
+}
+
+// ParseFilter reads a filter from the filter form or a shared link. Values that don't parse are ignored rather
+// than rejected, a half-broken link still shows something.
+func ParseFilter(v url.Values) Filter {
+	f := Filter{
+		Moods:       filterList(v["mood"]),
+		Tags:        filterList(v["tags"]),
+		TagMode:     TagsAny,
+		ExcludeTags: filterList(v["not-tags"]),
+		Author:      strings.TrimPrefix(strings.ToLower(strings.TrimSpace(v.Get("author"))), "@"),
+		Query:       strings.TrimSpace(v.Get("q")),
+	}
+
+	if v.Get("tag-mode") == TagsAll {
+		f.TagMode = TagsAll
+	}
+	f.From, _ = time.Parse(filterDate, v.Get("from"))
+	f.To, _ = time.Parse(filterDate, v.Get("to"))
+	f.MinReactions, _ = strconv.Atoi(v.Get("min-reactions"))
+	f.MinReactions = max(f.MinReactions, 0)
+	f.MinComments, _ = strconv.Atoi(v.Get("min-comments"))
+	f.MinComments = max(f.MinComments, 0)
+	if r := []rune(f.Query); len(r) > maxFilterQuery {
+		f.Query = string(r[:maxFilterQuery])
+	}
+
+	return f
+}
+
+// filterList lowercases, trims and dedupes a list of values, splitting values that are comma separated lists
+// themselves as typed into a text field.
+func filterList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if s != "" && !slices.Contains(list, s) {
+				list = append(list, s)
+			}
+		}
+	}
+
+	return list
+}
+
+// Values encodes the filter the way ParseFilter reads it, for links to share it.
+func (f Filter) Values() url.Values {
+	v := url.Values{}
+	for _, m := range f.Moods {
+		v.Add("mood", m)
+	}
+	for _, t := range f.Tags {
+		v.Add("tags", t)
+	}
+	if f.TagMode == TagsAll && len(f.Tags) > 0 {
+		v.Set("tag-mode", TagsAll)
+	}
+	for _, t := range f.ExcludeTags {
+		v.Add("not-tags", t)
+	}
+	if !f.From.IsZero() {
+		v.Set("from", f.From.Format(filterDate))
+	}
+	if !f.To.IsZero() {
+		v.Set("to", f.To.Format(filterDate))
+	}
+	if f.Author != "" {
+		v.Set("author", f.Author)
+	}
+	if f.MinReactions > 0 {
+		v.Set("min-reactions", strconv.Itoa(f.MinReactions))
+	}
+	if f.MinComments > 0 {
+		v.Set("min-comments", strconv.Itoa(f.MinComments))
+	}
+	if f.Query != "" {
+		v.Set("q", f.Query)
+	}
+
+	return v
+}
+
+// IsZero reports whether the filter lets every post through.
+func (f Filter) IsZero() bool {
+	return len(f.Values()) == 0
+}
+
+// FromString and ToString are the filter's dates in the format of date inputs.
+func (f Filter) FromString() string {
+	if f.From.IsZero() {
+		return ""
+	}
+	return f.From.Format(filterDate)
+}
+
+func (f Filter) ToString() string {
+	if f.To.IsZero() {
+		return ""
+	}
+	return f.To.Format(filterDate)
+}
+
+// where compiles the filter into conditions to AND onto a post list query, with ? placeholders for sqlx.In and
+// their arguments. Every value the user picked goes into the arguments, never into the SQL.
+func (f Filter) where() (string, []any) {
+	var conds []string
+	var args []any
+
+	if len(f.Moods) > 0 {
+		conds = append(conds, "posts.mood IN (?)")
+		args = append(args, f.Moods)
+	}
+
+	const taggedWith = `SELECT posts_tags.post_id FROM posts_tags INNER JOIN tags ON tags.tag_id=posts_tags.tag_id WHERE tags.tag IN (?)`
+	if len(f.Tags) > 0 {
+		if f.TagMode == TagsAll {
+			conds = append(conds, "posts.post_id IN ("+taggedWith+" GROUP BY posts_tags.post_id HAVING COUNT(DISTINCT tags.tag_id) = ?)")
+			args = append(args, f.Tags, len(f.Tags))
+		} else {
+			conds = append(conds, "posts.post_id IN ("+taggedWith+")")
+			args = append(args, f.Tags)
+		}
+	}
+	if len(f.ExcludeTags) > 0 {
+		conds = append(conds, "posts.post_id NOT IN ("+taggedWith+")")
+		args = append(args, f.ExcludeTags)
+	}
+
+	if !f.From.IsZero() {
+		conds = append(conds, "posts.created_at::TIMESTAMPTZ >= ?::TIMESTAMPTZ")
+		args = append(args, f.From.Format(time.RFC3339))
+	}
+	if !f.To.IsZero() {
+		// To is a whole day, so up to the start of the next one
+		conds = append(conds, "posts.created_at::TIMESTAMPTZ < ?::TIMESTAMPTZ")
+		args = append(args, f.To.AddDate(0, 0, 1).Format(time.RFC3339))
+	}
+
+	if f.Author != "" {
+		conds = append(conds, "users.handle = ?")
+		args = append(args, f.Author)
+	}
+	if f.MinReactions > 0 {
+		conds = append(conds, "COALESCE(reactions_cnt, 0) >= ?")
+		args = append(args, f.MinReactions)
+	}
+	if f.MinComments > 0 {
+		conds = append(conds, "COALESCE(comments_cnt, 0) >= ?")
+		args = append(args, f.MinComments)
+	}
+
+	if f.Query != "" {
+		conds = append(conds, `(posts.post_title ILIKE ? OR posts.description ILIKE ?)`)
+		pattern := "%" + likeEscaper.Replace(f.Query) + "%"
+		args = append(args, pattern, pattern)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+
+	return " AND " + strings.Join(conds, " AND "), args
+}
+
+// likeEscaper keeps the wildcards of a text query literal in ILIKE, backslash being Postgres' default escape.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ListPostsFilter returns the posts f lets through, newest first. Untagged posts are only left out when the
+// filter asks for tags.
+func ListPostsFilter(f Filter, viewer string) (PostCollection, error) {
+	return listPostsFilter(f, viewer, 0)
+}
+
+// ListLatestPosts returns up to limit of the newest posts f lets through, as someone who isn't logged in sees them.
+func ListLatestPosts(f Filter, limit int) (PostCollection, error) {
+	return listPostsFilter(f, "", limit)
+}
+
+// listPostsFilter is ListPostsFilter capped at limit posts, 0 for no cap.
+func listPostsFilter(f Filter, viewer string, limit int) (PostCollection, error) {
+	where, args := f.where()
+	args = append([]any{viewer}, args...)
+
+	var limitClause string
+	if limit > 0 {
+		limitClause = " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	query, args, err := sqlx.In(`SELECT posts.post_id, posts.user_id, posts.post_title, posts.description, posts.protected, posts.created_at, posts.mood, users.preferred_name, comments_cnt, reactions_cnt, reactions, bookmarks_cnt, tags,
+										EXISTS (SELECT 1 FROM user_relations WHERE user_relations.user_id=? AND user_relations.target_id=posts.user_id) AS muted
+								FROM posts
+									LEFT JOIN users ON users.user_id=posts.user_id
+									LEFT JOIN(SELECT comments.post_id, COUNT(1) AS comments_cnt
+											FROM comments
+											WHERE comments.deleted_at IS NULL
+											GROUP BY comments.post_id) AS comments ON comments.post_id=posts.post_id
+									LEFT JOIN(SELECT post_id, SUM(n)::INT AS reactions_cnt, string_agg(reaction || ':' || n, ',' ORDER BY n DESC, reaction) AS reactions
+											FROM(SELECT post_id, reaction, COUNT(1) AS n FROM posts_reactions GROUP BY post_id, reaction) AS reaction_counts
+											GROUP BY reaction_counts.post_id) AS posts_reactions ON posts.post_id=posts_reactions.post_id
+									LEFT JOIN(SELECT post_id, COUNT(1) AS bookmarks_cnt
+											FROM bookmarks
+											WHERE comment_id IS NULL
+											GROUP BY bookmarks.post_id) AS bookmarks ON posts.post_id=bookmarks.post_id
+									LEFT JOIN(SELECT posts_tags.post_id, string_agg(tags.tag, ',') as tags
+											FROM posts_tags
+													LEFT JOIN tags ON posts_tags.tag_id=tags.tag_id
+											GROUP BY posts_tags.post_id) as posts_tags ON posts.post_id=posts_tags.post_id
+								WHERE posts.deleted_at IS NULL`+where+`
+								ORDER BY `+feedOrderBy(FeedNew)+limitClause, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(database.DB.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPosts(rows)
+}
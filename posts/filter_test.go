@@ -0,0 +1,70 @@
+package posts
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	v, _ := url.ParseQuery("mood=angry&mood=sad&tags=Work&tags=work,%20traffic&tag-mode=all&not-tags=cats&from=2024-01-02&to=nope&author=@Jane&min-reactions=3&min-comments=-1&q=%20boss%20")
+	got := ParseFilter(v)
+	want := Filter{
+		Moods:        []string{"angry", "sad"},
+		Tags:         []string{"work", "traffic"},
+		TagMode:      TagsAll,
+		ExcludeTags:  []string{"cats"},
+		From:         time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Author:       "jane",
+		MinReactions: 3,
+		Query:        "boss",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseFilter = %+v, want %+v", got, want)
+	}
+
+	if again := ParseFilter(got.Values()); !reflect.DeepEqual(again, got) {
+		t.Errorf("ParseFilter(Values()) = %+v, want %+v", again, got)
+	}
+
+	if f := ParseFilter(url.Values{}); !f.IsZero() {
+		t.Errorf("empty filter isn't zero: %+v", f)
+	}
+}
+
+func TestFilterWhere(t *testing.T) {
+	if where, args := (Filter{TagMode: TagsAny}).where(); where != "" || args != nil {
+		t.Errorf("zero filter where = %q, %v", where, args)
+	}
+
+	f := Filter{
+		Tags:        []string{"work", "traffic"},
+		TagMode:     TagsAll,
+		ExcludeTags: []string{"cats"},
+		To:          time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Query:       "100%_done'; DROP TABLE posts; --",
+	}
+	where, args := f.where()
+
+	if strings.Contains(where, "DROP") || strings.Contains(where, "work") {
+		t.Errorf("where has user values in it: %q", where)
+	}
+	if n := strings.Count(where, "?"); n != len(args) {
+		t.Errorf("where has %d placeholders for %d args: %q", n, len(args), where)
+	}
+	if !strings.Contains(where, "HAVING COUNT(DISTINCT tags.tag_id) = ?") || !strings.Contains(where, "NOT IN") {
+		t.Errorf("where is missing the tag conditions: %q", where)
+	}
+
+	wantArgs := []any{
+		[]string{"work", "traffic"}, 2,
+		[]string{"cats"},
+		"2024-01-03T00:00:00Z",
+		`%100\%\_done'; DROP TABLE posts; --%`, `%100\%\_done'; DROP TABLE posts; --%`,
+	}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("where args = %#v, want %#v", args, wantArgs)
+	}
+}
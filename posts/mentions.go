@@ -0,0 +1,68 @@
+package posts
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gorant/database"
+	"gorant/markdown"
+	"gorant/notifications"
+)
+
+// Anything past this many handles in one comment is ignored, so a comment can't be used to ping half the site
+const maxMentions = 10
+
+// saveMentions syncs the mentions table with a comment's content and notifies users mentioned for the first time,
+// so editing a comment only notifies whoever the edit added. Handles that don't belong to anyone are ignored, as are
+// mentions of yourself and of users who have blocked the author. Like notify, failures are only logged.
+func saveMentions(postID string, commentID string, author string, content string) {
+	handles := markdown.Mentions(content)
+	if len(handles) > maxMentions {
+		handles = handles[:maxMentions]
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		fmt.Println("Error saving mentions: ", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM mentions
+							WHERE comment_id=$1 AND user_id NOT IN (SELECT user_id FROM users WHERE handle = ANY($2))`, commentID, handles); err != nil {
+		fmt.Println("Error saving mentions: ", err)
+		return
+	}
+
+	var added []string
+	err = tx.Select(&added, `INSERT INTO mentions (comment_id, user_id, created_at)
+								SELECT $1, users.user_id, $3 FROM users
+								WHERE users.handle = ANY($2) AND users.user_id <> $4
+									AND NOT EXISTS (SELECT 1 FROM user_relations WHERE user_relations.user_id=users.user_id AND user_relations.target_id=$4 AND user_relations.kind='block')
+								ON CONFLICT (comment_id, user_id) DO NOTHING
+								RETURNING user_id`, commentID, handles, time.Now().Format(time.RFC3339), author)
+	if err != nil {
+		fmt.Println("Error saving mentions: ", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error saving mentions: ", err)
+		return
+	}
+
+	for _, userID := range added {
+		n := notifications.Notification{
+			UserID:    userID,
+			ActorID:   sql.NullString{String: author, Valid: true},
+			Type:      notifications.TypeMention,
+			PostID:    sql.NullString{String: postID, Valid: true},
+			CommentID: sql.NullString{String: commentID, Valid: true},
+		}
+
+		if err := notifications.Notify(n); err != nil {
+			fmt.Println("Error notifying: ", err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package posts
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorant/database"
+)
+
+// MoodStep is one stretch of a post's mood arc, starting when the post switched to Mood.
+type MoodStep struct {
+	Mood          string
+	From          string         // Empty for the mood the post was created with
+	UserID        sql.NullString // Who switched it
+	PreferredName sql.NullString
+	At            time.Time
+}
+
+// MoodArc is every mood a post has had, oldest first, starting with the one it was posted with.
+type MoodArc []MoodStep
+
+func GetMoodArc(postID string) (MoodArc, error) {
+	var arc MoodArc
+
+	var first MoodStep
+	var current string
+	var createdAt string
+	err := database.DB.QueryRow(`SELECT posts.mood, posts.created_at, posts.user_id, users.preferred_name
+								FROM posts
+									LEFT JOIN users ON users.user_id = posts.user_id
+								WHERE posts.post_id = $1`, postID).Scan(&current, &createdAt, &first.UserID, &first.PreferredName)
+	if err != nil {
+		return arc, err
+	}
+	if first.At, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return arc, err
+	}
+
+	rows, err := database.DB.Query(`SELECT mood_changes.from_mood, mood_changes.to_mood, mood_changes.user_id, users.preferred_name, mood_changes.created_at
+									FROM mood_changes
+										LEFT JOIN users ON users.user_id = mood_changes.user_id
+									WHERE mood_changes.post_id = $1
+									ORDER BY mood_changes.change_id`, postID)
+	if err != nil {
+		return arc, err
+	}
+	defer rows.Close()
+
+	// The post's first mood is the from_mood of its first change, or its current mood if it never changed
+	first.Mood = current
+	arc = append(arc, first)
+
+	for rows.Next() {
+		var s MoodStep
+		var at string
+		if err := rows.Scan(&s.From, &s.Mood, &s.UserID, &s.PreferredName, &at); err != nil {
+			return arc, err
+		}
+		if s.At, err = time.Parse(time.RFC3339, at); err != nil {
+			return arc, err
+		}
+		if len(arc) == 1 {
+			arc[0].Mood = s.From
+		}
+		arc = append(arc, s)
+	}
+
+	return arc, rows.Err()
+}
+
+// Current returns the mood the post has now.
+func (a MoodArc) Current() string {
+	if len(a) == 0 {
+		return ""
+	}
+
+	return a[len(a)-1].Mood
+}
+
+// TimeBetween returns how long the post took to go from one mood to another: from the first time it was in
+// from, to the first time after that it switched to to. ok is false if that never happened.
+func (a MoodArc) TimeBetween(from string, to string) (d time.Duration, ok bool) {
+	for i := range a {
+		if a[i].Mood != from {
+			continue
+		}
+		for _, s := range a[i+1:] {
+			if s.Mood == to {
+				return s.At.Sub(a[i].At), true
+			}
+		}
+		break
+	}
+
+	return 0, false
+}
+
+// Durations returns how long the post spent in each mood, counting the current one up to now.
+func (a MoodArc) Durations(now time.Time) map[string]time.Duration {
+	d := make(map[string]time.Duration)
+	for i, s := range a {
+		end := now
+		if i+1 < len(a) {
+			end = a[i+1].At
+		}
+		d[s.Mood] += end.Sub(s.At)
+	}
+
+	return d
+}
+
+// TimeBetweenMoods answers "how long did this post take to go from angry to neutral", see MoodArc.TimeBetween.
+func TimeBetweenMoods(postID string, from string, to string) (time.Duration, bool, error) {
+	arc, err := GetMoodArc(postID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	d, ok := arc.TimeBetween(from, to)
+	return d, ok, nil
+}
+
+// TimelineEntry is a mood change or a comment on the mood timeline of a post. Comments have a CommentID.
+type TimelineEntry struct {
+	Mood          string
+	From          string
+	CommentID     string
+	Excerpt       string
+	Muted         bool // The commenter is muted or blocked by the viewer
+	PreferredName string
+	At            time.Time
+	AtProcessed   string
+}
+
+// GetMoodTimeline returns a post's mood changes interleaved with its comments, oldest first, starting with
+// the mood it was posted with. It's empty for posts whose mood never changed.
+func GetMoodTimeline(postID string, viewer string) ([]TimelineEntry, error) {
+	var timeline []TimelineEntry
+
+	arc, err := GetMoodArc(postID)
+	if err != nil || len(arc) < 2 {
+		return timeline, err
+	}
+
+	for _, s := range arc {
+		timeline = append(timeline, TimelineEntry{Mood: s.Mood, From: s.From, PreferredName: s.PreferredName.String, At: s.At})
+	}
+
+	rows, err := database.DB.Query(`SELECT comments.comment_id, COALESCE(users.preferred_name, ''), LEFT(comments.content, 140), comments.created_at,
+										EXISTS (SELECT 1 FROM user_relations WHERE user_relations.user_id=$2 AND user_relations.target_id=comments.user_id) AS muted
+									FROM comments
+										LEFT JOIN users ON users.user_id = comments.user_id
+									WHERE comments.post_id = $1 AND comments.deleted_at IS NULL
+									ORDER BY comments.comment_id`, postID, viewer)
+	if err != nil {
+		return timeline, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e TimelineEntry
+		var at string
+		if err := rows.Scan(&e.CommentID, &e.PreferredName, &e.Excerpt, &at, &e.Muted); err != nil {
+			return timeline, err
+		}
+		if e.At, err = time.Parse(time.RFC3339, at); err != nil {
+			return timeline, err
+		}
+		timeline = append(timeline, e)
+	}
+	if err := rows.Err(); err != nil {
+		return timeline, err
+	}
+
+	// Stable, so a mood change made in the same second as a comment stays first
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].At.Before(timeline[j].At)
+	})
+
+	for i := range timeline {
+		timeline[i].AtProcessed, err = ConvertDate(timeline[i].At.Format(time.RFC3339))
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	return timeline, nil
+}
@@ -0,0 +1,62 @@
+package posts
+
+import (
+	"testing"
+	"time"
+)
+
+func testArc() MoodArc {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return MoodArc{
+		{Mood: "angry", At: start},
+		{Mood: "sad", From: "angry", At: start.Add(2 * time.Hour)},
+		{Mood: "angry", From: "sad", At: start.Add(3 * time.Hour)},
+		{Mood: "neutral", From: "angry", At: start.Add(5 * time.Hour)},
+		{Mood: "happy", From: "neutral", At: start.Add(24 * time.Hour)},
+	}
+}
+
+func TestTimeBetween(t *testing.T) {
+	arc := testArc()
+
+	tests := []struct {
+		from, to string
+		want     time.Duration
+		ok       bool
+	}{
+		{"angry", "neutral", 5 * time.Hour, true},
+		{"angry", "sad", 2 * time.Hour, true},
+		{"sad", "happy", 22 * time.Hour, true},
+		{"neutral", "angry", 0, false},
+		{"elated", "happy", 0, false},
+		{"happy", "happy", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := arc.TimeBetween(tt.from, tt.to)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("TimeBetween(%q, %q) = %v, %v, want %v, %v", tt.from, tt.to, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDurations(t *testing.T) {
+	arc := testArc()
+	now := arc[0].At.Add(30 * time.Hour)
+
+	got := arc.Durations(now)
+	want := map[string]time.Duration{
+		"angry":   4 * time.Hour,
+		"sad":     time.Hour,
+		"neutral": 19 * time.Hour,
+		"happy":   6 * time.Hour,
+	}
+	for mood, d := range want {
+		if got[mood] != d {
+			t.Errorf("Durations()[%q] = %v, want %v", mood, got[mood], d)
+		}
+	}
+
+	if c := arc.Current(); c != "happy" {
+		t.Errorf("Current() = %q, want happy", c)
+	}
+}
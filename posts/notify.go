@@ -0,0 +1,38 @@
+package posts
+
+import (
+	"database/sql"
+	"fmt"
+
+	"gorant/database"
+	"gorant/notifications"
+)
+
+// notify tells whoever is affected about something actor did: the comment's author for upvotes,
+// the post's author for everything else.
+// Failures are only logged, a missing notification shouldn't undo the comment/vote/like that caused it.
+func notify(typ string, actor string, postID string, commentID string) {
+	var owner string
+	var err error
+	if typ == notifications.TypeUpvote {
+		err = database.DB.QueryRow("SELECT user_id FROM comments WHERE comment_id=$1", commentID).Scan(&owner)
+	} else {
+		err = database.DB.QueryRow("SELECT user_id FROM posts WHERE post_id=$1", postID).Scan(&owner)
+	}
+	if err != nil {
+		fmt.Println("Error finding who to notify: ", err)
+		return
+	}
+
+	n := notifications.Notification{
+		UserID:    owner,
+		ActorID:   sql.NullString{String: actor, Valid: true},
+		Type:      typ,
+		PostID:    sql.NullString{String: postID, Valid: true},
+		CommentID: sql.NullString{String: commentID, Valid: commentID != ""},
+	}
+
+	if err := notifications.Notify(n); err != nil {
+		fmt.Println("Error notifying: ", err)
+	}
+}
@@ -10,8 +10,9 @@ import (
 	"time"
 
 	"gorant/database"
+	"gorant/moods"
+	"gorant/uploads"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/rezakhademix/govalidator/v2"
 )
 
@@ -72,6 +73,9 @@ type ZPost struct {
 	Mood          string `db:"mood"`
 	Tags          Tags
 	PostStats     ZPostStats
+	DeletedAt     sql.NullString `db:"deleted_at"`
+	Attachments   []uploads.Attachment
+	Muted         bool // The author is muted or blocked by whoever is viewing the list
 }
 
 type CreatedAt struct {
@@ -85,37 +89,51 @@ type Tags struct {
 }
 
 type Tag struct {
-	TagID int    `db:"tag_id"`
-	Tag   string `db:"tag"`
+	TagID       int    `db:"tag_id"`
+	Tag         string `db:"tag"`
+	Posts       int    `db:"posts"` // How many posts use the tag, where the query counts them
+	Description string `db:"description"`
 }
 
 type ZPostStats struct {
 	CommentsCount         sql.NullInt64 `db:"comments_cnt"`
 	CommentsCountString   string
-	LikesCount            sql.NullInt64 `db:"likes_cnt"`
-	LikesCountString      string
-	CurrentUserLike       sql.NullInt64 `db:"score"`
-	CurrentUserLikeString string
+	ReactionsCount        sql.NullInt64 `db:"reactions_cnt"`
+	ReactionsCountString  string
+	Reactions             []ReactionCount // Most used first
+	CurrentUserReaction   string          // Mood key of the viewer's reaction, empty if they haven't reacted
+	BookmarksCount        sql.NullInt64   `db:"bookmarks_cnt"`
+	BookmarksCountString  string
+	CurrentUserBookmark   bool
+	CurrentUserSubscribed bool // Following the post's discussion, see ToggleSubscription
 }
 
 type PostCollection []ZPost
 
 const regex string = `^[A-Za-z0-9 _!.\$\/\\|()\[\]=` + "`" + `{<>?@#%^&*—:;'"+\-,"]+$`
 
-func ListPosts() (PostCollection, error) {
-	rows, err := database.DB.Query(`SELECT posts.post_id, posts.user_id, posts.post_title, posts.description, posts.protected, posts.created_at, posts.mood, users.preferred_name, comments_cnt, likes_cnt, tags
+// ListPosts returns every post. Posts by anyone viewer has muted or blocked are flagged Muted, for the list to collapse.
+func ListPosts(viewer string) (PostCollection, error) {
+	rows, err := database.DB.Query(`SELECT posts.post_id, posts.user_id, posts.post_title, posts.description, posts.protected, posts.created_at, posts.mood, users.preferred_name, comments_cnt, reactions_cnt, reactions, bookmarks_cnt, tags,
+										EXISTS (SELECT 1 FROM user_relations WHERE user_relations.user_id=$1 AND user_relations.target_id=posts.user_id) AS muted
 									FROM posts
 										LEFT JOIN users ON users.user_id=posts.user_id
 										LEFT JOIN(SELECT comments.post_id, COUNT(1) AS comments_cnt
 												FROM comments
+												WHERE comments.deleted_at IS NULL
 												GROUP BY comments.post_id) AS comments ON comments.post_id=posts.post_id
-										LEFT JOIN(SELECT post_id, COUNT(1) as likes_cnt
-												FROM posts_likes
-												GROUP BY posts_likes.post_id) as posts_likes ON posts.post_id=posts_likes.post_id
+										LEFT JOIN(SELECT post_id, SUM(n)::INT AS reactions_cnt, string_agg(reaction || ':' || n, ',' ORDER BY n DESC, reaction) AS reactions
+												FROM(SELECT post_id, reaction, COUNT(1) AS n FROM posts_reactions GROUP BY post_id, reaction) AS reaction_counts
+												GROUP BY reaction_counts.post_id) AS posts_reactions ON posts.post_id=posts_reactions.post_id
+										LEFT JOIN(SELECT post_id, COUNT(1) AS bookmarks_cnt
+												FROM bookmarks
+												WHERE comment_id IS NULL
+												GROUP BY bookmarks.post_id) AS bookmarks ON posts.post_id=bookmarks.post_id
 										LEFT JOIN(SELECT posts_tags.post_id, string_agg(tags.tag, ',') as tags
 												FROM posts_tags
 														LEFT JOIN tags ON posts_tags.tag_id=tags.tag_id
-												GROUP BY posts_tags.post_id) as posts_tags ON posts.post_id=posts_tags.post_id`)
+												GROUP BY posts_tags.post_id) as posts_tags ON posts.post_id=posts_tags.post_id
+									WHERE posts.deleted_at IS NULL`, viewer)
 	if err != nil {
 		fmt.Println("Error executing query: ", err)
 		return nil, err
@@ -123,19 +141,29 @@ func ListPosts() (PostCollection, error) {
 
 	defer rows.Close()
 
+	return scanPosts(rows)
+}
+
+// scanPosts reads rows selecting post_id, user_id, post_title, description, protected, created_at, mood,
+// preferred_name, comments_cnt, reactions_cnt, reactions, bookmarks_cnt, tags and muted, in that order, the columns every post list query returns.
+func scanPosts(rows *sql.Rows) (PostCollection, error) {
 	var posts PostCollection
 
 	for rows.Next() {
 		var p ZPost
+		var reactions sql.NullString
 
-		if err := rows.Scan(&p.ID, &p.UserID, &p.Title, &p.Description, &p.Protected, &p.CreatedAt.CreatedAtString, &p.Mood, &p.PreferredName, &p.PostStats.CommentsCount, &p.PostStats.LikesCount, &p.Tags.TagsNullString); err != nil {
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Title, &p.Description, &p.Protected, &p.CreatedAt.CreatedAtString, &p.Mood, &p.PreferredName, &p.PostStats.CommentsCount, &p.PostStats.ReactionsCount, &reactions, &p.PostStats.BookmarksCount, &p.Tags.TagsNullString, &p.Muted); err != nil {
 			fmt.Println("Error scanning")
 			return nil, err
 		}
 
 		p.PostStats.CommentsCountString = NullIntToString(p.PostStats.CommentsCount)
 
-		p.PostStats.LikesCountString = NullIntToString(p.PostStats.LikesCount)
+		p.PostStats.ReactionsCountString = NullIntToString(p.PostStats.ReactionsCount)
+		p.PostStats.Reactions = parseReactionCounts(reactions.String)
+
+		p.PostStats.BookmarksCountString = NullIntToString(p.PostStats.BookmarksCount)
 
 		if p.Tags.TagsNullString.Valid {
 			p.Tags.Tags = strings.Split(p.Tags.TagsNullString.String, ",")
@@ -143,6 +171,7 @@ func ListPosts() (PostCollection, error) {
 			p.Tags.Tags = []string{}
 		}
 
+		var err error
 		p.CreatedAt.CreatedAtProcessed, err = ConvertDate(p.CreatedAt.CreatedAtString)
 		if err != nil {
 			fmt.Println(err)
@@ -151,103 +180,32 @@ func ListPosts() (PostCollection, error) {
 		posts = append(posts, p)
 	}
 
-	return posts, nil
+	return posts, rows.Err()
 }
 
-func ListTags() ([]string, error) {
-	var tags []string
-	var tagID string
-	var tag string
-
-	rows, err := database.DB.Query(`SELECT posts_tags.tag_id, tags.tag
-									FROM(SELECT DISTINCT posts_tags.tag_id FROM posts_tags) as posts_tags
-										LEFT JOIN tags ON posts_tags.tag_id=tags.tag_id
+// ListTags returns the tags posts use, with how many posts use each of them.
+func ListTags() ([]Tag, error) {
+	var tags []Tag
+	err := database.DB.Select(&tags, `SELECT tags.tag_id, tags.tag, COUNT(1) AS posts
+									FROM posts_tags
+										INNER JOIN posts ON posts.post_id=posts_tags.post_id
+										INNER JOIN tags ON tags.tag_id=posts_tags.tag_id
+									WHERE posts.deleted_at IS NULL
+									GROUP BY tags.tag_id, tags.tag
 									ORDER BY tags.tag`)
-	if err != nil {
-		return tags, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		if err := rows.Scan(&tagID, &tag); err != nil {
-			return tags, err
-		}
-
-		tags = append(tags, tag)
-	}
-
-	return tags, nil
-}
-
-func ListPostsFilter(mood []string, tags []string) (PostCollection, error) {
-	query, args, err := sqlx.In(`SELECT posts.post_id, posts.user_id, posts.post_title, posts.description, posts.protected, posts.created_at, posts.mood, users.preferred_name, comments_cnt, likes_cnt, tags
-								FROM(SELECT posts.post_id, posts.user_id, posts.post_title, posts.description, posts.protected, posts.created_at, posts.mood
-									FROM posts
-									WHERE mood IN (?)) AS posts
-									INNER JOIN(SELECT DISTINCT posts_tags.post_id
-											from posts_tags
-													INNER JOIN(SELECT tags.tag_id, tags.tag FROM tags WHERE tags.tag IN (?)) AS tags ON posts_tags.tag_id=tags.tag_id) AS selected_tags ON selected_tags.post_id=posts.post_id
-									LEFT JOIN users ON users.user_id=posts.user_id
-									LEFT JOIN(SELECT comments.post_id, COUNT(1) AS comments_cnt
-											FROM comments
-											GROUP BY comments.post_id) AS comments ON comments.post_id=posts.post_id
-									LEFT JOIN(SELECT post_id, COUNT(1) as likes_cnt
-											FROM posts_likes
-											GROUP BY posts_likes.post_id) as posts_likes ON posts.post_id=posts_likes.post_id
-									INNER JOIN(SELECT posts_tags.post_id, string_agg(tags.tag, ',') as tags
-											FROM posts_tags
-													LEFT JOIN tags ON posts_tags.tag_id=tags.tag_id
-											GROUP BY posts_tags.post_id) as posts_tags ON posts.post_id=posts_tags.post_id`, mood, tags)
-	if err != nil {
-		fmt.Println("Error executing query: ", err)
-		return nil, err
-	}
-	query = database.DB.Rebind(query)
-	rows, err := database.DB.Query(query, args...)
-	if err != nil {
-		fmt.Println("Error executing query: ", err)
-		return nil, err
-	}
-
-	defer rows.Close()
-
-	var posts PostCollection
-
-	for rows.Next() {
-		var p ZPost
-
-		if err := rows.Scan(&p.ID, &p.UserID, &p.Title, &p.Description, &p.Protected, &p.CreatedAt.CreatedAtString, &p.Mood, &p.PreferredName, &p.PostStats.CommentsCount, &p.PostStats.LikesCount, &p.Tags.TagsNullString); err != nil {
-			fmt.Println("Error scanning")
-			return nil, err
-		}
-
-		p.PostStats.CommentsCountString = NullIntToString(p.PostStats.CommentsCount)
-
-		p.PostStats.LikesCountString = NullIntToString(p.PostStats.LikesCount)
-
-		if p.Tags.TagsNullString.Valid {
-			p.Tags.Tags = strings.Split(p.Tags.TagsNullString.String, ",")
-		} else {
-			p.Tags.Tags = []string{}
-		}
 
-		p.CreatedAt.CreatedAtProcessed, err = ConvertDate(p.CreatedAt.CreatedAtString)
-		if err != nil {
-			fmt.Println(err)
-		}
-
-		posts = append(posts, p)
-	}
-
-	return posts, nil
+	return tags, err
 }
 
 func NewPost(p ZPost, tags []string) error {
 	t := time.Now().Format(time.RFC3339)
+	if p.Mood == "" {
+		p.Mood = moods.Default().Key
+	}
 
 	var postID string
-	err := database.DB.QueryRow(`INSERT INTO posts (post_id, post_title, user_id, created_at, mood) VALUES ($1, $2, $3, $4, $5) 
-						RETURNING post_id`, p.ID, p.Title, p.UserID, t, p.Mood).Scan(&postID)
+	err := database.DB.QueryRow(`INSERT INTO posts (post_id, post_title, description, user_id, created_at, mood) VALUES ($1, $2, $3, $4, $5, $6) 
+						RETURNING post_id`, p.ID, p.Title, p.Description, p.UserID, t, p.Mood).Scan(&postID)
 	if err != nil {
 		return err
 	}
@@ -258,14 +216,15 @@ func NewPost(p ZPost, tags []string) error {
 	}
 
 	// Insert individual tags into tags table
-	if _, err = InsertTags(tags); err != nil {
+	validTags, err := InsertTags(tags)
+	if err != nil {
 		// Print error instead of returning, duplicate value error is alright
 		fmt.Println(err)
 	}
 
-	for _, v := range tags {
+	for _, v := range validTags {
 		// Copy postID and tag_id where the tag == tag value, and insert it into posts_tags
-		_, err = database.DB.Exec(`INSERT INTO posts_tags (post_id, tag_id) SELECT $1, tag_id FROM tags WHERE tag=$2`, postID, v)
+		_, err = database.DB.Exec(`INSERT INTO posts_tags (post_id, tag_id) SELECT $1, tag_id FROM tags WHERE tag=$2`, postID, v.Tag)
 		if err != nil {
 			// this err needs to be returned because it's not normal
 			return err
@@ -317,7 +276,13 @@ func EditTags(postID string, tags []string) error {
 		return err
 	}
 
-	if err := DeleteUnwantedTags(tags, postsTags); err != nil {
+	// Compared by their cleaned up names, which synonyms have been resolved in
+	var wanted []string
+	for _, v := range validTags {
+		wanted = append(wanted, v.Tag)
+	}
+
+	if err := DeleteUnwantedTags(wanted, postsTags); err != nil {
 		fmt.Println(err)
 	}
 
@@ -353,6 +318,12 @@ func InsertTags(tags []string) ([]Tag, error) {
 		validTags = append(validTags, tag)
 	}
 
+	// A synonym is entered as the tag it stands for
+	validTags, err = resolveSynonyms(validTags)
+	if err != nil {
+		return validTags, err
+	}
+
 	fmt.Println("Valid tags: ", validTags)
 	fmt.Println("Number of valid tags: ", len(validTags))
 
@@ -463,20 +434,20 @@ func ValidateTags(tag string) (passed bool, err error) {
 
 func DeleteUnwantedTags(inputTags []string, postsTags []JunctionPostTag) error {
 	// Loop through postTags to find tags that are not in current user input, then mark those for deletion.
-	var tagsToDeleteID []int
+	var tagsToDelete []JunctionPostTag
 	var exists bool
 	for _, v := range postsTags {
 		if exists = contains(inputTags, v.Tag); !exists {
-			tagsToDeleteID = append(tagsToDeleteID, v.TagID)
+			tagsToDelete = append(tagsToDelete, v)
 		}
 	}
 
-	fmt.Println("Tags to Delete: ", tagsToDeleteID)
+	fmt.Println("Tags to Delete: ", tagsToDelete)
 
-	// Delete from posts_tags if tagsToDelete is not empty
-	if len(tagsToDeleteID) > 0 {
-		for _, v := range tagsToDeleteID {
-			_, err := database.DB.Exec(`DELETE FROM posts_tags WHERE tag_id=$1`, v)
+	// Delete from posts_tags if tagsToDelete is not empty, only for this post, other posts keep the tag
+	if len(tagsToDelete) > 0 {
+		for _, v := range tagsToDelete {
+			_, err := database.DB.Exec(`DELETE FROM posts_tags WHERE tag_id=$1 AND post_id=$2`, v.TagID, v.PostID)
 			if err != nil {
 				fmt.Println("Error in deleting")
 				return err
@@ -487,6 +458,23 @@ func DeleteUnwantedTags(inputTags []string, postsTags []JunctionPostTag) error {
 	return nil
 }
 
+// DeleteOrphanTags removes tags no post uses anymore, which editing tags and purging posts both leave behind, and
+// returns how many it removed. Tags someone follows or that have synonyms are kept, so those survive until the
+// tag is used again.
+func DeleteOrphanTags() (int64, error) {
+	res, err := database.DB.Exec(`DELETE FROM tags
+								WHERE NOT EXISTS (SELECT 1 FROM posts_tags WHERE posts_tags.tag_id=tags.tag_id)
+									AND NOT EXISTS (SELECT 1 FROM tags_follows WHERE tags_follows.tag_id=tags.tag_id)
+									AND NOT EXISTS (SELECT 1 FROM tag_synonyms WHERE tag_synonyms.tag_id=tags.tag_id)`)
+	if err != nil {
+		return 0, err
+	}
+
+	n, _ := res.RowsAffected()
+	fmt.Printf("Deleted orphaned tags: %d\n", n)
+	return n, nil
+}
+
 func contains(a []string, s string) bool {
 	for _, v := range a {
 		if v == s {
@@ -526,7 +514,7 @@ func VerifyPostID(title string) (bool, string) {
 		fmt.Println(err)
 	}
 
-	res, err := database.DB.Query("SELECT post_id FROM posts WHERE post_id=$1;", ID)
+	res, err := database.DB.Query("SELECT post_id FROM posts WHERE post_id=$1 AND deleted_at IS NULL;", ID)
 	if err != nil {
 		fmt.Println("Error executing query to verify post exists")
 		fmt.Println(err)
@@ -537,38 +525,50 @@ func VerifyPostID(title string) (bool, string) {
 	return res.Next(), ID
 }
 
+// PostIDTaken is VerifyPostID for new posts: a trashed post keeps its ID until it's purged, so it counts too.
+func PostIDTaken(title string) (bool, string) {
+	ID, err := TitleToID(title)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	var taken bool
+	if err := database.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM posts WHERE post_id=$1)", ID).Scan(&taken); err != nil {
+		fmt.Println("Error executing query to verify post exists")
+		fmt.Println(err)
+	}
+
+	return taken, ID
+}
+
+// ErrPostNotFound is returned for posts that don't exist or are in the trash.
+var ErrPostNotFound = errors.New("error: post not found")
+
 func GetPost(postID string, currentUser string) (ZPost, error) {
 	var p ZPost
-	row, err := database.DB.Query(`SELECT posts.post_id, posts.post_title, posts.user_id, posts.description, posts.protected, posts.created_at, posts.mood, posts_likes.score, STRING_AGG(posts_tags.tag, ',') AS tags
+	err := database.DB.QueryRow(`SELECT posts.post_id, posts.post_title, posts.user_id, posts.description, posts.protected, posts.created_at, posts.mood, STRING_AGG(posts_tags.tag, ',') AS tags
 									FROM posts
-										LEFT JOIN (SELECT * FROM posts_likes) AS posts_likes ON posts.post_id = posts_likes.post_id
-										AND posts_likes.user_id = $2
 										LEFT JOIN (SELECT posts_tags.post_id, tags.tag
 											FROM posts_tags
 											LEFT JOIN tags ON posts_tags.tag_id = tags.tag_id) AS posts_tags ON posts_tags.post_id = posts.post_id
-									WHERE posts.post_id = $1
-									GROUP BY posts.post_id, posts.post_title, posts.user_id, posts.description, posts.protected, posts.created_at, posts.mood, posts_likes.score;`, postID, currentUser)
+									WHERE posts.post_id = $1 AND posts.deleted_at IS NULL
+									GROUP BY posts.post_id, posts.post_title, posts.user_id, posts.description, posts.protected, posts.created_at, posts.mood;`, postID).Scan(&p.ID, &p.Title, &p.UserID, &p.Description, &p.Protected, &p.CreatedAt.CreatedAtString, &p.Mood, &p.Tags.TagsNullString)
+	if err == sql.ErrNoRows {
+		return p, ErrPostNotFound
+	}
 	if err != nil {
 		return p, err
 	}
-	defer row.Close()
-
-	for row.Next() {
-		if err := row.Scan(&p.ID, &p.Title, &p.UserID, &p.Description, &p.Protected, &p.CreatedAt.CreatedAtString, &p.Mood, &p.PostStats.CurrentUserLike, &p.Tags.TagsNullString); err != nil {
-			return p, err
-		}
 
-		if p.Tags.TagsNullString.Valid {
-			p.Tags.Tags = strings.Split(p.Tags.TagsNullString.String, ",")
-		} else {
-			p.Tags.Tags = []string{}
-		}
+	if p.Tags.TagsNullString.Valid {
+		p.Tags.Tags = strings.Split(p.Tags.TagsNullString.String, ",")
+	} else {
+		p.Tags.Tags = []string{}
+	}
 
-		if p.PostStats.CurrentUserLike.Valid {
-			p.PostStats.CurrentUserLikeString = strconv.FormatInt(p.PostStats.CurrentUserLike.Int64, 10)
-		} else {
-			p.PostStats.CurrentUserLikeString = "0"
-		}
+	p.PostStats.Reactions, p.PostStats.CurrentUserReaction, err = GetReactions(postID, currentUser)
+	if err != nil {
+		return p, err
 	}
 
 	p.CreatedAt.CreatedAtProcessed, err = ConvertDate(p.CreatedAt.CreatedAtString)
@@ -576,40 +576,57 @@ func GetPost(postID string, currentUser string) (ZPost, error) {
 		return p, err
 	}
 
-	return p, nil
-}
-
-func LikePost(postID string, currentUser string) (int, error) {
-	var score int
+	err = database.DB.QueryRow(`SELECT COUNT(1), COALESCE(BOOL_OR(user_id=$2), false) FROM bookmarks WHERE post_id=$1 AND comment_id IS NULL`, postID, currentUser).Scan(&p.PostStats.BookmarksCount, &p.PostStats.CurrentUserBookmark)
+	if err != nil {
+		return p, err
+	}
+	p.PostStats.BookmarksCountString = NullIntToString(p.PostStats.BookmarksCount)
 
-	var exists string
-	err := database.DB.QueryRow("SELECT score FROM posts_likes WHERE post_id=$1 AND user_id=$2", postID, currentUser).Scan(&exists)
+	p.PostStats.CurrentUserSubscribed, err = IsSubscribed(currentUser, postID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			if _, err = database.DB.Exec("INSERT INTO posts_likes (user_id, post_id, score) VALUES ($1, $2, 1)", currentUser, postID); err != nil {
-				return score, err
-			}
-			score = 1
-			return score, nil
-		} else {
-			return score, err
-		}
+		return p, err
 	}
 
-	_, err = database.DB.Exec("DELETE FROM posts_likes WHERE post_id=$1 AND user_id=$2", postID, currentUser)
+	attachments, err := uploads.ListByPost(postID)
 	if err != nil {
-		return score, err
+		return p, err
 	}
-	score = 0
+	p.Attachments = attachments[""]
 
-	return score, nil
+	return p, nil
 }
 
-func EditPostDescription(postID string, description string) error {
-	_, err := database.DB.Exec("UPDATE posts SET description=$1 WHERE post_id=$2", description, postID)
-	if err != nil {
+func EditPostDescription(postID string, description string, username string) error {
+	if err := checkOwner(postID, username); err != nil {
+		return err
+	}
+
+	return overwrite(postID, "", FieldDescription, description, username)
+}
+
+// EditPostTitle changes the displayed title only. The post_id slug generated from the original title stays, so links don't break.
+func EditPostTitle(postID string, title string, username string) error {
+	if err := checkOwner(postID, username); err != nil {
+		return err
+	}
+
+	return overwrite(postID, "", FieldTitle, title, username)
+}
+
+// checkOwner returns an error unless the post exists, isn't in the trash and belongs to username.
+func checkOwner(postID string, username string) error {
+	var u string
+	if err := database.DB.QueryRow("SELECT user_id FROM posts WHERE post_id=$1 AND deleted_at IS NULL", postID).Scan(&u); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("error: cannot find user_id with given postID")
+		}
 		return err
 	}
+
+	if u != username {
+		return errors.New("error: logged in user is not owner of post")
+	}
+
 	return nil
 }
 
@@ -628,44 +645,56 @@ func DeletePost(postID string, username string) error {
 		return errors.New("error: logged in user is not owner of post")
 	}
 
-	if _, err := database.DB.Exec("DELETE FROM posts WHERE post_id=$1", postID); err != nil {
+	// Soft delete only, the post stays in the owner's trash until PurgeTrash removes it.
+	t := time.Now().Format(time.RFC3339)
+	if _, err := database.DB.Exec("UPDATE posts SET deleted_at=$1, deleted_by=$2 WHERE post_id=$3 AND deleted_at IS NULL", t, username, postID); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func EditMood(postID string, mood string) error {
+// EditMood switches a post to mood and records the change in its mood arc. Picking the current mood again is a no-op.
+func EditMood(postID string, mood string, userID string) error {
 	if err := ValidateMood(mood); err != nil {
 		return err
 	}
+	if err := checkOwner(postID, userID); err != nil {
+		return err
+	}
 
-	_, err := database.DB.Exec("UPDATE posts SET mood=$1 WHERE post_id=$2", mood, postID)
+	tx, err := database.DB.Beginx()
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
-}
-
-func ValidateMood(mood string) error {
-	allowedMoods := [6]string{"Elated", "Happy", "Neutral", "Sad", "Upset", "Angry"}
-
-	res := false
-	for _, v := range allowedMoods {
-		v = strings.ToUpper(v)
+	var old string
+	if err := tx.QueryRow("SELECT mood FROM posts WHERE post_id=$1 AND deleted_at IS NULL FOR UPDATE", postID).Scan(&old); err != nil {
+		return err
+	}
+	if old == mood {
+		return nil
+	}
 
-		if strings.Contains(v, strings.ToUpper(mood)) {
-			res = true
-			break
-		}
+	if _, err := tx.Exec("UPDATE posts SET mood=$1 WHERE post_id=$2", mood, postID); err != nil {
+		return err
 	}
-	if !res {
-		err := errors.New("new mood is not in allowed list")
+
+	_, err = tx.Exec(`INSERT INTO mood_changes (post_id, from_mood, to_mood, user_id, created_at) VALUES ($1, $2, $3, $4, $5)`, postID, old, mood, userID, time.Now().Format(time.RFC3339))
+	if err != nil {
 		return err
 	}
 
+	return tx.Commit()
+}
+
+// ValidateMood checks mood is a key on the moods scale.
+func ValidateMood(mood string) error {
+	if !moods.Valid(mood) {
+		return errors.New("mood is not on the moods scale")
+	}
+
 	return nil
 }
 
@@ -0,0 +1,179 @@
+package posts
+
+import (
+	"errors"
+	"testing"
+
+	"gorant/database"
+	"gorant/database/dbtest"
+	"gorant/moods"
+)
+
+func TestEditPostOwner(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.AddUser(t, "owner")
+	dbtest.AddUser(t, "other")
+	dbtest.AddPost(t, "rant", "owner")
+
+	if err := EditPostDescription("rant", "not mine", "other"); err == nil {
+		t.Error("EditPostDescription by a non-owner succeeded")
+	}
+	if err := EditPostTitle("rant", "not mine", "other"); err == nil {
+		t.Error("EditPostTitle by a non-owner succeeded")
+	}
+	if err := EditPostDescription("rant", "mine", "owner"); err != nil {
+		t.Errorf("EditPostDescription by the owner: %v", err)
+	}
+}
+
+func TestTrashedPostIsGone(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.AddUser(t, "owner")
+	dbtest.AddPost(t, "rant", "owner")
+
+	if err := DeletePost("rant", "owner"); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, _ := VerifyPostID("rant"); exists {
+		t.Error("VerifyPostID found a trashed post")
+	}
+	if taken, _ := PostIDTaken("rant"); !taken {
+		t.Error("PostIDTaken is false for a trashed post's ID")
+	}
+	if _, err := React("rant", "owner", "happy"); err == nil {
+		t.Error("React to a trashed post succeeded")
+	}
+}
+
+func TestGetPostNotFound(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.AddUser(t, "owner")
+	dbtest.AddPost(t, "rant", "owner")
+
+	if p, err := GetPost("rant", "owner"); err != nil || p.ID != "rant" {
+		t.Fatalf("GetPost of a live post = %+v, %v", p, err)
+	}
+
+	if err := DeletePost("rant", "owner"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"rant", "missing"} {
+		if _, err := GetPost(id, "owner"); !errors.Is(err, ErrPostNotFound) {
+			t.Errorf("GetPost(%q) = %v, want ErrPostNotFound", id, err)
+		}
+	}
+}
+
+func TestValidateMood(t *testing.T) {
+	dbtest.Open(t)
+	if err := moods.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateMood("angry"); err != nil {
+		t.Errorf("ValidateMood(angry) = %v", err)
+	}
+	for _, mood := range []string{"", "a", "ang", "Angry"} {
+		if err := ValidateMood(mood); err == nil {
+			t.Errorf("ValidateMood(%q) accepted it", mood)
+		}
+	}
+}
+
+func TestNewPostDefaultMood(t *testing.T) {
+	dbtest.Open(t)
+	if err := moods.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	dbtest.AddUser(t, "owner")
+
+	if err := NewPost(ZPost{ID: "rant", Title: "rant", UserID: "owner"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var mood string
+	if err := database.DB.QueryRow("SELECT mood FROM posts WHERE post_id='rant'").Scan(&mood); err != nil {
+		t.Fatal(err)
+	}
+	if mood != moods.Default().Key {
+		t.Errorf("post without a mood got %q, want the default %q", mood, moods.Default().Key)
+	}
+}
+
+func TestListLatest(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.AddUser(t, "owner")
+	for _, id := range []string{"old", "new", "newest"} {
+		dbtest.AddPost(t, id, "owner")
+	}
+	for _, q := range []string{
+		"UPDATE posts SET created_at='2024-02-01T00:00:00Z' WHERE post_id='new'",
+		"UPDATE posts SET created_at='2024-03-01T00:00:00Z' WHERE post_id='newest'",
+		`INSERT INTO comments (user_id, content, created_at, post_id, deleted_at) VALUES
+			('owner', 'first', '2024-01-01T00:00:00Z', 'old', NULL),
+			('owner', 'second', '2024-01-02T00:00:00Z', 'old', NULL),
+			('owner', 'third', '2024-01-03T00:00:00Z', 'old', NULL),
+			('owner', 'deleted', '2024-01-04T00:00:00Z', 'old', '2024-01-05T00:00:00Z')`,
+	} {
+		if _, err := database.DB.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := ListLatestPosts(Filter{Author: "owner"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != "newest" || list[1].ID != "new" {
+		t.Errorf("ListLatestPosts returned %+v, want newest and new", list)
+	}
+
+	comments, err := ListLatestComments("old", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 || comments[0].Content != "third" || comments[1].Content != "second" {
+		t.Errorf("ListLatestComments returned %+v, want third and second", comments)
+	}
+}
+
+func TestEditMoodOwner(t *testing.T) {
+	dbtest.Open(t)
+	if err := moods.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	dbtest.AddUser(t, "owner")
+	dbtest.AddUser(t, "other")
+	dbtest.AddPost(t, "rant", "owner")
+
+	changes := func() int {
+		t.Helper()
+		var n int
+		if err := database.DB.Get(&n, "SELECT COUNT(1) FROM mood_changes WHERE post_id='rant'"); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if err := EditMood("rant", "angry", "other"); err == nil {
+		t.Error("EditMood by a non-owner succeeded")
+	}
+	if n := changes(); n != 0 {
+		t.Errorf("a non-owner's mood change left %d timeline rows", n)
+	}
+
+	if err := EditMood("rant", "angry", "owner"); err != nil {
+		t.Fatalf("EditMood by the owner: %v", err)
+	}
+	if n := changes(); n != 1 {
+		t.Errorf("the owner's mood change left %d timeline rows, want 1", n)
+	}
+
+	if err := DeletePost("rant", "owner"); err != nil {
+		t.Fatal(err)
+	}
+	if err := EditMood("rant", "happy", "owner"); err == nil {
+		t.Error("EditMood of a trashed post succeeded")
+	}
+}
@@ -0,0 +1,164 @@
+package posts
+
+import (
+	"strconv"
+
+	"gorant/database"
+	"gorant/moods"
+)
+
+// ProfilePageSize is how many posts or comments a page of a profile shows.
+const ProfilePageSize = 20
+
+type MoodCount struct {
+	Mood    moods.Mood
+	Count   int
+	Percent int
+}
+
+// UserStats sums up a user's activity for their profile page. Trashed posts and comments aren't counted.
+type UserStats struct {
+	Posts             int `db:"posts"`
+	Comments          int `db:"comments"`
+	ReactionsReceived int `db:"reactions_received"`
+	UpvotesReceived   int `db:"upvotes_received"`
+	Moods             []MoodCount
+}
+
+type UserComment struct {
+	CommentID          string `db:"comment_id"`
+	PostID             string `db:"post_id"`
+	PostTitle          string `db:"post_title"`
+	Content            string `db:"content"`
+	CreatedAt          string `db:"created_at"`
+	Upvotes            int    `db:"upvotes"`
+	CreatedAtProcessed string
+}
+
+func GetUserStats(userID string) (UserStats, error) {
+	var s UserStats
+
+	err := database.DB.Get(&s, `SELECT
+									(SELECT COUNT(1) FROM posts WHERE user_id=$1 AND deleted_at IS NULL) AS posts,
+									(SELECT COUNT(1) FROM comments WHERE user_id=$1 AND deleted_at IS NULL) AS comments,
+									(SELECT COUNT(1) FROM posts_reactions
+										INNER JOIN posts ON posts.post_id=posts_reactions.post_id
+									WHERE posts.user_id=$1 AND posts.deleted_at IS NULL) AS reactions_received,
+									(SELECT COUNT(1) FROM comments_votes
+										INNER JOIN comments ON comments.comment_id=comments_votes.comment_id
+									WHERE comments.user_id=$1 AND comments.deleted_at IS NULL) AS upvotes_received`, userID)
+	if err != nil {
+		return s, err
+	}
+
+	rows, err := database.DB.Query(`SELECT mood, COUNT(1) FROM posts WHERE user_id=$1 AND deleted_at IS NULL GROUP BY mood`, userID)
+	if err != nil {
+		return s, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var mood string
+		var n int
+		if err := rows.Scan(&mood, &n); err != nil {
+			return s, err
+		}
+		counts[mood] += n
+	}
+	if err := rows.Err(); err != nil {
+		return s, err
+	}
+
+	// From best to worst, like the mood bar
+	scale := moods.All()
+	for i := len(scale) - 1; i >= 0; i-- {
+		mc := MoodCount{Mood: scale[i], Count: counts[scale[i].Key]}
+		if s.Posts > 0 {
+			mc.Percent = mc.Count * 100 / s.Posts
+		}
+		s.Moods = append(s.Moods, mc)
+	}
+
+	return s, nil
+}
+
+// ListPostsByUser returns one page (from 1) of a user's posts, newest first, and whether there's another page after it.
+func ListPostsByUser(userID string, viewer string, page int) (PostCollection, bool, error) {
+	rows, err := database.DB.Query(`SELECT posts.post_id, posts.user_id, posts.post_title, posts.description, posts.protected, posts.created_at, posts.mood, users.preferred_name, comments_cnt, reactions_cnt, reactions, bookmarks_cnt, tags,
+										EXISTS (SELECT 1 FROM user_relations WHERE user_relations.user_id=$4 AND user_relations.target_id=posts.user_id) AS muted
+									FROM posts
+										LEFT JOIN users ON users.user_id=posts.user_id
+										LEFT JOIN(SELECT comments.post_id, COUNT(1) AS comments_cnt
+												FROM comments
+												WHERE comments.deleted_at IS NULL
+												GROUP BY comments.post_id) AS comments ON comments.post_id=posts.post_id
+										LEFT JOIN(SELECT post_id, SUM(n)::INT AS reactions_cnt, string_agg(reaction || ':' || n, ',' ORDER BY n DESC, reaction) AS reactions
+												FROM(SELECT post_id, reaction, COUNT(1) AS n FROM posts_reactions GROUP BY post_id, reaction) AS reaction_counts
+												GROUP BY reaction_counts.post_id) AS posts_reactions ON posts.post_id=posts_reactions.post_id
+										LEFT JOIN(SELECT post_id, COUNT(1) AS bookmarks_cnt
+												FROM bookmarks
+												WHERE comment_id IS NULL
+												GROUP BY bookmarks.post_id) AS bookmarks ON posts.post_id=bookmarks.post_id
+										LEFT JOIN(SELECT posts_tags.post_id, string_agg(tags.tag, ',') as tags
+												FROM posts_tags
+														LEFT JOIN tags ON posts_tags.tag_id=tags.tag_id
+												GROUP BY posts_tags.post_id) as posts_tags ON posts.post_id=posts_tags.post_id
+									WHERE posts.user_id=$1 AND posts.deleted_at IS NULL
+									ORDER BY posts.created_at::TIMESTAMPTZ DESC
+									LIMIT $2 OFFSET $3`, userID, ProfilePageSize+1, offset(page, ProfilePageSize), viewer)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPosts(rows)
+	if len(posts) > ProfilePageSize {
+		return posts[:ProfilePageSize], true, err
+	}
+
+	return posts, false, err
+}
+
+// ListCommentsByUser returns one page of a user's comments on posts that aren't in the trash, newest first.
+func ListCommentsByUser(userID string, page int) ([]UserComment, bool, error) {
+	var comments []UserComment
+
+	err := database.DB.Select(&comments, `SELECT comments.comment_id, comments.post_id, posts.post_title, comments.content, comments.created_at, COALESCE(votes.cnt, 0) AS upvotes
+										FROM comments
+											INNER JOIN posts ON posts.post_id=comments.post_id
+											LEFT JOIN(SELECT comment_id, COUNT(1) AS cnt
+													FROM comments_votes
+													GROUP BY comment_id) AS votes ON votes.comment_id=comments.comment_id
+										WHERE comments.user_id=$1 AND comments.deleted_at IS NULL AND posts.deleted_at IS NULL
+										ORDER BY comments.created_at::TIMESTAMPTZ DESC
+										LIMIT $2 OFFSET $3`, userID, ProfilePageSize+1, offset(page, ProfilePageSize))
+	if err != nil {
+		return comments, false, err
+	}
+
+	for i := range comments {
+		comments[i].CreatedAtProcessed, _ = ConvertDate(comments[i].CreatedAt)
+	}
+
+	if len(comments) > ProfilePageSize {
+		return comments[:ProfilePageSize], true, nil
+	}
+
+	return comments, false, nil
+}
+
+// ParsePage reads a ?page= value, anything missing or invalid is the first page.
+func ParsePage(s string) int {
+	page, err := strconv.Atoi(s)
+	if err != nil || page < 1 {
+		return 1
+	}
+
+	return page
+}
+
+// offset is where page (from 1) starts, for pages of size rows.
+func offset(page int, size int) int {
+	return (max(page, 1) - 1) * size
+}
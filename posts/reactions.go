@@ -0,0 +1,112 @@
+package posts
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"gorant/database"
+	"gorant/notifications"
+)
+
+// ReactionCount is how many readers reacted to a post with Mood.
+type ReactionCount struct {
+	Mood  string
+	Count int
+}
+
+// React sets userID's reaction to a post. Reacting with the same mood again takes the reaction back. It returns
+// the reaction the user has now, empty if they took it back. The author is only notified of a first reaction.
+func React(postID string, userID string, reaction string) (string, error) {
+	var live bool
+	if err := database.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM posts WHERE post_id=$1 AND deleted_at IS NULL)", postID).Scan(&live); err != nil {
+		return "", err
+	}
+	if !live {
+		return "", ErrPostNotFound
+	}
+
+	res, err := database.DB.Exec("DELETE FROM posts_reactions WHERE post_id=$1 AND user_id=$2 AND reaction=$3", postID, userID, reaction)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return "", nil
+	}
+
+	// xmax is only 0 for a row that was just inserted, not for one the conflict updated
+	var inserted bool
+	err = database.DB.QueryRow(`INSERT INTO posts_reactions (user_id, post_id, reaction, created_at) VALUES ($1, $2, $3, $4)
+								ON CONFLICT (post_id, user_id) DO UPDATE SET reaction=EXCLUDED.reaction, created_at=EXCLUDED.created_at
+								RETURNING xmax = 0`, userID, postID, reaction, time.Now().Format(time.RFC3339)).Scan(&inserted)
+	if err != nil {
+		return "", err
+	}
+
+	if inserted {
+		notify(notifications.TypeReaction, userID, postID, "")
+	}
+
+	return reaction, nil
+}
+
+// GetReactions counts a post's reactions per mood, most used first, and returns viewer's own reaction.
+func GetReactions(postID string, viewer string) ([]ReactionCount, string, error) {
+	var counts []ReactionCount
+	var own string
+
+	rows, err := database.DB.Query(`SELECT reaction, COUNT(1), BOOL_OR(user_id=$2)
+									FROM posts_reactions
+									WHERE post_id=$1
+									GROUP BY reaction
+									ORDER BY COUNT(1) DESC, reaction`, postID, viewer)
+	if err != nil {
+		return counts, own, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c ReactionCount
+		var mine bool
+		if err := rows.Scan(&c.Mood, &c.Count, &mine); err != nil {
+			return counts, own, err
+		}
+		if mine {
+			own = c.Mood
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, own, rows.Err()
+}
+
+// TopReactions returns the n most used reactions.
+func (s ZPostStats) TopReactions(n int) []ReactionCount {
+	if len(s.Reactions) > n {
+		return s.Reactions[:n]
+	}
+
+	return s.Reactions
+}
+
+// parseReactionCounts reads the "mood:count,mood:count" lists the post list queries aggregate reactions into.
+func parseReactionCounts(s string) []ReactionCount {
+	var counts []ReactionCount
+	if s == "" {
+		return counts
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		mood, n, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		count, err := strconv.Atoi(n)
+		if err != nil {
+			continue
+		}
+		counts = append(counts, ReactionCount{Mood: mood, Count: count})
+	}
+
+	return counts
+}
@@ -0,0 +1,26 @@
+package posts
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseReactionCounts(t *testing.T) {
+	got := parseReactionCounts("angry:4,happy:2,sad:1")
+	want := []ReactionCount{{"angry", 4}, {"happy", 2}, {"sad", 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseReactionCounts() = %v, want %v", got, want)
+	}
+
+	if got := parseReactionCounts(""); len(got) != 0 {
+		t.Errorf("parseReactionCounts(\"\") = %v, want none", got)
+	}
+
+	stats := ZPostStats{Reactions: got}
+	if top := stats.TopReactions(5); len(top) != 3 || top[0].Mood != "angry" {
+		t.Errorf("TopReactions(5) = %v", top)
+	}
+	if top := stats.TopReactions(2); len(top) != 2 || top[1].Mood != "happy" {
+		t.Errorf("TopReactions(2) = %v", top)
+	}
+}
@@ -0,0 +1,265 @@
+package posts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorant/database"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Fields that keep a revision history
+const (
+	FieldTitle       = "title"
+	FieldDescription = "description"
+	FieldComment     = "comment"
+)
+
+// Revision is one version of a title, description or comment.
+// The revisions table stores the value that was overwritten, so the newest version is read from posts/comments instead.
+type Revision struct {
+	RevisionID         string // Empty for the current version, which lives in posts/comments
+	Content            string
+	UserID             sql.NullString // Who wrote this version
+	PreferredName      sql.NullString
+	CreatedAt          string
+	CreatedAtProcessed string
+	Current            bool
+	Diff               []DiffLine // Against the previous version, empty for the first version
+}
+
+type History struct {
+	Field     string
+	CommentID string
+	Versions  []Revision // Newest first
+}
+
+// overwrite saves the current value of field into revisions, then replaces it with content.
+// Nothing is written if the content is unchanged.
+func overwrite(postID string, commentID string, field string, content string, userID string) error {
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var old string
+	switch field {
+	case FieldTitle:
+		err = tx.QueryRow("SELECT post_title FROM posts WHERE post_id=$1 FOR UPDATE", postID).Scan(&old)
+	case FieldDescription:
+		err = tx.QueryRow("SELECT description FROM posts WHERE post_id=$1 FOR UPDATE", postID).Scan(&old)
+	case FieldComment:
+		err = tx.QueryRow("SELECT content FROM comments WHERE comment_id=$1 AND post_id=$2 AND deleted_at IS NULL FOR UPDATE", commentID, postID).Scan(&old)
+	default:
+		return errors.New("unknown revision field")
+	}
+	if err != nil {
+		return err
+	}
+
+	if old == content {
+		return nil
+	}
+
+	var cID sql.NullString
+	if commentID != "" {
+		cID = sql.NullString{String: commentID, Valid: true}
+	}
+
+	t := time.Now().Format(time.RFC3339)
+
+	if _, err := tx.Exec(`INSERT INTO revisions (post_id, comment_id, field, content, user_id, created_at) VALUES ($1, $2, $3, $4, $5, $6)`, postID, cID, field, old, userID, t); err != nil {
+		return err
+	}
+
+	switch field {
+	case FieldTitle:
+		_, err = tx.Exec("UPDATE posts SET post_title=$1 WHERE post_id=$2", content, postID)
+	case FieldDescription:
+		_, err = tx.Exec("UPDATE posts SET description=$1 WHERE post_id=$2", content, postID)
+	case FieldComment:
+		_, err = tx.Exec("UPDATE comments SET content=$1, edited_at=$2 WHERE comment_id=$3", content, t, commentID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func GetHistory(postID string) ([]History, error) {
+	var histories []History
+
+	var p ZPost
+	var author sql.NullString
+	err := database.DB.QueryRow(`SELECT posts.post_title, posts.description, posts.created_at, posts.user_id, users.preferred_name
+								FROM posts
+									LEFT JOIN users ON users.user_id = posts.user_id
+								WHERE posts.post_id = $1`, postID).Scan(&p.Title, &p.Description, &p.CreatedAt.CreatedAtString, &p.UserID, &author)
+	if err != nil {
+		return histories, err
+	}
+
+	rows, err := database.DB.Query(`SELECT revisions.revision_id, COALESCE(revisions.comment_id::TEXT, ''), revisions.field, revisions.content, revisions.user_id, users.preferred_name, revisions.created_at
+									FROM revisions
+										LEFT JOIN users ON users.user_id = revisions.user_id
+										LEFT JOIN comments ON comments.comment_id = revisions.comment_id
+									WHERE revisions.post_id = $1 AND comments.deleted_at IS NULL
+									ORDER BY revisions.revision_id`, postID)
+	if err != nil {
+		return histories, err
+	}
+	defer rows.Close()
+
+	// Keyed by field, plus the comment ID for comments
+	index := make(map[string]int)
+	var stored [][]Revision
+
+	for rows.Next() {
+		var r Revision
+		var field string
+		var commentID string
+
+		if err := rows.Scan(&r.RevisionID, &commentID, &field, &r.Content, &r.UserID, &r.PreferredName, &r.CreatedAt); err != nil {
+			return histories, err
+		}
+
+		key := field + ";" + commentID
+		i, ok := index[key]
+		if !ok {
+			i = len(histories)
+			index[key] = i
+			histories = append(histories, History{Field: field, CommentID: commentID})
+			stored = append(stored, nil)
+		}
+		stored[i] = append(stored[i], r)
+	}
+	if err := rows.Err(); err != nil {
+		return histories, err
+	}
+	rows.Close()
+
+	for i := range histories {
+		var current Revision
+		current.Current = true
+
+		// The original version is attributed to the author at creation time
+		var createdAt string
+		var owner sql.NullString
+		var ownerName sql.NullString
+
+		switch histories[i].Field {
+		case FieldTitle:
+			current.Content = p.Title
+			createdAt, owner, ownerName = p.CreatedAt.CreatedAtString, sql.NullString{String: p.UserID, Valid: true}, author
+		case FieldDescription:
+			current.Content = p.Description
+			createdAt, owner, ownerName = p.CreatedAt.CreatedAtString, sql.NullString{String: p.UserID, Valid: true}, author
+		case FieldComment:
+			err := database.DB.QueryRow(`SELECT comments.content, comments.created_at, comments.user_id, users.preferred_name
+										FROM comments
+											LEFT JOIN users ON users.user_id = comments.user_id
+										WHERE comments.comment_id = $1`, histories[i].CommentID).Scan(&current.Content, &createdAt, &owner, &ownerName)
+			if err != nil {
+				return histories, err
+			}
+		}
+
+		versions := append(stored[i], current)
+
+		// Each revision row is stamped with the time (and editor) of the edit that replaced it,
+		// so shift those down by one to get the time each version was written.
+		written := make([]Revision, len(versions))
+		for v := range versions {
+			written[v] = versions[v]
+			if v == 0 {
+				written[v].CreatedAt, written[v].UserID, written[v].PreferredName = createdAt, owner, ownerName
+			} else {
+				written[v].CreatedAt, written[v].UserID, written[v].PreferredName = versions[v-1].CreatedAt, versions[v-1].UserID, versions[v-1].PreferredName
+				written[v].Diff = DiffLines(versions[v-1].Content, versions[v].Content)
+			}
+
+			written[v].CreatedAtProcessed, err = ConvertDate(written[v].CreatedAt)
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+
+		// Newest first for display
+		for l, r := 0, len(written)-1; l < r; l, r = l+1, r-1 {
+			written[l], written[r] = written[r], written[l]
+		}
+		histories[i].Versions = written
+	}
+
+	return histories, nil
+}
+
+// RestoreRevision makes an older version current again. The version being replaced is itself kept as a revision,
+// so a restore can be undone. Only the author of the post/comment or a moderator may restore.
+func RestoreRevision(postID string, revisionID string, username string, moderator bool) error {
+	var field string
+	var commentID string
+	var content string
+
+	err := database.DB.QueryRow(`SELECT field, COALESCE(comment_id::TEXT, ''), content FROM revisions WHERE revision_id=$1 AND post_id=$2`, revisionID, postID).Scan(&field, &commentID, &content)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("error: cannot find revision for given postID")
+		}
+		return err
+	}
+
+	var owner sql.NullString
+	if field == FieldComment {
+		err = database.DB.QueryRow("SELECT user_id FROM comments WHERE comment_id=$1", commentID).Scan(&owner)
+	} else {
+		err = database.DB.QueryRow("SELECT user_id FROM posts WHERE post_id=$1", postID).Scan(&owner)
+	}
+	if err != nil {
+		return err
+	}
+
+	if owner.String != username && !moderator {
+		return errors.New("error: logged in user is not owner or moderator")
+	}
+
+	return overwrite(postID, commentID, field, content, username)
+}
+
+// LastEdited returns when each of the posts' title or description was last changed, for posts edited at all.
+func LastEdited(postIDs []string) (map[string]time.Time, error) {
+	edited := make(map[string]time.Time)
+	if len(postIDs) == 0 {
+		return edited, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT post_id, MAX(created_at::TIMESTAMPTZ)
+								FROM revisions
+								WHERE post_id IN (?) AND comment_id IS NULL
+								GROUP BY post_id`, postIDs)
+	if err != nil {
+		return edited, err
+	}
+
+	rows, err := database.DB.Query(database.DB.Rebind(query), args...)
+	if err != nil {
+		return edited, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID string
+		var t time.Time
+		if err := rows.Scan(&postID, &t); err != nil {
+			return edited, err
+		}
+		edited[postID] = t
+	}
+
+	return edited, rows.Err()
+}
@@ -0,0 +1,87 @@
+package posts
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gorant/database"
+	"gorant/jobs"
+	"gorant/notifications"
+)
+
+// JobNotifySubscribers fans a new comment out to the post's subscribers, the handler is registered in main
+const JobNotifySubscribers = "posts.notify_subscribers"
+
+type SubscribersJob struct {
+	PostID    string `json:"post_id"`
+	CommentID string `json:"comment_id"`
+	ActorID   string `json:"actor_id"`
+}
+
+// ToggleSubscription subscribes userID to a post's discussion, or unsubscribes them, and returns whether they're now subscribed.
+func ToggleSubscription(userID string, postID string) (bool, error) {
+	var subscribed bool
+	err := database.DB.QueryRow(`INSERT INTO posts_subscriptions (user_id, post_id, subscribed, created_at) VALUES ($1, $2, true, $3)
+								ON CONFLICT (user_id, post_id) DO UPDATE SET subscribed = NOT posts_subscriptions.subscribed
+								RETURNING subscribed`, userID, postID, time.Now().Format(time.RFC3339)).Scan(&subscribed)
+
+	return subscribed, err
+}
+
+func IsSubscribed(userID string, postID string) (bool, error) {
+	var subscribed bool
+	err := database.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM posts_subscriptions WHERE user_id=$1 AND post_id=$2 AND subscribed)`, userID, postID).Scan(&subscribed)
+
+	return subscribed, err
+}
+
+// subscribeCommenter subscribes a commenter who has auto-subscribe on. Someone who unsubscribed from the post before stays unsubscribed.
+func subscribeCommenter(userID string, postID string) {
+	_, err := database.DB.Exec(`INSERT INTO posts_subscriptions (user_id, post_id, subscribed, created_at)
+								SELECT user_id, $2, true, $3 FROM users WHERE user_id=$1 AND auto_subscribe=1
+								ON CONFLICT (user_id, post_id) DO NOTHING`, userID, postID, time.Now().Format(time.RFC3339))
+	if err != nil {
+		fmt.Println("Error subscribing commenter: ", err)
+	}
+}
+
+// NotifySubscribers sends a thread notification about a new comment to everyone subscribed to the post. The post's
+// author already gets a reply notification and anyone mentioned in the comment a mention, so they're left out,
+// as are subscribers who muted or blocked the commenter.
+func NotifySubscribers(postID string, commentID string, actorID string) error {
+	var subscribers []string
+	err := database.DB.Select(&subscribers, `SELECT posts_subscriptions.user_id
+											FROM posts_subscriptions
+												INNER JOIN posts ON posts.post_id=posts_subscriptions.post_id
+											WHERE posts_subscriptions.post_id=$1 AND posts_subscriptions.subscribed
+												AND posts_subscriptions.user_id <> $3 AND posts_subscriptions.user_id <> posts.user_id
+												AND NOT EXISTS (SELECT 1 FROM mentions WHERE mentions.comment_id=$2::INT AND mentions.user_id=posts_subscriptions.user_id)
+												AND NOT EXISTS (SELECT 1 FROM user_relations WHERE user_relations.user_id=posts_subscriptions.user_id AND user_relations.target_id=$3)`, postID, commentID, actorID)
+	if err != nil {
+		return err
+	}
+
+	// Errors for one subscriber are only logged, retrying the job would bump everyone else's count twice
+	for _, s := range subscribers {
+		n := notifications.Notification{
+			UserID:    s,
+			ActorID:   sql.NullString{String: actorID, Valid: true},
+			Type:      notifications.TypeThread,
+			PostID:    sql.NullString{String: postID, Valid: true},
+			CommentID: sql.NullString{String: commentID, Valid: true},
+		}
+		if err := notifications.Notify(n); err != nil {
+			fmt.Println("Error notifying subscriber: ", err)
+		}
+	}
+
+	return nil
+}
+
+// queueSubscribers hands the fan-out for a new comment to the job queue, so a big thread doesn't slow down posting.
+func queueSubscribers(postID string, commentID string, actorID string) {
+	if err := jobs.Enqueue(JobNotifySubscribers, SubscribersJob{PostID: postID, CommentID: commentID, ActorID: actorID}); err != nil {
+		fmt.Println("Error queueing subscriber notifications: ", err)
+	}
+}
@@ -0,0 +1,85 @@
+package posts
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gorant/database"
+	"gorant/database/dbtest"
+	"gorant/notifications"
+	"gorant/users"
+)
+
+func TestNotifySubscribers(t *testing.T) {
+	dbtest.Open(t)
+	for _, u := range []string{"owner", "actor", "fan", "muter", "blocker", "mentioned", "quitter"} {
+		dbtest.AddUser(t, u)
+	}
+	dbtest.AddPost(t, "rant", "owner")
+
+	for _, u := range []string{"owner", "fan", "muter", "blocker", "mentioned", "quitter"} {
+		if _, err := ToggleSubscription(u, "rant"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ToggleSubscription("quitter", "rant"); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetRelation("muter", "actor", users.RelationMute); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetRelation("blocker", "actor", users.RelationBlock); err != nil {
+		t.Fatal(err)
+	}
+
+	commentID, err := Insert(Comment{UserID: "actor", Content: "what do you think, @mentioned?", CreatedAt: time.Now().Format(time.RFC3339), PostID: "rant"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NotifySubscribers("rant", commentID, "actor"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The owner gets a reply, the mentioned user a mention and the actor nothing, even though commenting subscribed them
+	var notified []string
+	if err := database.DB.Select(&notified, "SELECT user_id FROM notifications WHERE type=$1 ORDER BY user_id", notifications.TypeThread); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(notified, []string{"fan"}) {
+		t.Errorf("NotifySubscribers notified %v, want only fan", notified)
+	}
+}
+
+func TestSubscribeCommenter(t *testing.T) {
+	dbtest.Open(t)
+	for _, u := range []string{"owner", "auto", "manual", "quitter"} {
+		dbtest.AddUser(t, u)
+	}
+	dbtest.AddPost(t, "rant", "owner")
+
+	if _, err := database.DB.Exec("UPDATE users SET auto_subscribe=0 WHERE user_id='manual'"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := ToggleSubscription("quitter", "rant"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		userID     string
+		subscribed bool
+	}{
+		{"auto", true},
+		{"manual", false},
+		{"quitter", false}, // Unsubscribing sticks
+	}
+
+	for _, tt := range tests {
+		subscribeCommenter(tt.userID, "rant")
+		if subscribed, err := IsSubscribed(tt.userID, "rant"); err != nil || subscribed != tt.subscribed {
+			t.Errorf("IsSubscribed(%s) after commenting = %v, %v, want %v", tt.userID, subscribed, err, tt.subscribed)
+		}
+	}
+}
@@ -0,0 +1,521 @@
+package posts
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorant/database"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrTagNotFound     = errors.New("tag not found")
+	ErrTagExists       = errors.New("a tag with that name already exists, merge the two instead")
+	ErrTagIsSynonym    = errors.New("that name is already a synonym")
+	ErrSameTag         = errors.New("a tag can't be merged into itself")
+	ErrSynonymNotFound = errors.New("synonym not found")
+	ErrTagInvalid      = errors.New("tags need 1 to 30 letters, numbers or dashes")
+
+	ErrTagDescriptionTooLong = errors.New("tag descriptions can be 500 characters at most")
+)
+
+type TagSynonym struct {
+	Synonym string `db:"synonym"`
+	Tag     string `db:"tag"`
+}
+
+// slugTag cleans up a tag name the way InsertTags does.
+func slugTag(name string) (string, error) {
+	tag, err := TitleToID(name)
+	if err != nil {
+		return "", err
+	}
+	if tag == "" || len(tag) > 30 {
+		return "", ErrTagInvalid
+	}
+
+	return tag, nil
+}
+
+// ListAllTags returns every tag with how many posts use it, unused ones included, for the admin page.
+func ListAllTags() ([]Tag, error) {
+	var tags []Tag
+	err := database.DB.Select(&tags, `SELECT tags.tag_id, tags.tag, COUNT(posts.post_id) AS posts
+									FROM tags
+										LEFT JOIN posts_tags ON posts_tags.tag_id=tags.tag_id
+										LEFT JOIN posts ON posts.post_id=posts_tags.post_id AND posts.deleted_at IS NULL
+									GROUP BY tags.tag_id, tags.tag
+									ORDER BY tags.tag`)
+
+	return tags, err
+}
+
+func ListSynonyms() ([]TagSynonym, error) {
+	var synonyms []TagSynonym
+	err := database.DB.Select(&synonyms, `SELECT tag_synonyms.synonym, tags.tag
+										FROM tag_synonyms
+											INNER JOIN tags ON tags.tag_id=tag_synonyms.tag_id
+										ORDER BY tags.tag, tag_synonyms.synonym`)
+
+	return synonyms, err
+}
+
+// resolveSynonyms swaps synonyms for the tags they stand for, and drops the duplicates that leaves.
+func resolveSynonyms(tags []Tag) ([]Tag, error) {
+	if len(tags) == 0 {
+		return tags, nil
+	}
+
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.Tag
+	}
+
+	query, args, err := sqlx.In(`SELECT tag_synonyms.synonym, tags.tag
+								FROM tag_synonyms
+									INNER JOIN tags ON tags.tag_id=tag_synonyms.tag_id
+								WHERE tag_synonyms.synonym IN (?)`, names)
+	if err != nil {
+		return tags, err
+	}
+
+	var synonyms []TagSynonym
+	if err := database.DB.Select(&synonyms, database.DB.Rebind(query), args...); err != nil {
+		return tags, err
+	}
+
+	resolved := make(map[string]string)
+	for _, s := range synonyms {
+		resolved[s.Synonym] = s.Tag
+	}
+
+	var list []Tag
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		if r, ok := resolved[t.Tag]; ok {
+			t.Tag = r
+		}
+		if !seen[t.Tag] {
+			seen[t.Tag] = true
+			list = append(list, t)
+		}
+	}
+
+	return list, nil
+}
+
+// tagID looks a tag up by name within tx, returning ErrTagNotFound if there's no such tag.
+func tagID(tx *sqlx.Tx, tag string) (int, error) {
+	var id int
+	err := tx.QueryRow("SELECT tag_id FROM tags WHERE tag=$1", tag).Scan(&id)
+	if err == sql.ErrNoRows {
+		return id, ErrTagNotFound
+	}
+
+	return id, err
+}
+
+// checkTagNameFree returns an error if name is already taken by a tag or a synonym.
+func checkTagNameFree(tx *sqlx.Tx, name string) error {
+	var tag, synonym bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM tags WHERE tag=$1), EXISTS (SELECT 1 FROM tag_synonyms WHERE synonym=$1)`, name).Scan(&tag, &synonym)
+	switch {
+	case err != nil:
+		return err
+	case tag:
+		return ErrTagExists
+	case synonym:
+		return ErrTagIsSynonym
+	}
+
+	return nil
+}
+
+// RenameTag renames a tag everywhere it's used. Renaming to the name of another tag fails, MergeTags does that.
+func RenameTag(from string, to string) error {
+	from, err := slugTag(from)
+	if err != nil {
+		return err
+	}
+	to, err = slugTag(to)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id, err := tagID(tx, from)
+	if err != nil {
+		return err
+	}
+	if err := checkTagNameFree(tx, to); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE tags SET tag=$1 WHERE tag_id=$2", to, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MergeTags moves the posts, followers and synonyms of tag from over to tag into and deletes from. The old
+// name becomes a synonym of into, so entering it keeps working.
+func MergeTags(from string, into string) error {
+	from, err := slugTag(from)
+	if err != nil {
+		return err
+	}
+	into, err = slugTag(into)
+	if err != nil {
+		return err
+	}
+	if from == into {
+		return ErrSameTag
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	fromID, err := tagID(tx, from)
+	if err != nil {
+		return err
+	}
+	intoID, err := tagID(tx, into)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO posts_tags (post_id, tag_id)
+						SELECT post_id, $2 FROM posts_tags
+						WHERE tag_id=$1 AND post_id NOT IN (SELECT post_id FROM posts_tags WHERE tag_id=$2)`, fromID, intoID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO tags_follows (user_id, tag_id, created_at)
+						SELECT user_id, $2, created_at FROM tags_follows WHERE tag_id=$1
+						ON CONFLICT (user_id, tag_id) DO NOTHING`, fromID, intoID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE tag_synonyms SET tag_id=$2 WHERE tag_id=$1", fromID, intoID); err != nil {
+		return err
+	}
+
+	// Deleting the tag cascades to the posts_tags and tags_follows rows that were copied over above
+	if _, err := tx.Exec("DELETE FROM tags WHERE tag_id=$1", fromID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO tag_synonyms (synonym, tag_id, created_at) VALUES ($1, $2, $3)", from, intoID, time.Now().Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddSynonym makes synonym stand for tag when tags are entered. A name that's already a tag can't be a
+// synonym, merge the two tags instead.
+func AddSynonym(synonym string, tag string) error {
+	synonym, err := slugTag(synonym)
+	if err != nil {
+		return err
+	}
+	tag, err = slugTag(tag)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id, err := tagID(tx, tag)
+	if err != nil {
+		return err
+	}
+	if err := checkTagNameFree(tx, synonym); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("INSERT INTO tag_synonyms (synonym, tag_id, created_at) VALUES ($1, $2, $3)", synonym, id, time.Now().Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func RemoveSynonym(synonym string) error {
+	synonym, err := slugTag(synonym)
+	if err != nil {
+		return err
+	}
+
+	res, err := database.DB.Exec("DELETE FROM tag_synonyms WHERE synonym=$1", synonym)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSynonymNotFound
+	}
+
+	return nil
+}
+
+const (
+	TagPageSize = 20
+	// Longest tag description moderators can write
+	maxTagDescription = 500
+)
+
+// GetTag returns a tag with its description and how many posts use it.
+func GetTag(name string) (Tag, error) {
+	var t Tag
+	err := database.DB.Get(&t, `SELECT tags.tag_id, tags.tag, tags.description, COUNT(posts.post_id) AS posts
+								FROM tags
+									LEFT JOIN posts_tags ON posts_tags.tag_id=tags.tag_id
+									LEFT JOIN posts ON posts.post_id=posts_tags.post_id AND posts.deleted_at IS NULL
+								WHERE tags.tag=$1
+								GROUP BY tags.tag_id, tags.tag, tags.description`, name)
+	if err == sql.ErrNoRows {
+		return t, ErrTagNotFound
+	}
+
+	return t, err
+}
+
+// TagForSynonym returns the tag a synonym stands for.
+func TagForSynonym(synonym string) (string, error) {
+	var tag string
+	err := database.DB.QueryRow(`SELECT tags.tag FROM tag_synonyms INNER JOIN tags ON tags.tag_id=tag_synonyms.tag_id WHERE tag_synonyms.synonym=$1`, synonym).Scan(&tag)
+	if err == sql.ErrNoRows {
+		return tag, ErrSynonymNotFound
+	}
+
+	return tag, err
+}
+
+func EditTagDescription(tag string, description string) error {
+	description = strings.TrimSpace(description)
+	if utf8.RuneCountInString(description) > maxTagDescription {
+		return ErrTagDescriptionTooLong
+	}
+
+	res, err := database.DB.Exec("UPDATE tags SET description=$2 WHERE tag=$1", tag, description)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTagNotFound
+	}
+
+	return nil
+}
+
+// ListPostsByTag returns one page (from 1) of the posts with a tag, in a feed order, and whether there's another
+// page after it.
+func ListPostsByTag(tag string, viewer string, order string, page int) (PostCollection, bool, error) {
+	rows, err := database.DB.Query(`SELECT posts.post_id, posts.user_id, posts.post_title, posts.description, posts.protected, posts.created_at, posts.mood, users.preferred_name, comments_cnt, reactions_cnt, reactions, bookmarks_cnt, tags,
+										EXISTS (SELECT 1 FROM user_relations WHERE user_relations.user_id=$4 AND user_relations.target_id=posts.user_id) AS muted
+									FROM posts
+										LEFT JOIN users ON users.user_id=posts.user_id
+										LEFT JOIN(SELECT comments.post_id, COUNT(1) AS comments_cnt
+												FROM comments
+												WHERE comments.deleted_at IS NULL
+												GROUP BY comments.post_id) AS comments ON comments.post_id=posts.post_id
+										LEFT JOIN(SELECT post_id, SUM(n)::INT AS reactions_cnt, string_agg(reaction || ':' || n, ',' ORDER BY n DESC, reaction) AS reactions
+												FROM(SELECT post_id, reaction, COUNT(1) AS n FROM posts_reactions GROUP BY post_id, reaction) AS reaction_counts
+												GROUP BY reaction_counts.post_id) AS posts_reactions ON posts.post_id=posts_reactions.post_id
+										LEFT JOIN(SELECT post_id, COUNT(1) AS bookmarks_cnt
+												FROM bookmarks
+												WHERE comment_id IS NULL
+												GROUP BY bookmarks.post_id) AS bookmarks ON posts.post_id=bookmarks.post_id
+										LEFT JOIN(SELECT posts_tags.post_id, string_agg(tags.tag, ',') as tags
+												FROM posts_tags
+														LEFT JOIN tags ON posts_tags.tag_id=tags.tag_id
+												GROUP BY posts_tags.post_id) as posts_tags ON posts.post_id=posts_tags.post_id
+									WHERE posts.deleted_at IS NULL
+										AND posts.post_id IN (SELECT posts_tags.post_id FROM posts_tags
+																INNER JOIN tags ON tags.tag_id=posts_tags.tag_id
+															WHERE tags.tag=$1)
+									ORDER BY `+feedOrderBy(order)+`
+									LIMIT $2 OFFSET $3`, tag, TagPageSize+1, offset(page, TagPageSize), viewer)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPosts(rows)
+	if len(posts) > TagPageSize {
+		return posts[:TagPageSize], true, err
+	}
+
+	return posts, false, err
+}
+
+// Most suggestions the tag autocomplete offers
+const suggestLimit = 8
+
+// SuggestTags completes what's been typed of a tag, from the tags in use and their synonyms.
+func SuggestTags(q string) ([]Tag, error) {
+	q, err := TitleToID(q)
+	if err != nil || q == "" {
+		return nil, err
+	}
+
+	tags, err := ListTags()
+	if err != nil {
+		return nil, err
+	}
+	synonyms, err := ListSynonyms()
+	if err != nil {
+		return nil, err
+	}
+
+	return rankTagSuggestions(q, tags, synonyms, suggestLimit), nil
+}
+
+// rankTagSuggestions matches q against tags and synonyms. Tags starting with q come first, then tags containing
+// it, then tags with its letters in order or a typo away from it, and within each the most used. A matching
+// synonym suggests the tag it stands for.
+func rankTagSuggestions(q string, tags []Tag, synonyms []TagSynonym, limit int) []Tag {
+	rank := make(map[string]int)
+	for _, t := range tags {
+		if r, ok := matchTag(q, t.Tag); ok {
+			rank[t.Tag] = r
+		}
+	}
+	for _, s := range synonyms {
+		if r, ok := matchTag(q, s.Synonym); ok {
+			if old, seen := rank[s.Tag]; !seen || r < old {
+				rank[s.Tag] = r
+			}
+		}
+	}
+
+	var list []Tag
+	for _, t := range tags {
+		if _, ok := rank[t.Tag]; ok {
+			list = append(list, t)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if rank[list[i].Tag] != rank[list[j].Tag] {
+			return rank[list[i].Tag] < rank[list[j].Tag]
+		}
+		if list[i].Posts != list[j].Posts {
+			return list[i].Posts > list[j].Posts
+		}
+		return list[i].Tag < list[j].Tag
+	})
+
+	if len(list) > limit {
+		list = list[:limit]
+	}
+
+	return list
+}
+
+// matchTag reports whether name matches q and how well, lower being better.
+func matchTag(q string, name string) (int, bool) {
+	switch {
+	case strings.HasPrefix(name, q):
+		return 0, true
+	case strings.Contains(name, q):
+		return 1, true
+	case isSubsequence(q, name):
+		return 2, true
+	// A typo only counts once there's enough typed to tell what was meant
+	case len(q) >= 4 && editDistance(q, name[:min(len(name), len(q))]) <= 1:
+		return 3, true
+	}
+
+	return 0, false
+}
+
+// isSubsequence reports whether the letters of q appear in s in order, e.g. "wrkplc" in "workplace".
+func isSubsequence(q string, s string) bool {
+	i := 0
+	for _, c := range s {
+		if i < len(q) && rune(q[i]) == c {
+			i++
+		}
+	}
+
+	return i == len(q)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(rb)]
+}
+
+// CloudTag is a tag in the tag cloud, with a Weight from 1 for the least used to CloudWeights for the most.
+type CloudTag struct {
+	Tag
+	Weight int
+}
+
+const CloudWeights = 5
+
+// TagCloud weighs the limit most used tags by how many posts use them and sorts them by name. The weights follow
+// the log of the counts so a few popular tags don't shrink everything else to the same size.
+func TagCloud(tags []Tag, limit int) []CloudTag {
+	top := make([]Tag, 0, len(tags))
+	for _, t := range tags {
+		if t.Posts > 0 {
+			top = append(top, t)
+		}
+	}
+	sort.SliceStable(top, func(i, j int) bool { return top[i].Posts > top[j].Posts })
+	if len(top) > limit {
+		top = top[:limit]
+	}
+	if len(top) == 0 {
+		return nil
+	}
+
+	lo, hi := math.Log(float64(top[len(top)-1].Posts)), math.Log(float64(top[0].Posts))
+	cloud := make([]CloudTag, len(top))
+	for i, t := range top {
+		weight := 1
+		if hi > lo {
+			weight += int(math.Round((math.Log(float64(t.Posts)) - lo) / (hi - lo) * (CloudWeights - 1)))
+		}
+		cloud[i] = CloudTag{Tag: t, Weight: weight}
+	}
+	sort.Slice(cloud, func(i, j int) bool { return cloud[i].Tag.Tag < cloud[j].Tag.Tag })
+
+	return cloud
+}
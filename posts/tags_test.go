@@ -0,0 +1,121 @@
+package posts
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gorant/database/dbtest"
+)
+
+func TestSlugTag(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"Work", "work"},
+		{"  work   from home ", "work-from-home"},
+		{"#wfh!", "wfh"},
+	} {
+		if got, err := slugTag(tt.in); err != nil || got != tt.want {
+			t.Errorf("slugTag(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "  ", "?!#", strings.Repeat("a", 31)} {
+		if _, err := slugTag(in); err != ErrTagInvalid {
+			t.Errorf("slugTag(%q) error = %v, want ErrTagInvalid", in, err)
+		}
+	}
+}
+
+func TestRankTagSuggestions(t *testing.T) {
+	tags := []Tag{
+		{Tag: "work", Posts: 3},
+		{Tag: "workplace", Posts: 10},
+		{Tag: "homework", Posts: 1},
+		{Tag: "traffic", Posts: 7},
+		{Tag: "weather", Posts: 2},
+	}
+	synonyms := []TagSynonym{{Synonym: "commute", Tag: "traffic"}}
+
+	for _, tt := range []struct {
+		q    string
+		want []string
+	}{
+		{"work", []string{"workplace", "work", "homework"}},
+		{"wrkplc", []string{"workplace"}},
+		{"comm", []string{"traffic"}},
+		{"wether", []string{"weather"}},
+		{"xyz", nil},
+	} {
+		var got []string
+		for _, s := range rankTagSuggestions(tt.q, tags, synonyms, 8) {
+			got = append(got, s.Tag)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("rankTagSuggestions(%q) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+
+	if got := rankTagSuggestions("w", tags, synonyms, 2); len(got) != 2 {
+		t.Errorf("rankTagSuggestions limit 2 returned %d tags", len(got))
+	}
+}
+
+func TestTagCloud(t *testing.T) {
+	cloud := TagCloud([]Tag{
+		{Tag: "rare", Posts: 1},
+		{Tag: "common", Posts: 100},
+		{Tag: "middling", Posts: 10},
+		{Tag: "unused", Posts: 0},
+	}, 10)
+
+	want := map[string]int{"common": CloudWeights, "middling": 3, "rare": 1}
+	if len(cloud) != len(want) {
+		t.Fatalf("TagCloud returned %d tags, want %d", len(cloud), len(want))
+	}
+	for i, c := range cloud {
+		if i > 0 && cloud[i-1].Tag.Tag > c.Tag.Tag {
+			t.Errorf("TagCloud isn't sorted by name: %q before %q", cloud[i-1].Tag.Tag, c.Tag.Tag)
+		}
+		if c.Weight != want[c.Tag.Tag] {
+			t.Errorf("TagCloud weight of %q = %d, want %d", c.Tag.Tag, c.Weight, want[c.Tag.Tag])
+		}
+	}
+
+	if got := TagCloud([]Tag{{Tag: "only", Posts: 4}}, 10); len(got) != 1 || got[0].Weight != 1 {
+		t.Errorf("TagCloud of one tag = %v, want weight 1", got)
+	}
+}
+
+func TestEditTagsKeepsOtherPosts(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.AddUser(t, "owner")
+	dbtest.AddPost(t, "first", "owner")
+	dbtest.AddPost(t, "second", "owner")
+
+	for _, postID := range []string{"first", "second"} {
+		if err := EditTags(postID, []string{"work", "mondays"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Taking a tag off one post leaves it on the other
+	if err := EditTags("first", []string{"work"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for postID, want := range map[string][]string{"first": {"work"}, "second": {"mondays", "work"}} {
+		postsTags, err := GetPostIDTagIDTag(postID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, pt := range postsTags {
+			got = append(got, pt.Tag)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s is tagged %v, want %v", postID, got, want)
+		}
+	}
+}
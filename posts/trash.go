@@ -0,0 +1,144 @@
+package posts
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorant/database"
+)
+
+// TrashRetention is how long soft-deleted posts and comments can be restored before PurgeTrash hard-deletes them.
+const TrashRetention = 30 * 24 * time.Hour
+
+// TrashExpiry returns a short description of when a soft-deleted item will be purged, e.g. "in 29 days".
+func TrashExpiry(deletedAt string) string {
+	t, err := time.Parse(time.RFC3339, deletedAt)
+	if err != nil {
+		return ""
+	}
+
+	left := time.Until(t.Add(TrashRetention))
+	switch {
+	case left <= 0:
+		return "soon"
+	case left < 24*time.Hour:
+		return "in " + strconv.Itoa(int(left.Hours())) + " hours"
+	default:
+		return "in " + strconv.Itoa(int(left.Hours()/24)) + " days"
+	}
+}
+
+func retentionCutoff() string {
+	return time.Now().Add(-TrashRetention).Format(time.RFC3339)
+}
+
+func ListTrashPosts(username string) (PostCollection, error) {
+	var posts PostCollection
+
+	rows, err := database.DB.Query(`SELECT post_id, post_title, mood, created_at, deleted_at
+									FROM posts
+									WHERE user_id=$1 AND deleted_at IS NOT NULL AND deleted_at::TIMESTAMPTZ > $2::TIMESTAMPTZ
+									ORDER BY deleted_at::TIMESTAMPTZ DESC`, username, retentionCutoff())
+	if err != nil {
+		return posts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p ZPost
+		if err := rows.Scan(&p.ID, &p.Title, &p.Mood, &p.CreatedAt.CreatedAtString, &p.DeletedAt); err != nil {
+			return posts, err
+		}
+
+		p.CreatedAt.CreatedAtProcessed, err = ConvertDate(p.CreatedAt.CreatedAtString)
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		posts = append(posts, p)
+	}
+
+	return posts, nil
+}
+
+// ListTrashComments only returns comments whose post is still live, a deleted post is restored together with its comments.
+func ListTrashComments(username string) ([]JoinComment, error) {
+	var comments []JoinComment
+
+	rows, err := database.DB.Query(`SELECT comments.comment_id, comments.content, comments.created_at, comments.post_id, comments.deleted_at, posts.post_title
+									FROM comments
+										INNER JOIN posts ON posts.post_id = comments.post_id
+									WHERE comments.user_id=$1 AND posts.deleted_at IS NULL AND comments.deleted_at IS NOT NULL AND comments.deleted_at::TIMESTAMPTZ > $2::TIMESTAMPTZ
+									ORDER BY comments.deleted_at::TIMESTAMPTZ DESC`, username, retentionCutoff())
+	if err != nil {
+		return comments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c JoinComment
+		if err := rows.Scan(&c.CommentID, &c.Content, &c.CreatedAt, &c.PostID, &c.DeletedAt, &c.PostTitle); err != nil {
+			return comments, err
+		}
+
+		c.CreatedAtProcessed, err = ConvertDate(c.CreatedAt)
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		comments = append(comments, c)
+	}
+
+	return comments, nil
+}
+
+func RestorePost(postID string, username string) error {
+	res, err := database.DB.Exec(`UPDATE posts SET deleted_at=NULL, deleted_by=NULL
+								WHERE post_id=$1 AND user_id=$2 AND deleted_at IS NOT NULL AND deleted_at::TIMESTAMPTZ > $3::TIMESTAMPTZ`, postID, username, retentionCutoff())
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("error: post not found in trash")
+	}
+
+	return nil
+}
+
+func RestoreComment(commentID string, username string) error {
+	res, err := database.DB.Exec(`UPDATE comments SET deleted_at=NULL, deleted_by=NULL
+								WHERE comment_id=$1 AND user_id=$2 AND deleted_at IS NOT NULL AND deleted_at::TIMESTAMPTZ > $3::TIMESTAMPTZ`, commentID, username, retentionCutoff())
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("error: comment not found in trash")
+	}
+
+	return nil
+}
+
+// PurgeTrash hard-deletes posts and comments that have been in the trash longer than TrashRetention.
+// Deleting a post cascades to its comments, reactions, tags and revisions.
+func PurgeTrash() error {
+	cutoff := retentionCutoff()
+
+	res, err := database.DB.Exec(`DELETE FROM posts WHERE deleted_at IS NOT NULL AND deleted_at::TIMESTAMPTZ <= $1::TIMESTAMPTZ`, cutoff)
+	if err != nil {
+		return err
+	}
+	p, _ := res.RowsAffected()
+
+	res, err = database.DB.Exec(`DELETE FROM comments WHERE deleted_at IS NOT NULL AND deleted_at::TIMESTAMPTZ <= $1::TIMESTAMPTZ`, cutoff)
+	if err != nil {
+		return err
+	}
+	c, _ := res.RowsAffected()
+
+	fmt.Printf("Purged trash: %d posts, %d comments\n", p, c)
+	return nil
+}
@@ -0,0 +1,218 @@
+package sentiment
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// Scores are clamped to ±MaxScore, a single lexicon word is worth at most that much
+	MaxScore = 5.0
+	// How many words after a negator it still applies to, a clause boundary ends it sooner
+	negationScope = 3
+	// A negated word flips and loses some strength: "not bad" is less positive than "good"
+	negationFactor = -0.5
+)
+
+//go:embed lexicon.txt
+var defaultLexicon string
+
+// Lexicon is what the scorer knows about words: their sentiment, how much modifiers like "very" and
+// "slightly" scale the next word, and which words negate the ones after them.
+type Lexicon struct {
+	Words     map[string]float64
+	Modifiers map[string]float64
+	Negators  map[string]bool
+}
+
+// Default is the lexicon that ships with the package, main replaces it when SENTIMENT_LEXICON points to another file.
+var Default = mustParse(defaultLexicon)
+
+func mustParse(s string) *Lexicon {
+	l, err := Parse(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+
+	return l
+}
+
+func LoadFile(path string) (*Lexicon, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Parse reads a lexicon file. Lines are "word score" in the default [words] section, "word factor" under
+// [modifiers] and a bare word under [negators]. Blank lines and lines starting with # are skipped.
+func Parse(r io.Reader) (*Lexicon, error) {
+	l := &Lexicon{Words: make(map[string]float64), Modifiers: make(map[string]float64), Negators: make(map[string]bool)}
+
+	section := "words"
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Trim(line, "[]")
+			if section != "words" && section != "modifiers" && section != "negators" {
+				return nil, fmt.Errorf("line %d: unknown section %q", n, section)
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		word := normalize(fields[0])
+
+		if section == "negators" {
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("line %d: negators take no value", n)
+			}
+			l.Negators[word] = true
+			continue
+		}
+
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a word and a number", n)
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		if section == "modifiers" {
+			if v <= 0 {
+				return nil, fmt.Errorf("line %d: modifier factors must be positive", n)
+			}
+			l.Modifiers[word] = v
+		} else {
+			if math.Abs(v) > MaxScore {
+				return nil, fmt.Errorf("line %d: scores go from -%g to %g", n, MaxScore, MaxScore)
+			}
+			l.Words[word] = v
+		}
+	}
+
+	return l, scanner.Err()
+}
+
+// Result is the sentiment of a text, Score between -MaxScore and MaxScore. Hits counts the words the lexicon knew.
+type Result struct {
+	Score float64
+	Hits  int
+}
+
+// Score averages the scores of the known words in text, so a long rant doesn't outweigh a short one. Each word
+// weighs by its own strength, a single "furious" sets the tone more than a few "late"s. A modifier scales the
+// word right after it, and a negator flips the next few words up to the end of the clause.
+func (l *Lexicon) Score(text string) Result {
+	var r Result
+	var sum, weight float64
+
+	boost := 1.0
+	negated := 0
+	for _, tok := range tokenize(text) {
+		if tok == boundary {
+			boost, negated = 1, 0
+			continue
+		}
+
+		switch {
+		case l.Negators[tok] || strings.HasSuffix(tok, "n't"):
+			negated = negationScope + 1
+		case l.Modifiers[tok] != 0:
+			boost *= l.Modifiers[tok]
+		default:
+			if v, ok := l.Words[tok]; ok {
+				v *= boost
+				if negated > 0 {
+					v *= negationFactor
+				}
+				sum += v * math.Abs(v)
+				weight += math.Abs(v)
+				r.Hits++
+			}
+			boost = 1
+		}
+
+		if negated > 0 {
+			negated--
+		}
+	}
+
+	if weight > 0 {
+		r.Score = math.Max(-MaxScore, math.Min(MaxScore, sum/weight))
+	}
+
+	return r
+}
+
+// Score uses the Default lexicon.
+func Score(text string) Result {
+	return Default.Score(text)
+}
+
+// Step places the result on a mood scale running from lo to hi, with mid the neutral mood. Negative scores are
+// spread over the steps below mid and positive ones over the steps above it. Texts without known words are neutral.
+func (r Result) Step(lo int, mid int, hi int) int {
+	if r.Hits == 0 || r.Score == 0 {
+		return mid
+	}
+
+	span := hi - mid
+	if r.Score < 0 {
+		span = mid - lo
+	}
+
+	return mid + int(math.Round(r.Score/MaxScore*float64(span)))
+}
+
+// boundary stands in for punctuation that ends a clause
+const boundary = "."
+
+func tokenize(text string) []string {
+	var tokens []string
+	var word strings.Builder
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, strings.Trim(word.String(), "'"))
+			word.Reset()
+		}
+	}
+
+	for _, c := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			word.WriteRune(c)
+		case c == '\'' || c == '’':
+			word.WriteRune('\'')
+		case strings.ContainsRune(".,;:!?()", c):
+			flush()
+			tokens = append(tokens, boundary)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+func normalize(word string) string {
+	return strings.ReplaceAll(strings.ToLower(word), "’", "'")
+}
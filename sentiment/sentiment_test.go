@@ -0,0 +1,112 @@
+package sentiment
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	l, err := Parse(strings.NewReader("# comment\ngood 2\nBad -2\n\n[modifiers]\nvery 1.5\n[negators]\nnot\n"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if l.Words["good"] != 2 || l.Words["bad"] != -2 || l.Modifiers["very"] != 1.5 || !l.Negators["not"] {
+		t.Errorf("Parse() = %+v", l)
+	}
+
+	for _, s := range []string{
+		"good",
+		"good two",
+		"good 6",
+		"[feelings]",
+		"[modifiers]\nvery 0",
+		"[negators]\nnot really",
+	} {
+		if _, err := Parse(strings.NewReader(s)); err == nil {
+			t.Errorf("Parse(%q) accepted an invalid lexicon", s)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	l, err := Parse(strings.NewReader("good 2\nbad -2\n[modifiers]\nvery 2\nslightly 0.5\n[negators]\nnot\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		text string
+		want float64
+	}{
+		{"good", 2},
+		{"Good, bad, good", 2.0 / 3},
+		{"very good", 4},
+		{"very very good", 5},
+		{"very very very good", 5},
+		{"slightly bad", -1},
+		{"not good", -1},
+		{"isn't good", -1},
+		{"isn’t very good", -2},
+		{"not at all good", -1},
+		{"not that it was ever good", 2},
+		{"not. good", 2},
+		{"very, good", 2},
+		{"nothing to see here", 0},
+	} {
+		if got := l.Score(tt.text).Score; got != tt.want {
+			t.Errorf("Score(%q) = %g, want %g", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestStep(t *testing.T) {
+	for _, tt := range []struct {
+		r    Result
+		want int
+	}{
+		{Result{}, 0},
+		{Result{Score: 0, Hits: 2}, 0},
+		{Result{Score: -5, Hits: 1}, -3},
+		{Result{Score: -1, Hits: 1}, -1},
+		{Result{Score: 5, Hits: 1}, 2},
+		{Result{Score: 1, Hits: 1}, 0},
+	} {
+		if got := tt.r.Step(-3, 0, 2); got != tt.want {
+			t.Errorf("%+v.Step(-3, 0, 2) = %d, want %d", tt.r, got, tt.want)
+		}
+	}
+}
+
+// The corpus checks the default lexicon against the default mood scale, from angry at -3 to elated at 2.
+func TestCorpus(t *testing.T) {
+	scale := map[int]string{-3: "angry", -2: "upset", -1: "sad", 0: "neutral", 1: "happy", 2: "elated"}
+
+	f, err := os.Open("testdata/corpus.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		want, text, ok := strings.Cut(line, "\t")
+		if !ok {
+			t.Fatalf("malformed corpus line %q", line)
+		}
+
+		r := Score(text)
+		if got := scale[r.Step(-3, 0, 2)]; got != want {
+			t.Errorf("%q: got %s (score %.2f), want %s", text, got, r.Score, want)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
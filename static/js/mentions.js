@@ -0,0 +1,85 @@
+// @mention autocomplete for comment textareas marked with data-mentions.
+// Suggestions come from /users/suggest as rendered HTML, picking one replaces the partial @handle before the caret.
+
+const mentionBeforeCaret = /(^|[^\w@])@(\w{1,30})$/;
+
+export default function mentions() {
+	// Delegated, since the comment form and edit forms are swapped in by htmx
+	let timer;
+	document.addEventListener('input', (evt) => {
+		const textarea = evt.target;
+		if (!textarea.matches('textarea[data-mentions]')) {
+			return;
+		}
+
+		clearTimeout(timer);
+		timer = setTimeout(() => suggest(textarea), 150);
+	});
+
+	document.addEventListener('keydown', (evt) => {
+		const list = suggestionsFor(evt.target);
+		if (!list || list.classList.contains('hidden')) {
+			return;
+		}
+
+		if (evt.key === 'Escape') {
+			list.classList.add('hidden');
+		} else if ((evt.key === 'Enter' || evt.key === 'Tab') && !evt.ctrlKey) {
+			const first = list.querySelector('[data-handle]');
+			if (first) {
+				evt.preventDefault();
+				pick(evt.target, first.dataset.handle);
+			}
+		}
+	});
+
+	document.addEventListener('click', (evt) => {
+		const option = evt.target.closest('[data-handle]');
+		if (!option) {
+			return;
+		}
+
+		const textarea = document.getElementById(option.closest('[data-mentions-for]').dataset.mentionsFor);
+		pick(textarea, option.dataset.handle);
+	});
+}
+
+function suggestionsFor(textarea) {
+	if (!textarea || !textarea.matches || !textarea.matches('textarea[data-mentions]')) {
+		return null;
+	}
+
+	return document.querySelector(`[data-mentions-for="${textarea.id}"]`);
+}
+
+async function suggest(textarea) {
+	const list = suggestionsFor(textarea);
+	if (!list) {
+		return;
+	}
+
+	const match = textarea.value.slice(0, textarea.selectionStart).match(mentionBeforeCaret);
+	if (!match) {
+		list.classList.add('hidden');
+		return;
+	}
+
+	const res = await fetch('/users/suggest?q=' + encodeURIComponent(match[2]));
+	if (!res.ok) {
+		return;
+	}
+
+	list.innerHTML = await res.text();
+	list.classList.toggle('hidden', !list.querySelector('[data-handle]'));
+}
+
+function pick(textarea, handle) {
+	const caret = textarea.selectionStart;
+	const before = textarea.value.slice(0, caret).replace(mentionBeforeCaret, `$1@${handle} `);
+
+	textarea.value = before + textarea.value.slice(caret);
+	textarea.selectionStart = textarea.selectionEnd = before.length;
+	textarea.focus();
+
+	suggestionsFor(textarea).classList.add('hidden');
+}
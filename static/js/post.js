@@ -1,4 +1,5 @@
 import tags from './tags';
+import mentions from './mentions';
 import { keyboardShortcut } from './common';
 
 // Post Description
@@ -89,6 +90,7 @@ postTitleTruncated.addEventListener('click', (evt) => {
 })();
 
 tags();
+mentions();
 
 function initKeyBoardShortcutForPosts() {
 	const commentFormMessageInput = document.getElementById('comment-form-message-input');
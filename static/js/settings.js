@@ -17,3 +17,34 @@ settingsFormDisplayName.addEventListener('keyup', () => {
 		}
 	}
 });
+
+// Avatar crop preview. The preview is a background image sized and positioned the same way the server crops:
+// zoom 1 is the largest square that fits, x/y place it within whatever is left over.
+const avatarFileInput = document.getElementById('avatar-file-input');
+const avatarCropPreview = document.getElementById('avatar-crop-preview');
+const avatarCropInputs = ['avatar-crop-zoom', 'avatar-crop-x', 'avatar-crop-y'].map((id) => document.getElementById(id));
+let avatarImage;
+
+function updateAvatarCropPreview() {
+	if (!avatarImage) return;
+	const [zoom, x, y] = avatarCropInputs.map((input) => parseFloat(input.value));
+	const side = avatarCropPreview.clientWidth;
+	const scale = (side / Math.min(avatarImage.naturalWidth, avatarImage.naturalHeight)) * zoom;
+	avatarCropPreview.style.backgroundSize = `${avatarImage.naturalWidth * scale}px ${avatarImage.naturalHeight * scale}px`;
+	avatarCropPreview.style.backgroundPosition = `${x * 100}% ${y * 100}%`;
+}
+
+if (avatarFileInput) {
+	avatarFileInput.addEventListener('change', () => {
+		const file = avatarFileInput.files[0];
+		if (!file) return;
+		const url = URL.createObjectURL(file);
+		avatarImage = new Image();
+		avatarImage.addEventListener('load', () => {
+			avatarCropPreview.style.backgroundImage = `url(${url})`;
+			updateAvatarCropPreview();
+		});
+		avatarImage.src = url;
+	});
+	avatarCropInputs.forEach((input) => input.addEventListener('input', updateAvatarCropPreview));
+}
@@ -11,7 +11,11 @@ export default function tags() {
 		}
 	});
 
-	document.addEventListener('htmx:afterSwap', () => {
+	document.addEventListener('htmx:afterSwap', (evt) => {
+		// Autocomplete suggestions swap in while typing, the tags UI is already set up
+		if (evt.detail.target.id === 'tags-suggestions') {
+			return;
+		}
 		if (checkDomForTagsEls()) {
 			tagsUi();
 		}
@@ -0,0 +1,213 @@
+package uploads
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+	"time"
+
+	"gorant/database"
+)
+
+// Store is set in main, the same way database.DB is.
+var Store BlobStore
+
+type Attachment struct {
+	AttachmentID string         `db:"attachment_id"`
+	PostID       string         `db:"post_id"`
+	CommentID    sql.NullString `db:"comment_id"`
+	UserID       sql.NullString `db:"user_id"`
+	Hash         string         `db:"blob_hash"`
+	Width        int            `db:"width"`
+	Height       int            `db:"height"`
+	CreatedAt    string         `db:"created_at"`
+}
+
+func (a Attachment) URL(variant string) string {
+	return "/uploads/" + BlobKey(a.Hash, variant)
+}
+
+// SrcSet lists every variant with its actual width, for the img srcset attribute.
+func (a Attachment) SrcSet() string {
+	var set []string
+	for _, v := range Variants {
+		w := min(v.MaxWidth, a.Width)
+		set = append(set, fmt.Sprintf("%s %dw", a.URL(v.Name), w))
+	}
+
+	return strings.Join(set, ", ")
+}
+
+// Save validates and processes the uploaded files and writes every variant to Store.
+// Nothing is recorded in the database yet, that happens in Attach once the post or comment exists.
+// If that never happens, the blobs are left for CollectGarbage.
+func Save(files []*multipart.FileHeader) ([]Image, error) {
+	var images []Image
+
+	if len(files) > MaxFiles {
+		return images, &ValidationError{Message: fmt.Sprintf("You can attach at most %d images.", MaxFiles)}
+	}
+
+	for _, fh := range files {
+		if fh.Size > MaxFileSize {
+			return images, &ValidationError{Message: fmt.Sprintf("Images must be %d MB or smaller.", MaxFileSize>>20)}
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			return images, err
+		}
+		// The header size comes from the client, so read one byte past the limit to double check
+		data, err := io.ReadAll(io.LimitReader(f, MaxFileSize+1))
+		f.Close()
+		if err != nil {
+			return images, err
+		}
+		if len(data) > MaxFileSize {
+			return images, &ValidationError{Message: fmt.Sprintf("Images must be %d MB or smaller.", MaxFileSize>>20)}
+		}
+
+		img, variants, err := Process(data)
+		if err != nil {
+			return images, err
+		}
+
+		for name, b := range variants {
+			if err := Store.Put(BlobKey(img.Hash, name), bytes.NewReader(b)); err != nil {
+				return images, err
+			}
+		}
+
+		images = append(images, img)
+	}
+
+	return images, nil
+}
+
+// SaveAvatar reads, crops and stores an avatar upload, returning its blob hash.
+func SaveAvatar(fh *multipart.FileHeader, c Crop) (string, error) {
+	if fh.Size > MaxFileSize {
+		return "", &ValidationError{Message: fmt.Sprintf("Images must be %d MB or smaller.", MaxFileSize>>20)}
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, MaxFileSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > MaxFileSize {
+		return "", &ValidationError{Message: fmt.Sprintf("Images must be %d MB or smaller.", MaxFileSize>>20)}
+	}
+
+	hash, b, err := ProcessAvatar(data, c)
+	if err != nil {
+		return "", err
+	}
+
+	return hash, Store.Put(BlobKey(hash, AvatarVariant), bytes.NewReader(b))
+}
+
+// Attach records saved images against a post, or against a comment when commentID isn't empty.
+func Attach(images []Image, postID string, commentID string, userID string) error {
+	if len(images) == 0 {
+		return nil
+	}
+
+	var cID sql.NullString
+	if commentID != "" {
+		cID = sql.NullString{String: commentID, Valid: true}
+	}
+
+	t := time.Now().Format(time.RFC3339)
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, img := range images {
+		if _, err := tx.Exec(`INSERT INTO attachments (post_id, comment_id, user_id, blob_hash, width, height, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`, postID, cID, userID, img.Hash, img.Width, img.Height, t); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListByPost returns every attachment on a post and its comments, keyed by comment ID.
+// The post's own attachments are under the empty key.
+func ListByPost(postID string) (map[string][]Attachment, error) {
+	attachments := make(map[string][]Attachment)
+
+	rows, err := database.DB.Query(`SELECT attachment_id, post_id, comment_id, user_id, blob_hash, width, height, created_at
+									FROM attachments
+									WHERE post_id=$1
+									ORDER BY attachment_id`, postID)
+	if err != nil {
+		return attachments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.AttachmentID, &a.PostID, &a.CommentID, &a.UserID, &a.Hash, &a.Width, &a.Height, &a.CreatedAt); err != nil {
+			return attachments, err
+		}
+
+		attachments[a.CommentID.String] = append(attachments[a.CommentID.String], a)
+	}
+
+	return attachments, rows.Err()
+}
+
+// CollectGarbage deletes blobs that no attachment row or avatar points at, i.e. uploads whose post or comment was never created,
+// the files of hard-deleted posts and comments (their rows go with them via ON DELETE CASCADE) and replaced avatars.
+// Blobs newer than grace are skipped so uploads still waiting on Attach aren't removed from under a request.
+func CollectGarbage(grace time.Duration) error {
+	var hashes []string
+	err := database.DB.Select(&hashes, `SELECT blob_hash FROM attachments
+											UNION
+										SELECT substring(avatar from 8) FROM users WHERE avatar LIKE 'upload:%'`)
+	if err != nil {
+		return err
+	}
+
+	referenced := make(map[string]bool, len(hashes))
+	for _, h := range hashes {
+		referenced[h] = true
+	}
+
+	cutoff := time.Now().Add(-grace)
+	var orphans []string
+
+	err = Store.Walk(func(key string, modified time.Time) error {
+		hash, _, _ := strings.Cut(key, "/")
+		if !referenced[hash] && modified.Before(cutoff) {
+			orphans = append(orphans, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, key := range orphans {
+		if err := Store.Delete(key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	fmt.Printf("Collected orphaned uploads: %d blobs\n", len(orphans)-len(errs))
+	return errors.Join(errs...)
+}
@@ -0,0 +1,116 @@
+package uploads
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorant/database/dbtest"
+)
+
+// fileHeaders posts files through a multipart form, the way the upload handlers get them.
+func fileHeaders(t *testing.T, files ...[]byte) []*multipart.FileHeader {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, f := range files {
+		part, err := w.CreateFormFile("images", "upload")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(f)
+	}
+	w.Close()
+
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+
+	return form.File["images"]
+}
+
+func TestSaveLimits(t *testing.T) {
+	useTempStore(t)
+	small := pngBytes(t, 10, 10)
+
+	tests := []struct {
+		name  string
+		files []*multipart.FileHeader
+	}{
+		{"too many files", fileHeaders(t, small, small, small, small, small)},
+		{"too large", fileHeaders(t, append(pngBytes(t, 10, 10), make([]byte, MaxFileSize)...))},
+		{"not an image", fileHeaders(t, []byte("hello"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := Save(tt.files)
+			var v *ValidationError
+			if !errors.As(err, &v) || len(images) != 0 {
+				t.Errorf("Save = %v, %v, want a ValidationError", images, err)
+			}
+		})
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	dbtest.Open(t)
+	s := useTempStore(t)
+	dbtest.AddUser(t, "owner")
+	dbtest.AddPost(t, "rant", "owner")
+
+	images, err := Save(fileHeaders(t, pngBytes(t, 40, 30), pngBytes(t, 30, 40), pngBytes(t, 20, 20)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	attached, orphan, fresh := images[0], images[1], images[2]
+
+	if err := Attach([]Image{attached}, "rant", "", "owner"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ListByPost("rant"); err != nil || len(got[""]) != 1 || got[""][0].Hash != attached.Hash {
+		t.Fatalf("ListByPost = %v, %v", got, err)
+	}
+
+	// The fresh upload is still waiting on its Attach, the other two are old enough to collect
+	old := time.Now().Add(-2 * time.Hour)
+	for _, img := range []Image{attached, orphan} {
+		for _, v := range Variants {
+			if err := os.Chtimes(filepath.Join(s.Root, filepath.FromSlash(BlobKey(img.Hash, v.Name))), old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := CollectGarbage(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		img  Image
+		kept bool
+	}{
+		{"attached", attached, true},
+		{"orphan", orphan, false},
+		{"fresh", fresh, true},
+	} {
+		for _, v := range Variants {
+			_, err := os.Stat(filepath.Join(s.Root, filepath.FromSlash(BlobKey(tt.img.Hash, v.Name))))
+			if tt.kept && err != nil {
+				t.Errorf("%s %s variant was collected: %v", tt.name, v.Name, err)
+			}
+			if !tt.kept && !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s %s variant wasn't collected: %v", tt.name, v.Name, err)
+			}
+		}
+	}
+}
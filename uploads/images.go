@@ -0,0 +1,198 @@
+package uploads
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"net/http"
+
+	"github.com/HugoSmits86/nativewebp"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	MaxFileSize = 8 << 20
+	MaxFiles    = 4
+	// MaxRequestSize caps the whole multipart body, leaving some room for the other form fields
+	MaxRequestSize = MaxFiles*MaxFileSize + 1<<20
+	// Checked from the header before decoding, so a tiny file claiming to be 50000x50000 can't exhaust memory
+	maxPixels = 40_000_000
+)
+
+// Only the first frame of a GIF is kept.
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+type Variant struct {
+	Name     string
+	MaxWidth int
+}
+
+// Every upload is stored at each of these sizes. Images narrower than MaxWidth are never upscaled.
+var Variants = []Variant{
+	{Name: "thumb", MaxWidth: 320},
+	{Name: "medium", MaxWidth: 960},
+	{Name: "full", MaxWidth: 1920},
+}
+
+// ValidationError is returned for uploads the user needs to fix, its message is safe to display.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Image is an upload after processing. Hash is the hex SHA-256 of the original file and prefixes all its blob keys.
+type Image struct {
+	Hash   string
+	Width  int
+	Height int
+}
+
+func BlobKey(hash string, variant string) string {
+	return hash + "/" + variant + ".webp"
+}
+
+// Process sniffs and decodes an uploaded file, then re-encodes it as WebP at every size in Variants, keyed by variant name.
+// Re-encoding from decoded pixels also drops EXIF and any other metadata; the orientation tag is applied first so photos
+// from phones don't end up sideways.
+func Process(data []byte) (Image, map[string][]byte, error) {
+	var img Image
+
+	src, err := decode(data)
+	if err != nil {
+		return img, nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	img.Hash = hex.EncodeToString(sum[:])
+	img.Width = src.Bounds().Dx()
+	img.Height = src.Bounds().Dy()
+
+	out := make(map[string][]byte, len(Variants))
+	for _, v := range Variants {
+		var buf bytes.Buffer
+		if err := nativewebp.Encode(&buf, resize(src, v.MaxWidth), nil); err != nil {
+			return img, nil, err
+		}
+		out[v.Name] = buf.Bytes()
+	}
+
+	return img, out, nil
+}
+
+const (
+	AvatarVariant = "avatar"
+	avatarSize    = 256
+)
+
+// Crop picks the square of an image to keep for an avatar. Zoom 1 is the largest square that fits,
+// X and Y (0 to 1) place that square within the space left over, so 0.5, 0.5 is centred.
+type Crop struct {
+	Zoom float64
+	X    float64
+	Y    float64
+}
+
+// ProcessAvatar crops an upload to a square and encodes it as a single avatarSize WebP.
+// The returned hash is of the encoded avatar, since the same photo cropped differently is a different avatar.
+func ProcessAvatar(data []byte, c Crop) (string, []byte, error) {
+	src, err := decode(data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	b := src.Bounds()
+	zoom := clamp(c.Zoom, 1, 10, 1)
+	x := clamp(c.X, 0, 1, 0.5)
+	y := clamp(c.Y, 0, 1, 0.5)
+
+	size := int(float64(min(b.Dx(), b.Dy())) / zoom)
+	if size < 1 {
+		size = 1
+	}
+	x0 := b.Min.X + int(float64(b.Dx()-size)*x)
+	y0 := b.Min.Y + int(float64(b.Dy()-size)*y)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, avatarSize, avatarSize))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, image.Rect(x0, y0, x0+size, y0+size), draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, dst, nil); err != nil {
+		return "", nil, err
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:]), buf.Bytes(), nil
+}
+
+// clamp keeps v between lo and hi. NaN, which ParseFloat reads from "NaN", becomes def rather than reaching the pixel maths.
+func clamp(v float64, lo float64, hi float64, def float64) float64 {
+	if math.IsNaN(v) {
+		return def
+	}
+
+	return math.Max(lo, math.Min(v, hi))
+}
+
+func decode(data []byte) (image.Image, error) {
+	ct := http.DetectContentType(data)
+	if !allowedTypes[ct] {
+		return nil, &ValidationError{Message: "Only JPEG, PNG, GIF and WebP images can be uploaded."}
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, &ValidationError{Message: "One of the images couldn't be read."}
+	}
+
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, &ValidationError{Message: "Images can be at most 40 megapixels."}
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, &ValidationError{Message: "One of the images couldn't be read."}
+	}
+
+	if ct == "image/jpeg" {
+		src = applyOrientation(src, jpegOrientation(data))
+	}
+
+	return src, nil
+}
+
+func resize(src image.Image, maxWidth int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if w > maxWidth {
+		h = h * maxWidth / w
+		w = maxWidth
+		if h < 1 {
+			h = 1
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	if w == b.Dx() {
+		draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+		return dst
+	}
+
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
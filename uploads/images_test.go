@@ -0,0 +1,157 @@
+package uploads
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+)
+
+// pngBytes encodes a w by h PNG, with a gradient so that different sizes never hash the same.
+func pngBytes(t *testing.T, w int, h int) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// pngHeader is just the start of a PNG claiming to be w by h, enough for DecodeConfig.
+func pngHeader(w int, h int) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(w))
+	binary.BigEndian.PutUint32(ihdr[8:], uint32(h))
+	ihdr[12], ihdr[13] = 8, 6 // 8 bit RGBA
+
+	b := []byte("\x89PNG\r\n\x1a\n")
+	b = binary.BigEndian.AppendUint32(b, 13)
+	b = append(b, ihdr...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestProcessRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"text", []byte("just a rant, not an image")},
+		{"html", []byte("<html><body><img src=x></body></html>")},
+		{"svg", []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`)},
+		{"truncated png", pngBytes(t, 10, 10)[:40]},
+		{"too many pixels", pngHeader(8000, 6000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, variants, err := Process(tt.data)
+			var v *ValidationError
+			if !errors.As(err, &v) || variants != nil {
+				t.Errorf("Process(%s) = %v, want a ValidationError", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestProcessVariants(t *testing.T) {
+	tests := []struct {
+		name   string
+		w, h   int
+		widths map[string]int
+	}{
+		{"large", 2000, 1000, map[string]int{"thumb": 320, "medium": 960, "full": 1920}},
+		{"medium", 500, 400, map[string]int{"thumb": 320, "medium": 500, "full": 500}},
+		{"small, never upscaled", 100, 50, map[string]int{"thumb": 100, "medium": 100, "full": 100}},
+		{"thin", 4000, 1, map[string]int{"thumb": 320, "medium": 960, "full": 1920}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := pngBytes(t, tt.w, tt.h)
+			img, variants, err := Process(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sum := sha256.Sum256(data)
+			if img.Hash != hex.EncodeToString(sum[:]) || img.Width != tt.w || img.Height != tt.h {
+				t.Errorf("Process = %+v, want the original's hash and size", img)
+			}
+			if len(variants) != len(Variants) {
+				t.Fatalf("Process made %d variants, want %d", len(variants), len(Variants))
+			}
+
+			for name, w := range tt.widths {
+				cfg, format, err := image.DecodeConfig(bytes.NewReader(variants[name]))
+				if err != nil || format != "webp" {
+					t.Fatalf("%s variant is %s: %v", name, format, err)
+				}
+				if cfg.Width != w || cfg.Height < 1 || cfg.Height > tt.h {
+					t.Errorf("%s variant is %dx%d, want %d wide", name, cfg.Width, cfg.Height, w)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessAvatarCrops(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+
+	tests := []struct {
+		name string
+		w, h int
+		crop Crop
+		same Crop // The crop it's clamped to
+	}{
+		{"centred", 300, 200, Crop{Zoom: 1, X: 0.5, Y: 0.5}, Crop{Zoom: 1, X: 0.5, Y: 0.5}},
+		{"zero zoom", 300, 200, Crop{Zoom: 0, X: 0.5, Y: 0.5}, Crop{Zoom: 1, X: 0.5, Y: 0.5}},
+		{"negative offsets", 300, 200, Crop{Zoom: 2, X: -3, Y: -0.1}, Crop{Zoom: 2, X: 0, Y: 0}},
+		{"offsets past the edge", 200, 300, Crop{Zoom: 2, X: 5, Y: 1.5}, Crop{Zoom: 2, X: 1, Y: 1}},
+		{"box larger than the image", 200, 300, Crop{Zoom: 0.01, X: 0, Y: 0}, Crop{Zoom: 1, X: 0, Y: 0}},
+		{"zoom past the limit", 300, 300, Crop{Zoom: 1000, X: 1, Y: 1}, Crop{Zoom: 10, X: 1, Y: 1}},
+		{"infinities", 300, 200, Crop{Zoom: inf, X: -inf, Y: inf}, Crop{Zoom: 10, X: 0, Y: 1}},
+		{"NaN", 300, 200, Crop{Zoom: nan, X: nan, Y: nan}, Crop{Zoom: 1, X: 0.5, Y: 0.5}},
+		{"single pixel", 1, 1, Crop{Zoom: 10, X: 1, Y: 1}, Crop{Zoom: 1, X: 0, Y: 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := pngBytes(t, tt.w, tt.h)
+			hash, b, err := ProcessAvatar(data, tt.crop)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+			if err != nil || format != "webp" || cfg.Width != avatarSize || cfg.Height != avatarSize {
+				t.Fatalf("avatar is %s %dx%d, %v, want a %d square WebP", format, cfg.Width, cfg.Height, err, avatarSize)
+			}
+
+			if want, _, _ := ProcessAvatar(data, tt.same); hash != want {
+				t.Errorf("crop %+v isn't the same as %+v", tt.crop, tt.same)
+			}
+		})
+	}
+
+	if _, _, err := ProcessAvatar([]byte("not an image"), Crop{Zoom: 1}); err == nil {
+		t.Error("ProcessAvatar accepted a text file")
+	}
+}
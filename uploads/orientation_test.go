@@ -0,0 +1,132 @@
+package uploads
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// exifSegment is an APP1 segment holding just an orientation tag, in the given TIFF byte order.
+func exifSegment(order string, orientation int) []byte {
+	var bo binary.AppendByteOrder = binary.LittleEndian
+	if order == "MM" {
+		bo = binary.BigEndian
+	}
+
+	tiff := []byte(order)
+	tiff = bo.AppendUint16(tiff, 42)
+	tiff = bo.AppendUint32(tiff, 8) // The first IFD comes straight after the header
+	tiff = bo.AppendUint16(tiff, 1)
+	tiff = bo.AppendUint16(tiff, 0x0112)
+	tiff = bo.AppendUint16(tiff, 3) // SHORT
+	tiff = bo.AppendUint32(tiff, 1)
+	tiff = bo.AppendUint16(tiff, uint16(orientation))
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	return append(binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(len(seg)+2)), seg...)
+}
+
+// withSegment puts a segment straight after a JPEG's start of image marker.
+func withSegment(jpg []byte, seg []byte) []byte {
+	return append(append(append([]byte{}, jpg[:2]...), seg...), jpg[2:]...)
+}
+
+func jpegBytes(t *testing.T, w int, h int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	jpg := jpegBytes(t, 4, 2)
+	truncated := withSegment(jpg, exifSegment("II", 6))
+	truncated = truncated[:2+4+10]
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", jpg, 1},
+		{"little endian", withSegment(jpg, exifSegment("II", 6)), 6},
+		{"big endian", withSegment(jpg, exifSegment("MM", 8)), 8},
+		{"out of range", withSegment(jpg, exifSegment("II", 9)), 1},
+		{"zero", withSegment(jpg, exifSegment("MM", 0)), 1},
+		{"bad byte order", withSegment(jpg, exifSegment("XX", 6)), 1},
+		{"truncated", truncated, 1},
+		{"not a jpeg", pngHeader(4, 2), 1},
+		{"empty", nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("jpegOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// 3x2 with the top corners marked, where they end up shows the rotation or flip
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	topLeft, topRight := color.NRGBA{R: 255, A: 255}, color.NRGBA{G: 255, A: 255}
+	src.Set(0, 0, topLeft)
+	src.Set(2, 0, topRight)
+
+	tests := []struct {
+		orientation int
+		w, h        int
+		topLeft     image.Point
+		topRight    image.Point
+	}{
+		{1, 3, 2, image.Pt(0, 0), image.Pt(2, 0)},
+		{2, 3, 2, image.Pt(2, 0), image.Pt(0, 0)},
+		{3, 3, 2, image.Pt(2, 1), image.Pt(0, 1)},
+		{4, 3, 2, image.Pt(0, 1), image.Pt(2, 1)},
+		{5, 2, 3, image.Pt(0, 0), image.Pt(0, 2)},
+		{6, 2, 3, image.Pt(1, 0), image.Pt(1, 2)},
+		{7, 2, 3, image.Pt(1, 2), image.Pt(1, 0)},
+		{8, 2, 3, image.Pt(0, 2), image.Pt(0, 0)},
+	}
+
+	for _, tt := range tests {
+		dst := applyOrientation(src, tt.orientation)
+		b := dst.Bounds()
+		if b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("orientation %d gives %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.w, tt.h)
+			continue
+		}
+		if c := color.NRGBAModel.Convert(dst.At(tt.topLeft.X, tt.topLeft.Y)); c != topLeft {
+			t.Errorf("orientation %d: top left corner isn't at %v", tt.orientation, tt.topLeft)
+		}
+		if c := color.NRGBAModel.Convert(dst.At(tt.topRight.X, tt.topRight.Y)); c != topRight {
+			t.Errorf("orientation %d: top right corner isn't at %v", tt.orientation, tt.topRight)
+		}
+	}
+}
+
+func TestProcessAppliesOrientation(t *testing.T) {
+	// A phone photo taken upright is stored sideways, 40x20 with orientation 6
+	img, variants, err := Process(withSegment(jpegBytes(t, 40, 20), exifSegment("MM", 6)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Width != 20 || img.Height != 40 {
+		t.Errorf("Process = %dx%d, want it turned upright to 20x40", img.Width, img.Height)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(variants["full"]))
+	if err != nil || cfg.Width != 20 || cfg.Height != 40 {
+		t.Errorf("full variant is %dx%d, %v, want 20x40", cfg.Width, cfg.Height, err)
+	}
+}
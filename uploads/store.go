@@ -0,0 +1,140 @@
+package uploads
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BlobStore is where processed image files live. Keys are slash-separated relative paths, e.g. "<hash>/thumb.webp".
+// The local filesystem is the only implementation for now, but an object storage bucket should fit behind the same methods.
+type BlobStore interface {
+	Put(key string, r io.Reader) error
+	Open(key string) (io.ReadSeekCloser, time.Time, error)
+	Delete(key string) error
+	// Walk calls fn for every stored key along with its last modified time.
+	Walk(fn func(key string, modified time.Time) error) error
+}
+
+var ErrInvalidKey = errors.New("error: invalid blob key")
+
+type LocalStore struct {
+	Root string
+}
+
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{Root: root}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	p := filepath.FromSlash(key)
+	if !filepath.IsLocal(p) {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(s.Root, p), nil
+}
+
+// Put writes to a temp file first and renames it into place, so a half written blob is never served.
+func (s *LocalStore) Put(key string, r io.Reader) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), p)
+}
+
+func (s *LocalStore) Open(key string) (io.ReadSeekCloser, time.Time, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, err
+	}
+
+	if info.IsDir() {
+		f.Close()
+		return nil, time.Time{}, fs.ErrNotExist
+	}
+
+	return f, info.ModTime(), nil
+}
+
+// Delete removes the blob, and its directory too once that's empty.
+func (s *LocalStore) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if dir := filepath.Dir(p); dir != s.Root {
+		// Fails harmlessly if other variants are still in there
+		os.Remove(dir)
+	}
+
+	return nil
+}
+
+func (s *LocalStore) Walk(fn func(key string, modified time.Time) error) error {
+	return filepath.WalkDir(s.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || d.Name()[0] == '.' {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.Root, p)
+		if err != nil {
+			return err
+		}
+
+		return fn(filepath.ToSlash(rel), info.ModTime())
+	})
+}
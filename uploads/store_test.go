@@ -0,0 +1,123 @@
+package uploads
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTempStore points Store at a fresh LocalStore for the test and returns it.
+func useTempStore(t *testing.T) *LocalStore {
+	t.Helper()
+
+	s, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	Store = s
+	t.Cleanup(func() { Store = nil })
+
+	return s
+}
+
+func TestLocalStoreKeys(t *testing.T) {
+	s, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"abc/thumb.webp", true},
+		{"abc/../def/thumb.webp", true},
+		{"thumb.webp", true},
+		{"", false},
+		{"..", false},
+		{"../thumb.webp", false},
+		{"abc/../../thumb.webp", false},
+		{"/etc/passwd", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			p, err := s.path(tt.key)
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("path(%q) = %q, %v, want ErrInvalidKey", tt.key, p, err)
+				}
+				if err := s.Put(tt.key, strings.NewReader("x")); !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("Put(%q) = %v, want ErrInvalidKey", tt.key, err)
+				}
+				if _, _, err := s.Open(tt.key); !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("Open(%q) = %v, want ErrInvalidKey", tt.key, err)
+				}
+				if err := s.Delete(tt.key); !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("Delete(%q) = %v, want ErrInvalidKey", tt.key, err)
+				}
+				return
+			}
+
+			if err != nil || !strings.HasPrefix(p, s.Root+string(filepath.Separator)) {
+				t.Errorf("path(%q) = %q, %v, want a file under %s", tt.key, p, err, s.Root)
+			}
+		})
+	}
+}
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	s, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put("abc/thumb.webp", strings.NewReader("pixels")); err != nil {
+		t.Fatal(err)
+	}
+
+	f, modified, err := s.Open("abc/thumb.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || string(b) != "pixels" || time.Since(modified) > time.Minute {
+		t.Errorf("Open read %q, %v, modified %v", b, err, modified)
+	}
+
+	// A directory isn't a blob
+	if _, _, err := s.Open("abc"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open of a directory = %v, want fs.ErrNotExist", err)
+	}
+
+	// Leftover temp files from an interrupted Put aren't listed
+	if err := os.WriteFile(filepath.Join(s.Root, "abc", ".upload-123"), []byte("half"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	err = s.Walk(func(key string, modified time.Time) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil || len(keys) != 1 || keys[0] != "abc/thumb.webp" {
+		t.Errorf("Walk listed %v, %v", keys, err)
+	}
+
+	os.Remove(filepath.Join(s.Root, "abc", ".upload-123"))
+	if err := s.Delete("abc/thumb.webp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(s.Root, "abc")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Delete left the empty directory behind: %v", err)
+	}
+	// Deleting twice is fine, garbage collection may race a manual cleanup
+	if err := s.Delete("abc/thumb.webp"); err != nil {
+		t.Errorf("Delete of a missing blob = %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package users
+
+import (
+	"errors"
+	"time"
+
+	"gorant/database"
+)
+
+// ErrBlocked is returned when someone tries to follow a user they blocked or who blocked them.
+var ErrBlocked = errors.New("error: blocked")
+
+// ToggleFollow follows followee, or unfollows them if follower already does. It returns whether follower follows them now.
+// Unfollowing always works, following doesn't if either of them blocked the other.
+func ToggleFollow(followerID string, followeeID string) (bool, error) {
+	res, err := database.DB.Exec("DELETE FROM follows WHERE follower_id=$1 AND followee_id=$2", followerID, followeeID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return false, nil
+	}
+
+	var blocked bool
+	err = database.DB.QueryRow(`SELECT EXISTS (
+									SELECT 1 FROM user_relations
+									WHERE kind=$3 AND ((user_id=$1 AND target_id=$2) OR (user_id=$2 AND target_id=$1))
+								)`, followerID, followeeID, RelationBlock).Scan(&blocked)
+	if err != nil {
+		return false, err
+	}
+	if blocked {
+		return false, ErrBlocked
+	}
+
+	_, err = database.DB.Exec(`INSERT INTO follows (follower_id, followee_id, created_at) VALUES ($1, $2, $3)
+								ON CONFLICT (follower_id, followee_id) DO NOTHING`, followerID, followeeID, time.Now().Format(time.RFC3339))
+	return err == nil, err
+}
+
+func IsFollowing(followerID string, followeeID string) (bool, error) {
+	var following bool
+	err := database.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id=$1 AND followee_id=$2)", followerID, followeeID).Scan(&following)
+
+	return following, err
+}
+
+type FollowCounts struct {
+	Followers int `db:"followers"`
+	Following int `db:"following"`
+}
+
+func GetFollowCounts(userID string) (FollowCounts, error) {
+	var c FollowCounts
+	err := database.DB.Get(&c, `SELECT
+									(SELECT COUNT(1) FROM follows WHERE followee_id=$1) AS followers,
+									(SELECT COUNT(1) FROM follows WHERE follower_id=$1) AS following`, userID)
+
+	return c, err
+}
@@ -0,0 +1,49 @@
+package users
+
+import (
+	"testing"
+
+	"gorant/database/dbtest"
+)
+
+func TestToggleFollowBlocked(t *testing.T) {
+	dbtest.Open(t)
+	for _, u := range []string{"alice", "bob", "carol"} {
+		dbtest.AddUser(t, u)
+	}
+
+	if following, err := ToggleFollow("alice", "bob"); err != nil || !following {
+		t.Fatalf("ToggleFollow(alice, bob) = %v, %v, want following", following, err)
+	}
+
+	// Blocking drops the follow and stops it coming back, whoever blocked whom
+	if err := SetRelation("bob", "alice", RelationBlock); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRelation("carol", "alice", RelationBlock); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct{ follower, followee string }{
+		{"alice", "bob"},
+		{"bob", "alice"},
+		{"alice", "carol"},
+		{"carol", "alice"},
+	} {
+		if following, err := ToggleFollow(tt.follower, tt.followee); err != ErrBlocked || following {
+			t.Errorf("ToggleFollow(%s, %s) = %v, %v, want ErrBlocked", tt.follower, tt.followee, following, err)
+		}
+	}
+
+	if following, err := IsFollowing("alice", "bob"); err != nil || following {
+		t.Errorf("IsFollowing(alice, bob) = %v, %v after bob blocked alice", following, err)
+	}
+
+	// Muting isn't blocking
+	if err := SetRelation("bob", "carol", RelationMute); err != nil {
+		t.Fatal(err)
+	}
+	if following, err := ToggleFollow("carol", "bob"); err != nil || !following {
+		t.Errorf("ToggleFollow(carol, bob) = %v, %v, want following despite the mute", following, err)
+	}
+}
@@ -0,0 +1,116 @@
+package users
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gorant/database"
+)
+
+// Handles are what @mentions and profile URLs use. They follow the same rules as markdown mentions.
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+func ValidHandle(h string) bool {
+	return handlePattern.MatchString(h)
+}
+
+// NewHandle derives a free handle from a user ID, e.g. "Jane.Doe@example.com" becomes "janedoe",
+// or "janedoe2" if that's taken.
+func NewHandle(userID string) (string, error) {
+	local, _, _ := strings.Cut(strings.ToLower(userID), "@")
+
+	var b strings.Builder
+	for _, r := range local {
+		if r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') {
+			b.WriteRune(r)
+		}
+	}
+
+	base := b.String()
+	if len(base) > 26 {
+		base = base[:26]
+	}
+	if len(base) < 3 {
+		base = "user" + base
+	}
+
+	for i := 1; i < 1000; i++ {
+		h := base
+		if i > 1 {
+			h = fmt.Sprintf("%s%d", base, i)
+		}
+
+		var exists bool
+		err := database.DB.QueryRow("SELECT true FROM users WHERE handle=$1", h).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return h, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("error: no free handle for %q", userID)
+}
+
+// BackfillHandles gives a handle to every user who signed up before there were handles, except the given
+// ones, e.g. the anonymous user.
+func BackfillHandles(except ...string) error {
+	var ids []string
+	if err := database.DB.Select(&ids, "SELECT user_id FROM users WHERE handle IS NULL ORDER BY user_id"); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if slices.Contains(except, id) {
+			continue
+		}
+
+		h, err := NewHandle(id)
+		if err != nil {
+			return err
+		}
+		if _, err := database.DB.Exec("UPDATE users SET handle=$1 WHERE user_id=$2", h, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type Suggestion struct {
+	Handle        string `db:"handle"`
+	PreferredName string `db:"preferred_name"`
+	UserID        string `db:"user_id"`
+	Avatar        string `db:"avatar"`
+	AvatarPath    string
+}
+
+// Suggest lists users whose handle or preferred name starts with q, for @mention autocomplete.
+func Suggest(q string, limit int) ([]Suggestion, error) {
+	var list []Suggestion
+
+	q = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(q)), "@")
+	if q == "" {
+		return list, nil
+	}
+	// LIKE wildcards in the query are matched literally
+	q = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q) + "%"
+
+	err := database.DB.Select(&list, `SELECT handle, preferred_name, user_id, avatar FROM users
+									WHERE handle IS NOT NULL AND (handle LIKE $1 OR LOWER(preferred_name) LIKE $1)
+									ORDER BY handle
+									LIMIT $2`, q, limit)
+	if err != nil {
+		return list, err
+	}
+
+	for i := range list {
+		list[i].AvatarPath = ChooseAvatar(list[i].Avatar, list[i].UserID)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,49 @@
+package users
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// IdenticonSeed hashes the user ID, so the identicon URL doesn't give away the user's email.
+func IdenticonSeed(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return hex.EncodeToString(sum[:8])
+}
+
+func IdenticonPath(userID string) string {
+	return "/avatars/identicon/" + IdenticonSeed(userID)
+}
+
+// Identicon draws a 5x5 grid mirrored down the middle, GitHub style. Cells and colour both come from the seed,
+// so the same seed always produces the same SVG.
+func Identicon(seed string) []byte {
+	sum := sha256.Sum256([]byte(seed))
+
+	hue := int(sum[0]) * 360 / 256
+	fg := fmt.Sprintf("hsl(%d, 55%%, 55%%)", hue)
+	bg := fmt.Sprintf("hsl(%d, 40%%, 92%%)", hue)
+
+	var b strings.Builder
+	b.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="-1 -1 7 7" shape-rendering="crispEdges">`)
+	fmt.Fprintf(&b, `<rect x="-1" y="-1" width="7" height="7" fill="%s"/>`, bg)
+
+	// Only the left three columns are decided by the seed, columns 3 and 4 mirror 1 and 0
+	for row := 0; row < 5; row++ {
+		for col := 0; col < 3; col++ {
+			if sum[1+row*3+col]&1 == 0 {
+				continue
+			}
+
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="1" height="1" fill="%s"/>`, col, row, fg)
+			if col < 2 {
+				fmt.Fprintf(&b, `<rect x="%d" y="%d" width="1" height="1" fill="%s"/>`, 4-col, row, fg)
+			}
+		}
+	}
+
+	b.WriteString(`</svg>`)
+	return []byte(b.String())
+}
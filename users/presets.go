@@ -0,0 +1,116 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorant/database"
+)
+
+// MaxPresets is how many filter presets a user can save.
+const MaxPresets = 20
+
+var (
+	ErrPresetName     = errors.New("preset names need 1 to 60 characters")
+	ErrPresetNotFound = errors.New("preset not found")
+	ErrPresetsFull    = errors.New("you can save 20 presets at most, delete one first")
+)
+
+// FilterPreset is a named front page filter a user saved. Query is the filter as a URL query string, the way
+// the filter form and shared filter links encode it.
+type FilterPreset struct {
+	PresetID  int    `db:"preset_id"`
+	Name      string `db:"name"`
+	Query     string `db:"query"`
+	IsDefault bool   `db:"is_default"`
+}
+
+// SavePreset saves the filter query under name, replacing the user's preset of that name if they have one.
+// A default preset becomes the user's landing view instead of the previous default.
+func SavePreset(userID string, name string, query string, isDefault bool) (FilterPreset, error) {
+	p := FilterPreset{Name: strings.TrimSpace(name), Query: query, IsDefault: isDefault}
+	if n := utf8.RuneCountInString(p.Name); n == 0 || n > 60 {
+		return p, ErrPresetName
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return p, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(1) FROM filter_presets WHERE user_id=$1 AND name<>$2", userID, p.Name).Scan(&count); err != nil {
+		return p, err
+	}
+	if count >= MaxPresets {
+		return p, ErrPresetsFull
+	}
+
+	if isDefault {
+		if _, err := tx.Exec("UPDATE filter_presets SET is_default=false WHERE user_id=$1", userID); err != nil {
+			return p, err
+		}
+	}
+
+	err = tx.QueryRow(`INSERT INTO filter_presets (user_id, name, query, is_default, created_at) VALUES ($1, $2, $3, $4, $5)
+						ON CONFLICT (user_id, name) DO UPDATE SET query=EXCLUDED.query, is_default=EXCLUDED.is_default
+						RETURNING preset_id`, userID, p.Name, p.Query, p.IsDefault, time.Now().Format(time.RFC3339)).Scan(&p.PresetID)
+	if err != nil {
+		return p, err
+	}
+
+	return p, tx.Commit()
+}
+
+func ListPresets(userID string) ([]FilterPreset, error) {
+	var list []FilterPreset
+	err := database.DB.Select(&list, "SELECT preset_id, name, query, is_default FROM filter_presets WHERE user_id=$1 ORDER BY name", userID)
+
+	return list, err
+}
+
+// SetDefaultPreset makes a preset the user's landing view, or takes the default away if it already is.
+func SetDefaultPreset(userID string, presetID int) error {
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var wasDefault bool
+	err = tx.QueryRow("SELECT is_default FROM filter_presets WHERE user_id=$1 AND preset_id=$2", userID, presetID).Scan(&wasDefault)
+	if err == sql.ErrNoRows {
+		return ErrPresetNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// One statement per row, the unique index on defaults would see two at once otherwise
+	if _, err := tx.Exec("UPDATE filter_presets SET is_default=false WHERE user_id=$1 AND is_default", userID); err != nil {
+		return err
+	}
+	if !wasDefault {
+		if _, err := tx.Exec("UPDATE filter_presets SET is_default=true WHERE preset_id=$1", presetID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func DeletePreset(userID string, presetID int) error {
+	res, err := database.DB.Exec("DELETE FROM filter_presets WHERE user_id=$1 AND preset_id=$2", userID, presetID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPresetNotFound
+	}
+
+	return nil
+}
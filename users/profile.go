@@ -0,0 +1,34 @@
+package users
+
+import (
+	"gorant/database"
+)
+
+// Profile is the public side of a user, what /users/{handle} shows to everyone.
+type Profile struct {
+	UserID        string `db:"user_id"`
+	Handle        string `db:"handle"`
+	PreferredName string `db:"preferred_name"`
+	Avatar        string `db:"avatar"`
+	AvatarPath    string
+	HideActivity  bool `db:"hide_activity"`
+	ContactMe     bool `db:"contact_me"` // Accepts direct messages
+}
+
+func GetProfile(handle string) (Profile, error) {
+	var p Profile
+
+	err := database.DB.QueryRow("SELECT user_id, handle, preferred_name, avatar, hide_activity=1, contact_me=1 FROM users WHERE handle=$1", handle).Scan(&p.UserID, &p.Handle, &p.PreferredName, &p.Avatar, &p.HideActivity, &p.ContactMe)
+	if err != nil {
+		return p, err
+	}
+	p.AvatarPath = ChooseAvatar(p.Avatar, p.UserID)
+
+	return p, nil
+}
+
+// ActivityVisibleTo reports whether viewer may see the user's posts, comments and stats.
+// Hidden activity is still visible to the user themselves and to moderators.
+func (p Profile) ActivityVisibleTo(viewer *User) bool {
+	return !p.HideActivity || viewer.UserID == p.UserID || viewer.IsModerator()
+}
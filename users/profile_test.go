@@ -0,0 +1,54 @@
+package users
+
+import (
+	"testing"
+
+	"gorant/database"
+	"gorant/database/dbtest"
+)
+
+func TestActivityVisibleTo(t *testing.T) {
+	tests := []struct {
+		name    string
+		hide    bool
+		viewer  User
+		visible bool
+	}{
+		{"shown to others", false, User{UserID: "bob"}, true},
+		{"shown to the anonymous user", false, User{}, true},
+		{"hidden from others", true, User{UserID: "bob"}, false},
+		{"hidden from the anonymous user", true, User{}, false},
+		{"visible to the owner", true, User{UserID: "alice"}, true},
+		{"visible to moderators", true, User{UserID: "mod", Role: "moderator"}, true},
+		{"visible to admins", true, User{UserID: "admin", Role: "admin"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Profile{UserID: "alice", HideActivity: tt.hide}
+			if got := p.ActivityVisibleTo(&tt.viewer); got != tt.visible {
+				t.Errorf("ActivityVisibleTo = %v, want %v", got, tt.visible)
+			}
+		})
+	}
+}
+
+func TestGetProfileHideActivity(t *testing.T) {
+	dbtest.Open(t)
+	dbtest.AddUser(t, "alice")
+
+	if p, err := GetProfile("alice"); err != nil || p.HideActivity || !p.ActivityVisibleTo(&User{UserID: "bob"}) {
+		t.Fatalf("GetProfile = %+v, %v, want activity shown by default", p, err)
+	}
+
+	if _, err := database.DB.Exec("UPDATE users SET hide_activity=1 WHERE user_id='alice'"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := GetProfile("alice")
+	if err != nil || !p.HideActivity {
+		t.Fatalf("GetProfile = %+v, %v, want hidden activity", p, err)
+	}
+	if p.ActivityVisibleTo(&User{UserID: "bob"}) || !p.ActivityVisibleTo(&User{UserID: "alice"}) {
+		t.Error("hidden activity is visible to others or not to alice")
+	}
+}
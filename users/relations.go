@@ -0,0 +1,83 @@
+package users
+
+import (
+	"errors"
+	"time"
+
+	"gorant/database"
+)
+
+// Relations one user can have towards another. Muting collapses someone's posts and comments for you.
+// Blocking does the same, and also stops them replying to your posts, mentioning you or messaging you.
+const (
+	RelationMute  = "mute"
+	RelationBlock = "block"
+)
+
+type Relation struct {
+	TargetID      string `db:"target_id"`
+	Handle        string `db:"handle"`
+	PreferredName string `db:"preferred_name"`
+	Avatar        string `db:"avatar"`
+	AvatarPath    string
+	Kind          string `db:"kind"`
+	CreatedAt     string `db:"created_at"`
+}
+
+// SetRelation mutes or blocks target, replacing any relation userID already had with them.
+func SetRelation(userID string, targetID string, kind string) error {
+	if kind != RelationMute && kind != RelationBlock {
+		return errors.New("error: unknown relation")
+	}
+	if userID == targetID {
+		return errors.New("error: can't mute or block yourself")
+	}
+
+	_, err := database.DB.Exec(`INSERT INTO user_relations (user_id, target_id, kind, created_at) VALUES ($1, $2, $3, $4)
+								ON CONFLICT (user_id, target_id) DO UPDATE SET kind=EXCLUDED.kind, created_at=EXCLUDED.created_at`, userID, targetID, kind, time.Now().Format(time.RFC3339))
+	if err != nil || kind != RelationBlock {
+		return err
+	}
+
+	// Blocking also drops follows either way, so a blocked user doesn't keep getting your rants in their feed
+	_, err = database.DB.Exec(`DELETE FROM follows WHERE (follower_id=$1 AND followee_id=$2) OR (follower_id=$2 AND followee_id=$1)`, userID, targetID)
+	return err
+}
+
+func RemoveRelation(userID string, targetID string) error {
+	_, err := database.DB.Exec("DELETE FROM user_relations WHERE user_id=$1 AND target_id=$2", userID, targetID)
+	return err
+}
+
+// GetRelation returns "mute", "block", or "" if userID has neither towards target.
+func GetRelation(userID string, targetID string) (string, error) {
+	var kind string
+	err := database.DB.QueryRow(`SELECT COALESCE((SELECT kind FROM user_relations WHERE user_id=$1 AND target_id=$2), '')`, userID, targetID).Scan(&kind)
+
+	return kind, err
+}
+
+// HasBlocked reports whether userID has blocked target.
+func HasBlocked(userID string, targetID string) (bool, error) {
+	kind, err := GetRelation(userID, targetID)
+	return kind == RelationBlock, err
+}
+
+func ListRelations(userID string) ([]Relation, error) {
+	var list []Relation
+
+	err := database.DB.Select(&list, `SELECT user_relations.target_id, COALESCE(users.handle, '') AS handle, users.preferred_name, users.avatar, user_relations.kind, user_relations.created_at
+									FROM user_relations
+										INNER JOIN users ON users.user_id=user_relations.target_id
+									WHERE user_relations.user_id=$1
+									ORDER BY user_relations.kind, users.preferred_name`, userID)
+	if err != nil {
+		return list, err
+	}
+
+	for i := range list {
+		list[i].AvatarPath = ChooseAvatar(list[i].Avatar, list[i].TargetID)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,67 @@
+package users
+
+import (
+	"testing"
+
+	"gorant/database/dbtest"
+)
+
+func TestSetRelation(t *testing.T) {
+	dbtest.Open(t)
+	for _, u := range []string{"alice", "bob", "carol", "dave"} {
+		dbtest.AddUser(t, u)
+	}
+
+	for _, tt := range []struct{ follower, followee string }{
+		{"alice", "bob"},
+		{"bob", "alice"},
+		{"alice", "carol"},
+		{"carol", "alice"},
+		{"dave", "bob"},
+	} {
+		if following, err := ToggleFollow(tt.follower, tt.followee); err != nil || !following {
+			t.Fatalf("ToggleFollow(%s, %s) = %v, %v", tt.follower, tt.followee, following, err)
+		}
+	}
+
+	if err := SetRelation("alice", "bob", RelationBlock); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRelation("alice", "carol", RelationMute); err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocking drops the follows both ways and nobody else's, muting keeps them
+	for _, tt := range []struct {
+		follower, followee string
+		following          bool
+	}{
+		{"alice", "bob", false},
+		{"bob", "alice", false},
+		{"alice", "carol", true},
+		{"carol", "alice", true},
+		{"dave", "bob", true},
+	} {
+		if following, err := IsFollowing(tt.follower, tt.followee); err != nil || following != tt.following {
+			t.Errorf("IsFollowing(%s, %s) = %v, %v, want %v", tt.follower, tt.followee, following, err, tt.following)
+		}
+	}
+
+	// A new relation replaces the old one, in one direction only
+	if err := SetRelation("alice", "bob", RelationMute); err != nil {
+		t.Fatal(err)
+	}
+	if kind, err := GetRelation("alice", "bob"); err != nil || kind != RelationMute {
+		t.Errorf("GetRelation(alice, bob) = %q, %v, want %q", kind, err, RelationMute)
+	}
+	if kind, err := GetRelation("bob", "alice"); err != nil || kind != "" {
+		t.Errorf("GetRelation(bob, alice) = %q, %v, want none", kind, err)
+	}
+
+	if err := SetRelation("alice", "alice", RelationBlock); err == nil {
+		t.Error("SetRelation let alice block alice")
+	}
+	if err := SetRelation("alice", "dave", "ignore"); err == nil {
+		t.Error("SetRelation accepted an unknown kind")
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"gorant/database"
+	"gorant/uploads"
 
 	"github.com/rezakhademix/govalidator/v2"
 )
@@ -20,6 +23,11 @@ type User struct {
 	Avatar          string `db:"avatar"`
 	AvatarPath      string
 	SortComments    string `db:"sort_comments"`
+	Role            string `db:"role"`
+	Handle          string `db:"handle"`         // For @mentions and /users/{handle}, see NewHandle
+	HideActivity    int    `db:"hide_activity"`  // 1 hides posts, comments and stats on the profile page from everyone else
+	AutoSubscribe   int    `db:"auto_subscribe"` // 1 subscribes the user to every discussion they comment on
+	Digest          string `db:"digest"`         // "off", "daily" or "weekly", see notifications.SendDueDigests
 }
 
 type Settings struct {
@@ -27,37 +35,50 @@ type Settings struct {
 	ContactMe     string
 	Avatar        string
 	SortComments  string
+	Digest        string
+	HideActivity  string
+	AutoSubscribe string
 }
 
 func (u *User) GetSettings(username string) error {
-	if err := database.DB.QueryRow("SELECT * FROM users WHERE user_id=$1", username).Scan(&u.UserID, &u.Email, &u.PreferredName, &u.ContactMe, &u.Avatar, &u.SortComments); err != nil {
+	if err := database.DB.QueryRow("SELECT user_id, email, preferred_name, contact_me, avatar, sort_comments, role, COALESCE(handle, ''), hide_activity, auto_subscribe, digest FROM users WHERE user_id=$1", username).Scan(&u.UserID, &u.Email, &u.PreferredName, &u.ContactMe, &u.Avatar, &u.SortComments, &u.Role, &u.Handle, &u.HideActivity, &u.AutoSubscribe, &u.Digest); err != nil {
 		if err == sql.ErrNoRows {
 			fmt.Println("Weird, no user settings found!")
 			return err
 		}
 	}
 	u.ContactMeString = strconv.Itoa(u.ContactMe)
-	u.AvatarPath = ChooseAvatar(u.Avatar)
+	u.AvatarPath = ChooseAvatar(u.Avatar, u.UserID)
 
 	return nil
 }
 
+// IsModerator reports whether the user can act on content they don't own, e.g. restoring revisions.
+func (u *User) IsModerator() bool {
+	return u.Role == "moderator" || u.Role == "admin"
+}
+
 const regex string = `^[0-9A-Za-z -_+()[]|@\.]+$`
 
 func Validate(s Settings) map[string](string) {
 	v := govalidator.New()
 
 	var ok bool = false
-	avatarVals := []string{"default", "shiba", "cat", "parrot", "bulldog"}
+	avatarVals := []string{"default", AvatarIdenticon, "shiba", "cat", "parrot", "bulldog"}
 	for _, v := range avatarVals {
 		if v == s.Avatar {
 			ok = true
 			break
 		}
 	}
+	// Only keeps an existing upload selected, SaveSettings won't switch to someone else's
+	if uploadHash.MatchString(s.Avatar) {
+		ok = true
+	}
 
 	v.RequiredString(s.PreferredName, "preferred_name", "Please enter a preferred name").RegexMatches(s.PreferredName, regex, "preferred_name", "No special characters allowed! (Use only A-Z, a-z, 0-9, -, _, brackets, +)").MaxString(s.PreferredName, 255, "preferred_name", "Message is more than 255 characters.")
 	v.CustomRule(ok, "avatar", "Unrecognized avatar")
+	v.CustomRule(s.Digest == "off" || s.Digest == "daily" || s.Digest == "weekly", "digest", "Unrecognized digest frequency")
 
 	if v.IsFailed() {
 		return v.Errors()
@@ -76,7 +97,20 @@ func SaveSettings(username string, s Settings) error {
 		s.ContactMe = "1"
 	}
 
-	_, err := database.DB.Exec("UPDATE users SET preferred_name=$1, contact_me=$2, avatar=$3, sort_comments=$4 WHERE user_id=$5;", s.PreferredName, s.ContactMe, s.Avatar, s.SortComments, username)
+	hideActivity := 0
+	if s.HideActivity == "on" {
+		hideActivity = 1
+	}
+
+	autoSubscribe := 0
+	if s.AutoSubscribe == "on" {
+		autoSubscribe = 1
+	}
+
+	// An uploaded avatar can only be set through SaveAvatarUpload, here it can only be kept
+	_, err := database.DB.Exec(`UPDATE users SET preferred_name=$1, contact_me=$2, sort_comments=$4, digest=$6, hide_activity=$7, auto_subscribe=$8,
+									avatar=CASE WHEN $3 LIKE 'upload:%' AND $3 <> avatar THEN avatar ELSE $3 END
+								WHERE user_id=$5;`, s.PreferredName, s.ContactMe, s.Avatar, s.SortComments, username, s.Digest, hideActivity, autoSubscribe)
 	if err != nil {
 		return err
 	}
@@ -84,6 +118,20 @@ func SaveSettings(username string, s Settings) error {
 	return nil
 }
 
+// Unsubscribe turns off all non-essential email, the same as ticking the box in settings.
+func Unsubscribe(username string) error {
+	res, err := database.DB.Exec("UPDATE users SET contact_me=0 WHERE user_id=$1;", username)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("error: user not found")
+	}
+
+	return nil
+}
+
 func SaveSortComments(username string, s string) (string, error) {
 	switch s {
 
@@ -102,9 +150,21 @@ func SaveSortComments(username string, s string) (string, error) {
 	return s, nil
 }
 
-// TODO avatar choice
+const (
+	AvatarIdenticon    = "identicon"
+	avatarUploadPrefix = "upload:"
+)
+
+var uploadHash = regexp.MustCompile(`^upload:[0-9a-f]{64}$`)
 
-func ChooseAvatar(c string) string {
+// SaveAvatarUpload switches the user to an avatar they uploaded, hash being its blob hash in the uploads store.
+func SaveAvatarUpload(username string, hash string) error {
+	_, err := database.DB.Exec("UPDATE users SET avatar=$1 WHERE user_id=$2;", avatarUploadPrefix+hash, username)
+	return err
+}
+
+// ChooseAvatar maps the avatar setting to an image URL. Users who never picked one get the identicon for their user ID.
+func ChooseAvatar(c string, userID string) string {
 	var s string
 	switch c {
 	case "shiba":
@@ -115,8 +175,14 @@ func ChooseAvatar(c string) string {
 		s = "/static/images/avatars/avatar-parrot.webp"
 	case "bulldog":
 		s = "/static/images/avatars/avatar-bulldog.webp"
-	case "default":
-		s = "/static/images/avatars/avatar-shiba.webp"
+	case "default", AvatarIdenticon:
+		s = IdenticonPath(userID)
+	default:
+		if hash, ok := strings.CutPrefix(c, avatarUploadPrefix); ok {
+			s = "/uploads/" + uploads.BlobKey(hash, uploads.AvatarVariant)
+		} else {
+			s = IdenticonPath(userID)
+		}
 	}
 	return s
 }